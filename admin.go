@@ -0,0 +1,307 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Admin roles, each one includes the previous:
+// viewer reads configuration and state, operator also purges caches and
+// switches maintenance mode, admin also rotates Seafile token and manages legal holds.
+const (
+	ROLE_VIEWER   = "viewer"
+	ROLE_OPERATOR = "operator"
+	ROLE_ADMIN    = "admin"
+)
+
+var admin_role_levels = map[string]int{ROLE_VIEWER: 1, ROLE_OPERATOR: 2, ROLE_ADMIN: 3}
+
+// Admin key: name and role by secret.
+// Admin keys are separate from proxy API keys: operational access doesn't
+// give access to files and API keys don't give access to admin endpoints.
+type AdminKey struct {
+	Name string
+	Role string
+}
+
+var admin_keys = make(map[string]AdminKey)
+
+// Serve admin endpoints to local clients when no admin keys are configured.
+// Off by default: behind a reverse proxy on the same host every request is local.
+var admin_local bool
+
+// Same for /api/v1 changes and /sign when no proxy API keys are configured.
+var api_local bool
+
+// Uploads are refused while maintenance mode is on.
+var (
+	maintenance_mode    bool
+	maintenance_message string
+	maintenance_mutex   sync.RWMutex
+
+	// Guards token rotated by /admin/token.
+	token_mutex sync.RWMutex
+
+	// Credentials to log in again when Seafile rejects the token.
+	seafile_username string
+	seafile_password string
+	relogin_mutex    sync.Mutex
+)
+
+// Parses SEAFILE_ADMIN_KEYS value: "ops:secret1:operator,audit:secret2:viewer".
+func ParseAdminKeys(spec string) (map[string]AdminKey, error) {
+	keys := make(map[string]AdminKey)
+
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.SplitN(entry, ":", 3)
+		if len(parts) != 3 || parts[0] == "" || parts[1] == "" {
+			return nil, errors.New("Invalid admin key entry, expected name:secret:role")
+		}
+
+		if _, ok := admin_role_levels[parts[2]]; !ok {
+			return nil, errors.New("Invalid admin role " + parts[2] + " of " + parts[0] + ", expected viewer, operator or admin")
+		}
+
+		keys[parts[1]] = AdminKey{Name: parts[0], Role: parts[2]}
+	}
+
+	return keys, nil
+}
+
+func isLoopbackRequest(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Admin endpoints require admin key (X-Admin-Key header) with at least the role.
+// When no admin keys are configured they are refused, unless SEAFILE_ADMIN_LOCAL
+// allows local clients.
+func adminAuthorized(r *http.Request, role string) bool {
+	if len(admin_keys) == 0 {
+		return admin_local && isLoopbackRequest(r)
+	}
+
+	secret := r.Header.Get("X-Admin-Key")
+	if secret == "" {
+		return false
+	}
+
+	for key_secret, key := range admin_keys {
+		if subtle.ConstantTimeCompare([]byte(secret), []byte(key_secret)) == 1 {
+			if admin_role_levels[key.Role] < admin_role_levels[role] {
+				log.Println("Admin key", key.Name, "lacks role", role)
+				return false
+			}
+			return true
+		}
+	}
+
+	return false
+}
+
+// Whether uploads are refused, with the message for clients.
+func inMaintenance() (bool, string) {
+	maintenance_mutex.RLock()
+	defer maintenance_mutex.RUnlock()
+
+	return maintenance_mode, maintenance_message
+}
+
+// Answers 503 during maintenance. Returns whether request was refused.
+func refuseInMaintenance(w http.ResponseWriter) bool {
+	enabled, message := inMaintenance()
+	if !enabled {
+		return false
+	}
+
+	if message == "" {
+		message = "Uploads are paused for maintenance"
+	}
+	w.Header().Set("Retry-After", "300")
+	http.Error(w, message, http.StatusServiceUnavailable)
+	return true
+}
+
+// Seafile token used for API requests.
+func currentToken() string {
+	token_mutex.RLock()
+	defer token_mutex.RUnlock()
+
+	return token
+}
+
+// Logs in with SEAFILE_USERNAME when failed_token was rejected by Seafile.
+// Requests failed together wait for one login instead of logging in each.
+func reloginToken(failed_token string) error {
+	relogin_mutex.Lock()
+	defer relogin_mutex.Unlock()
+
+	if currentToken() != failed_token {
+		return nil
+	}
+
+	new_token, err := RequestToken(seafile_username, seafile_password)
+	if err != nil {
+		log.Println("Cannot log in again as", seafile_username, ">", err)
+		return err
+	}
+
+	token_mutex.Lock()
+	token = new_token
+	token_mutex.Unlock()
+
+	log.Println("Seafile token expired, logged in again as", seafile_username)
+	Audit(AuditEvent{Event: "token_relogin", Details: map[string]string{"username": seafile_username}})
+	return nil
+}
+
+// GET /admin/config returns effective configuration with secrets masked.
+func adminConfigHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println(r.Method, r.RequestURI)
+
+	if !adminAuthorized(r, ROLE_VIEWER) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, ConfigAudit())
+}
+
+// POST /admin/cache/purge drops cached files, links and missing paths.
+func adminCachePurgeHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println(r.Method, r.RequestURI)
+
+	if !adminAuthorized(r, ROLE_OPERATOR) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if download_cache != nil {
+		download_cache.Purge()
+	}
+	if memory_cache != nil {
+		memory_cache.Purge()
+	}
+
+	download_links_mutex.Lock()
+	download_links = make(map[string]downloadLink)
+	download_links_mutex.Unlock()
+
+	missing_paths_mutex.Lock()
+	missing_paths = make(map[string]time.Time)
+	missing_paths_mutex.Unlock()
+
+	log.Println("Caches purged")
+	writeJSON(w, http.StatusOK, map[string]bool{"purged": true})
+}
+
+// GET /admin/maintenance shows maintenance mode,
+// POST /admin/maintenance?enabled=true&message=... switches it.
+func adminMaintenanceHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println(r.Method, r.RequestURI)
+
+	role := ROLE_VIEWER
+	if r.Method != "GET" {
+		role = ROLE_OPERATOR
+	}
+
+	if !adminAuthorized(r, role) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+	case "POST":
+		enabled, err := strconv.ParseBool(r.FormValue("enabled"))
+		if err != nil {
+			http.Error(w, "enabled should be true or false", http.StatusBadRequest)
+			return
+		}
+
+		maintenance_mutex.Lock()
+		maintenance_mode = enabled
+		maintenance_message = r.FormValue("message")
+		maintenance_mutex.Unlock()
+
+		log.Println("Maintenance mode:", enabled)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	enabled, message := inMaintenance()
+	writeJSON(w, http.StatusOK, map[string]interface{}{"enabled": enabled, "message": message})
+}
+
+// POST /admin/token replaces Seafile token with the given one (token=...)
+// or with a new one issued for username and password. The new token is
+// checked before it is used and lives in memory only: update SEAFILE_TOKEN
+// before the next restart.
+func adminTokenHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println(r.Method, r.RequestURI)
+
+	if !adminAuthorized(r, ROLE_ADMIN) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	new_token := r.FormValue("token")
+	if new_token == "" {
+		username, password := r.FormValue("username"), r.FormValue("password")
+		if username == "" || password == "" {
+			http.Error(w, "Pass token or username and password", http.StatusBadRequest)
+			return
+		}
+
+		var err error
+		if new_token, err = RequestToken(username, password); err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+	}
+
+	if err := PingAuthWith(new_token); err != nil {
+		http.Error(w, "New token doesn't work: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	token_mutex.Lock()
+	token = new_token
+	token_mutex.Unlock()
+
+	log.Println("Seafile token rotated")
+	writeJSON(w, http.StatusOK, map[string]bool{"rotated": true})
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAdminAuthorizedWithoutKeys(t *testing.T) {
+	saved_keys, saved_local := admin_keys, admin_local
+	defer func() { admin_keys, admin_local = saved_keys, saved_local }()
+	admin_keys = map[string]AdminKey{}
+
+	r := httptest.NewRequest("GET", "/admin/config", nil)
+	r.RemoteAddr = "127.0.0.1:1234"
+
+	admin_local = false
+	if adminAuthorized(r, ROLE_VIEWER) {
+		t.Error("Local client is allowed without SEAFILE_ADMIN_LOCAL")
+	}
+
+	admin_local = true
+	if !adminAuthorized(r, ROLE_ADMIN) {
+		t.Error("Local client is refused with SEAFILE_ADMIN_LOCAL")
+	}
+
+	r.RemoteAddr = "203.0.113.5:1234"
+	if adminAuthorized(r, ROLE_VIEWER) {
+		t.Error("Remote client is allowed without admin keys")
+	}
+}
+
+func TestAdminAuthorizedRoles(t *testing.T) {
+	saved := admin_keys
+	defer func() { admin_keys = saved }()
+	admin_keys = map[string]AdminKey{"secret": {Name: "audit", Role: ROLE_VIEWER}}
+
+	r := httptest.NewRequest("GET", "/admin/config", nil)
+	r.Header.Set("X-Admin-Key", "secret")
+
+	if !adminAuthorized(r, ROLE_VIEWER) {
+		t.Error("Viewer key is refused for viewer endpoint")
+	}
+	if adminAuthorized(r, ROLE_OPERATOR) {
+		t.Error("Viewer key is allowed for operator endpoint")
+	}
+}
@@ -0,0 +1,550 @@
+package main
+
+import (
+	"fmt"
+	"github.com/lazureykis/seafile-uploader/pkg/seafile"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Folder entry with custom metadata from the local index.
+type DirectoryEntry struct {
+	FileSpec
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// Folder listing returned by /api/v1/dir.
+type DirectoryListing struct {
+	Path    string           `json:"path"`
+	Entries []DirectoryEntry `json:"entries"`
+}
+
+// Metadata filters from query: meta.owner=alice&meta.project=x
+func metadataFilters(query url.Values) map[string]string {
+	filters := make(map[string]string)
+	for key, values := range query {
+		if strings.HasPrefix(key, "meta.") && len(values) > 0 {
+			filters[strings.TrimPrefix(key, "meta.")] = values[0]
+		}
+	}
+	return filters
+}
+
+// GET /api/v1/dir?p=/foo/ returns entries of the folder as JSON.
+// Files may be filtered by metadata: &meta.owner=alice
+// POST /api/v1/dir?p=/foo/bar/ creates the folder, see apiMkdir.
+func apiDirHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println(r.Method, r.RequestURI)
+
+	switch r.Method {
+	case "GET":
+		apiListDir(w, r)
+	case "POST":
+		apiMkdir(w, r)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func apiListDir(w http.ResponseWriter, r *http.Request) {
+	folder := r.FormValue("p")
+	if folder == "" {
+		folder = "/"
+	}
+
+	if !strings.HasSuffix(folder, "/") {
+		folder += "/"
+	}
+
+	if !downloadAuthorized(r, folder) {
+		writeAPIError(w, http.StatusForbidden, "Forbidden")
+		return
+	}
+
+	err, entries := ListDirectoryEntries(folder)
+	if isMissingPathError(err) {
+		writeAPIError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	filters := metadataFilters(r.URL.Query())
+
+	listing := DirectoryListing{Path: folder, Entries: []DirectoryEntry{}}
+	for _, entry := range entries {
+		metadata := metadata_index.Get(folder + entry.Name)
+		if len(filters) > 0 && (entry.Type != "file" || !metadataMatches(metadata, filters)) {
+			continue
+		}
+
+		listing.Entries = append(listing.Entries, DirectoryEntry{FileSpec: entry, Metadata: metadata})
+	}
+
+	writeAPI(w, http.StatusOK, listing)
+}
+
+// Creates the folder along with missing intermediate ones, like mkdir -p.
+// Existing folder is fine unless parents=false is given, then it is 409 Conflict
+// and missing parent folder is 404.
+func apiMkdir(w http.ResponseWriter, r *http.Request) {
+	if !apiPathsAuthorized(r, r.FormValue("p")) {
+		writeAPIError(w, http.StatusForbidden, "Forbidden")
+		return
+	}
+
+	if refuseInMaintenance(w) {
+		return
+	}
+
+	folder := r.FormValue("p")
+	if !strings.HasPrefix(folder, "/") || folder == "/" {
+		writeAPIError(w, http.StatusBadRequest, "p should be a folder path")
+		return
+	}
+
+	if !strings.HasSuffix(folder, "/") {
+		folder += "/"
+	}
+
+	parents := true
+	if value := r.FormValue("parents"); value != "" {
+		var err error
+		if parents, err = strconv.ParseBool(value); err != nil {
+			writeAPIError(w, http.StatusBadRequest, "Invalid parents: "+value)
+			return
+		}
+	}
+
+	err, _, exists := IsDirectoryExist(folder)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if exists {
+		if !parents {
+			writeAPIError(w, http.StatusConflict, "Folder already exists: "+folder)
+			return
+		}
+
+		writeAPI(w, http.StatusOK, DirectoryListing{Path: folder, Entries: []DirectoryEntry{}})
+		return
+	}
+
+	if !parents {
+		trimmed := strings.TrimSuffix(folder, "/")
+		parent := trimmed[:strings.LastIndex(trimmed, "/")+1]
+
+		err, _, parent_exists := IsDirectoryExist(parent)
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if !parent_exists {
+			writeAPIError(w, http.StatusNotFound, "Parent folder doesn't exist: "+parent)
+			return
+		}
+	}
+
+	if err := CreateDirectory(folder); err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeAPI(w, http.StatusCreated, DirectoryListing{Path: folder, Entries: []DirectoryEntry{}})
+}
+
+// GET /api/v1/stat?p=/foo/file.jpg (also /api/v1/file/detail) returns file details
+// with its metadata. File id is the ETag, so If-None-Match answers 304 for unchanged
+// files and HEAD checks existence without the body.
+func apiStatHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println(r.Method, r.RequestURI)
+
+	if r.Method != "GET" && r.Method != "HEAD" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	path := r.FormValue("p")
+	if !strings.HasPrefix(path, "/") || strings.HasSuffix(path, "/") {
+		writeAPIError(w, http.StatusBadRequest, "p should be a file path")
+		return
+	}
+
+	if !downloadAuthorized(r, path) {
+		writeAPIError(w, http.StatusForbidden, "Forbidden")
+		return
+	}
+
+	spec, err := GetFileDetail(path)
+	if isMissingPathError(err) {
+		writeAPIError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("ETag", `"`+spec.Id+`"`)
+	w.Header().Set("Last-Modified", spec.MTime.Time().UTC().Format(http.TimeFormat))
+
+	if if_none_match := r.Header.Get("If-None-Match"); if_none_match != "" && etagListContains(if_none_match, spec.Id) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	if r.Method == "HEAD" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	writeAPI(w, http.StatusOK, DirectoryEntry{FileSpec: spec, Metadata: metadata_index.Get(path)})
+}
+
+// Whether request may change files or see beyond the proxied paths through /api/v1:
+// proxy API key. When no keys are configured they are refused, unless
+// SEAFILE_API_LOCAL allows local clients.
+func apiKeyAuthorized(r *http.Request) bool {
+	if len(api_keys) == 0 {
+		return api_local && isLoopbackRequest(r)
+	}
+
+	_, ok := AuthenticateAPIKey(r)
+	return ok
+}
+
+// DELETE /api/v1/file?p=/foo/bar.txt removes the file.
+// With If-Match: <id> the file is removed only if it wasn't changed meanwhile.
+func apiFileHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println(r.Method, r.RequestURI)
+
+	if r.Method != "DELETE" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !apiPathsAuthorized(r, r.FormValue("p")) {
+		writeAPIError(w, http.StatusForbidden, "Forbidden")
+		return
+	}
+
+	if refuseInMaintenance(w) {
+		return
+	}
+
+	path := r.FormValue("p")
+	if !strings.HasPrefix(path, "/") || strings.HasSuffix(path, "/") {
+		writeAPIError(w, http.StatusBadRequest, "p should be a file path")
+		return
+	}
+
+	if refuseLocked(w, r, path) {
+		return
+	}
+
+	spec, err := GetFileDetail(path)
+	if isMissingPathError(err) {
+		writeAPIError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if if_match := r.Header.Get("If-Match"); if_match != "" && if_match != "*" && !etagListContains(if_match, spec.Id) {
+		writeAPIError(w, http.StatusPreconditionFailed, "File id doesn't match")
+		return
+	}
+
+	if err := deleteFileVersion(path, spec); err != nil {
+		writeAPIError(w, seafileErrorHTTPStatus(err, http.StatusInternalServerError), err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Deletes the file whose current version is spec, along with what the proxy keeps about it.
+func deleteFileVersion(path string, spec FileSpec) error {
+	if err := DeleteFile(path); err != nil {
+		return err
+	}
+
+	forgetDownloadLink(path, spec.Id)
+	metadata_index.Delete(path)
+	releaseFileLock(path)
+	return nil
+}
+
+// POST /api/v1/file/move with src=/foo/a.txt&dst=/bar/b.txt moves or renames the file.
+// Existing dst is never replaced. If-Match: <id> is checked against src.
+func apiMoveHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println(r.Method, r.RequestURI)
+
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !apiPathsAuthorized(r, r.FormValue("src"), r.FormValue("dst")) {
+		writeAPIError(w, http.StatusForbidden, "Forbidden")
+		return
+	}
+
+	if refuseInMaintenance(w) {
+		return
+	}
+
+	src, dst := r.FormValue("src"), r.FormValue("dst")
+	for _, path := range []string{src, dst} {
+		if !strings.HasPrefix(path, "/") || strings.HasSuffix(path, "/") {
+			writeAPIError(w, http.StatusBadRequest, "src and dst should be file paths")
+			return
+		}
+	}
+
+	if src == dst {
+		writeAPIError(w, http.StatusBadRequest, "src and dst are the same")
+		return
+	}
+
+	if refuseLocked(w, r, src) {
+		return
+	}
+
+	spec, err := GetFileDetail(src)
+	if isMissingPathError(err) {
+		writeAPIError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if if_match := r.Header.Get("If-Match"); if_match != "" && if_match != "*" && !etagListContains(if_match, spec.Id) {
+		writeAPIError(w, http.StatusPreconditionFailed, "File id doesn't match")
+		return
+	}
+
+	if err := moveFileVersion(src, dst, spec); err != nil {
+		writeAPIError(w, seafileErrorHTTPStatus(err, http.StatusInternalServerError), err.Error())
+		return
+	}
+
+	moved, err := GetFileDetail(dst)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeAPI(w, http.StatusOK, DirectoryEntry{FileSpec: moved, Metadata: metadata_index.Get(dst)})
+}
+
+// Moves the file whose current version is spec, along with what the proxy keeps about it.
+// Seafile renames on collision instead of failing, so occupied names are refused
+// with seafile.ErrFileExists: the destination itself and, for moves, the original
+// name in the destination folder.
+func moveFileVersion(src, dst string, spec FileSpec) error {
+	occupied := []string{dst}
+	src_dir, dst_dir := src[:strings.LastIndex(src, "/")+1], dst[:strings.LastIndex(dst, "/")+1]
+	if src_dir != dst_dir && dst != dst_dir+spec.Name {
+		occupied = append(occupied, dst_dir+spec.Name)
+	}
+
+	for _, path := range occupied {
+		_, err := GetFileDetail(path)
+		if err == nil {
+			return fmt.Errorf("%w: %s", seafile.ErrFileExists, path)
+		}
+		if !isMissingPathError(err) {
+			return err
+		}
+	}
+
+	if err := MoveFile(src, dst); err != nil {
+		return err
+	}
+
+	forgetDownloadLink(src, spec.Id)
+	moveFileLock(src, dst)
+	metadata_index.Rename(src, dst)
+	return nil
+}
+
+// POST /api/v1/file/copy with src=/foo/a.txt (or folder /foo/dir/) and dst=/bar/
+// copies it into dst folder keeping the name. Folders may be routed to different libraries.
+func apiCopyHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println(r.Method, r.RequestURI)
+
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !apiPathsAuthorized(r, r.FormValue("src"), r.FormValue("dst")) {
+		writeAPIError(w, http.StatusForbidden, "Forbidden")
+		return
+	}
+
+	if refuseInMaintenance(w) {
+		return
+	}
+
+	src, dst := r.FormValue("src"), r.FormValue("dst")
+	if !strings.HasPrefix(src, "/") || src == "/" || !strings.HasPrefix(dst, "/") || !strings.HasSuffix(dst, "/") {
+		writeAPIError(w, http.StatusBadRequest, "src should be a file or folder path, dst a folder path")
+		return
+	}
+
+	trimmed := strings.TrimSuffix(src, "/")
+	src_dir, name := trimmed[:strings.LastIndex(trimmed, "/")+1], trimmed[strings.LastIndex(trimmed, "/")+1:]
+
+	if strings.HasSuffix(src, "/") && strings.HasPrefix(dst, src) {
+		writeAPIError(w, http.StatusBadRequest, "Cannot copy folder into itself")
+		return
+	}
+
+	var err error
+	if strings.HasSuffix(src, "/") {
+		err, _ = ListDirectoryEntries(src)
+	} else {
+		_, err = GetFileDetail(src)
+	}
+	if isMissingPathError(err) {
+		writeAPIError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Seafile renames on collision instead of failing, so occupied names are refused here.
+	err, entries := ListDirectoryEntries(dst)
+	if isMissingPathError(err) {
+		writeAPIError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	for _, entry := range entries {
+		if entry.Name == name {
+			writeAPIError(w, http.StatusConflict, "Already exists: "+dst+name)
+			return
+		}
+	}
+
+	if err := CopyFile(src_dir, name, dst); err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if strings.HasSuffix(src, "/") {
+		metadata_index.Copy(src, dst+name+"/")
+	} else {
+		metadata_index.Copy(src, dst+name)
+	}
+
+	err, entries = ListDirectoryEntries(dst)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	for _, entry := range entries {
+		if entry.Name == name {
+			writeAPI(w, http.StatusOK, DirectoryEntry{FileSpec: entry, Metadata: metadata_index.Get(dst + name)})
+			return
+		}
+	}
+
+	writeAPIError(w, http.StatusInternalServerError, "Copy is missing: "+dst+name)
+}
+
+// Library listed by /api/v1/repos. Prefix is the proxy path it is mounted at, if any.
+type RepoInfo struct {
+	Repo
+	Prefix  string `json:"prefix,omitempty"`
+	Default bool   `json:"default"`
+}
+
+// GET /api/v1/repos lists libraries visible to the Seafile token.
+// POST /api/v1/repos with name, optional desc and password creates library, see apiCreateRepo.
+func apiReposHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println(r.Method, r.RequestURI)
+
+	switch r.Method {
+	case "GET":
+		apiListRepos(w, r)
+	case "POST":
+		apiCreateRepo(w, r)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func apiListRepos(w http.ResponseWriter, r *http.Request) {
+	if !apiKeyAuthorized(r) {
+		writeAPIError(w, http.StatusForbidden, "Forbidden")
+		return
+	}
+
+	repos, err := ListRepos()
+	if err != nil {
+		writeAPIError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	infos := []RepoInfo{}
+	for _, repo := range repos {
+		info := RepoInfo{Repo: repo, Default: repo.Id == default_repo}
+		if prefix, ok := ProxyPath(repo.Id, "/"); ok {
+			info.Prefix = prefix
+		}
+		infos = append(infos, info)
+	}
+
+	writeAPI(w, http.StatusOK, infos)
+}
+
+// Creating libraries changes the account rather than files, so it needs admin key.
+// Password makes the library encrypted, it can't be changed later.
+func apiCreateRepo(w http.ResponseWriter, r *http.Request) {
+	if !adminAuthorized(r, ROLE_ADMIN) {
+		writeAPIError(w, http.StatusForbidden, "Forbidden")
+		return
+	}
+
+	if refuseInMaintenance(w) {
+		return
+	}
+
+	name := strings.TrimSpace(r.FormValue("name"))
+	if name == "" || strings.ContainsAny(name, "/\\") {
+		writeAPIError(w, http.StatusBadRequest, "name is required and can't contain slashes")
+		return
+	}
+
+	repo, err := CreateRepo(name, r.FormValue("desc"), r.FormValue("password"))
+	if err != nil {
+		writeAPIError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	Audit(AuditEvent{Event: "repo_created", IP: sourceIP(r), Path: name,
+		Details: map[string]string{"repo_id": repo.Id, "encrypted": strconv.FormatBool(repo.Encrypted)}})
+
+	writeAPI(w, http.StatusCreated, RepoInfo{Repo: repo})
+}
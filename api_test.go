@@ -0,0 +1,46 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAPIKeyAuthorizedWithoutKeys(t *testing.T) {
+	saved_keys, saved_local := api_keys, api_local
+	defer func() { api_keys, api_local = saved_keys, saved_local }()
+	api_keys = map[string]string{}
+
+	r := httptest.NewRequest("DELETE", "/api/v1/file?p=/a.txt", nil)
+	r.RemoteAddr = "127.0.0.1:1234"
+
+	api_local = false
+	if apiKeyAuthorized(r) {
+		t.Error("Local client is allowed without SEAFILE_API_LOCAL")
+	}
+
+	api_local = true
+	if !apiKeyAuthorized(r) {
+		t.Error("Local client is refused with SEAFILE_API_LOCAL")
+	}
+
+	r.RemoteAddr = "203.0.113.5:1234"
+	if apiKeyAuthorized(r) {
+		t.Error("Remote client is allowed without API keys")
+	}
+}
+
+func TestSignRefusedWithoutKeys(t *testing.T) {
+	saved_keys, saved_local := api_keys, api_local
+	defer func() { api_keys, api_local = saved_keys, saved_local }()
+	api_keys = map[string]string{}
+	api_local = false
+
+	r := httptest.NewRequest("POST", "/sign?p=/a.txt", nil)
+	r.RemoteAddr = "127.0.0.1:1234"
+	w := httptest.NewRecorder()
+	signHandler(w, r)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Local client without keys minted link: %d", w.Code)
+	}
+}
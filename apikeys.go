@@ -0,0 +1,67 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// Proxy API keys: secret -> key name.
+// Key names are used in logs, folder templates and per-key settings, secrets never are.
+var api_keys = make(map[string]string)
+
+// Parses SEAFILE_PROXY_API_KEYS value: "name1:secret1,name2:secret2".
+func ParseAPIKeys(spec string) (map[string]string, error) {
+	keys := make(map[string]string)
+
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.SplitN(entry, ":", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, errors.New("Invalid API key entry, expected name:secret")
+		}
+
+		if strings.ContainsAny(parts[0], "/\\{}") {
+			return nil, errors.New("Invalid API key name: " + parts[0])
+		}
+
+		keys[parts[1]] = parts[0]
+	}
+
+	return keys, nil
+}
+
+// Returns API key secret passed in X-Api-Key header or api_key query parameter.
+func requestAPIKey(r *http.Request) string {
+	if key := r.Header.Get("X-Api-Key"); key != "" {
+		return key
+	}
+
+	return r.URL.Query().Get("api_key")
+}
+
+// Authenticates request by API key and returns the key name.
+// When no API keys are configured every request is allowed anonymously.
+func AuthenticateAPIKey(r *http.Request) (name string, ok bool) {
+	if len(api_keys) == 0 {
+		return "", true
+	}
+
+	secret := requestAPIKey(r)
+	if secret == "" {
+		return "", false
+	}
+
+	for key_secret, key_name := range api_keys {
+		if subtle.ConstantTimeCompare([]byte(secret), []byte(key_secret)) == 1 {
+			return key_name, true
+		}
+	}
+
+	return "", false
+}
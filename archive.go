@@ -0,0 +1,243 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Calls fn for every file under folder, recursively.
+// relative is the file path relative to folder.
+func walkFolder(folder, relative string, fn func(file_path, relative string, spec FileSpec) error) error {
+	err, entries := ListDirectoryEntries(folder)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		switch entry.Type {
+		case "dir":
+			if err := walkFolder(folder+entry.Name+"/", relative+entry.Name+"/", fn); err != nil {
+				return err
+			}
+		case "file":
+			if err := fn(folder+entry.Name, relative+entry.Name, entry); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Opens file content from the download cache or Seafile file server.
+func openRemoteFile(file_path string, spec FileSpec) (io.ReadCloser, error) {
+	if file, ok := cachedFile(file_path, spec.Id); ok {
+		return file, nil
+	}
+
+	link, err := CachedDownloadLink(file_path, spec.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, _, err := fileServerGet(link, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, errors.New("Cannot download " + file_path + ": " + resp.Status)
+	}
+
+	return resp.Body, nil
+}
+
+// Folder path from /getdir/... request and archive name for it.
+func archiveFolder(r *http.Request) (folder, name string) {
+	folder = strings.TrimPrefix(r.URL.Path, "/getdir")
+	if !strings.HasSuffix(folder, "/") {
+		folder += "/"
+	}
+
+	name = path.Base(folder)
+	if name == "/" || name == "." {
+		name = "archive"
+	}
+
+	return folder, name
+}
+
+// Streams zip archive of the folder. Headers are already sent,
+// so errors can only truncate the archive.
+func writeZipArchive(w io.Writer, folder string) error {
+	zip_writer := zip.NewWriter(w)
+
+	err := walkFolder(folder, "", func(file_path, relative string, spec FileSpec) error {
+		body, err := openRemoteFile(file_path, spec)
+		if err != nil {
+			return err
+		}
+		defer body.Close()
+
+		header := &zip.FileHeader{Name: relative, Method: zip.Deflate}
+		header.Modified = spec.MTime.Time()
+
+		entry, err := zip_writer.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+
+		_, err = io.Copy(entry, body)
+		return err
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return zip_writer.Close()
+}
+
+// Archive formats of /getdir/ with their content types.
+var archive_formats = map[string]string{
+	"zip":     "application/zip",
+	"tar.gz":  "application/gzip",
+	"tar.zst": "application/zstd",
+}
+
+var archive_format_aliases = map[string]string{
+	"tgz":  "tar.gz",
+	"zst":  "tar.zst",
+	"zstd": "tar.zst",
+	"tzst": "tar.zst",
+}
+
+// Streams gzipped tarball of the folder.
+func writeTarGzArchive(w io.Writer, folder string) error {
+	return writeTarArchive(gzip.NewWriter(w), folder)
+}
+
+// Streams zstd compressed tarball of the folder, much faster than zip for large text files.
+func writeTarZstArchive(w io.Writer, folder string) error {
+	zstd_writer, err := zstd.NewWriter(w)
+	if err != nil {
+		return err
+	}
+	return writeTarArchive(zstd_writer, folder)
+}
+
+// Streams tarball of the folder through compressor, which is closed at the end.
+func writeTarArchive(compressor io.WriteCloser, folder string) error {
+	tar_writer := tar.NewWriter(compressor)
+
+	err := walkFolder(folder, "", func(file_path, relative string, spec FileSpec) error {
+		body, err := openRemoteFile(file_path, spec)
+		if err != nil {
+			return err
+		}
+		defer body.Close()
+
+		err = tar_writer.WriteHeader(&tar.Header{
+			Name:    relative,
+			Mode:    0644,
+			Size:    spec.Size,
+			ModTime: spec.MTime.Time(),
+		})
+		if err != nil {
+			return err
+		}
+
+		// Size in the header is final, the body must match it.
+		_, err = io.CopyN(tar_writer, body, spec.Size)
+		return err
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if err := tar_writer.Close(); err != nil {
+		return err
+	}
+	return compressor.Close()
+}
+
+// GET /getdir/folder/ streams zip archive of the folder,
+// GET /getdir/folder/?format=tar.gz streams gzipped tarball, format=tar.zst zstd one.
+// OPTIONS lists the formats.
+func archiveHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println(r.Method, r.RequestURI)
+
+	if r.Method == "OPTIONS" {
+		formats := []string{}
+		for format := range archive_formats {
+			formats = append(formats, format)
+		}
+		sort.Strings(formats)
+
+		w.Header().Set("Allow", "GET, OPTIONS")
+		writeJSON(w, http.StatusOK, map[string]interface{}{"formats": formats})
+		return
+	}
+
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	folder, name := archiveFolder(r)
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "zip"
+	}
+	if alias, ok := archive_format_aliases[format]; ok {
+		format = alias
+	}
+	content_type, ok := archive_formats[format]
+	if !ok {
+		http.Error(w, "format should be zip, tar.gz or tar.zst", http.StatusBadRequest)
+		return
+	}
+
+	if !downloadAuthorized(r, folder) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	err, _, exists := IsDirectoryExist(folder)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, PATH_DOESNT_EXIST_MSG, http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Disposition", contentDisposition("attachment", name+"."+format))
+	w.Header().Set("Content-Type", content_type)
+
+	switch format {
+	case "zip":
+		err = writeZipArchive(w, folder)
+	case "tar.gz":
+		err = writeTarGzArchive(w, folder)
+	case "tar.zst":
+		err = writeTarZstArchive(w, folder)
+	}
+
+	if err != nil {
+		log.Println("Archive", folder, "failed:", err)
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestArchiveFormatsAreAdvertised(t *testing.T) {
+	w := httptest.NewRecorder()
+	archiveHandler(w, httptest.NewRequest("OPTIONS", "/getdir/docs/", nil))
+
+	var response struct {
+		Formats []string `json:"formats"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if !stringInSlice("tar.zst", response.Formats) || !stringInSlice("zip", response.Formats) {
+		t.Errorf("Formats %v miss zip or tar.zst", response.Formats)
+	}
+}
+
+func TestArchiveRefusesUnknownFormat(t *testing.T) {
+	w := httptest.NewRecorder()
+	archiveHandler(w, httptest.NewRequest("GET", "/getdir/docs/?format=rar", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Unknown format answered %d", w.Code)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Security relevant events, appended as JSON lines to SEAFILE_AUDIT_LOG
+// when configured and always written to the log.
+type AuditEvent struct {
+	Time    string            `json:"time"`
+	Event   string            `json:"event"`
+	IP      string            `json:"ip,omitempty"`
+	APIKey  string            `json:"api_key,omitempty"`
+	Path    string            `json:"path,omitempty"`
+	Details map[string]string `json:"details,omitempty"`
+}
+
+var (
+	audit_log       string
+	audit_log_mutex sync.Mutex
+)
+
+func Audit(event AuditEvent) {
+	event.Time = time.Now().UTC().Format(time.RFC3339)
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.Println("Audit:", err)
+		return
+	}
+
+	log.Println("Audit:", string(data))
+
+	if audit_log == "" {
+		return
+	}
+
+	audit_log_mutex.Lock()
+	defer audit_log_mutex.Unlock()
+
+	file, err := os.OpenFile(audit_log, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		log.Println("Audit:", err)
+		return
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		log.Println("Audit:", err)
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/lazureykis/seafile-uploader/pkg/seafile"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+const MAX_BATCH_PATHS = 1000
+
+// Outcome of one path of a batch: 204 when it was deleted.
+type BatchResult struct {
+	Path   string `json:"path"`
+	Status int    `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Deletes files of the folder. With Seafile batch operations they are deleted
+// in one request, otherwise one by one. Returns errors of files not deleted.
+func DeleteFiles(folder string, names []string) map[string]error {
+	errs := make(map[string]error)
+
+	client, ok := storage.(*seafile.Client)
+	if !ok || !featureSupported("batch_ops") || len(names) == 1 {
+		for _, name := range names {
+			if err := DeleteFile(folder + name); err != nil {
+				errs[name] = err
+			}
+		}
+		return errs
+	}
+
+	repo_id, repo_path := RouteRepo(folder)
+
+	log.Println("Deleting", len(names), "files from", folder)
+
+	if err := client.DeleteFiles(repo_id, repo_path, names); err != nil {
+		for _, name := range names {
+			errs[name] = fmt.Errorf("Cannot delete %s > %w", folder+name, err)
+		}
+		return errs
+	}
+
+	for _, name := range names {
+		publishChange(ChangeEvent{Type: "deleted", Path: folder + name})
+	}
+
+	return errs
+}
+
+// Paths of the batch: JSON array body, {"paths": [...]} or paths=...&paths=...
+func batchPaths(r *http.Request) ([]string, error) {
+	var paths []string
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		if value := r.FormValue("paths"); value != "" {
+			return paths, json.Unmarshal([]byte(value), &paths)
+		}
+		return paths, json.NewDecoder(r.Body).Decode(&paths)
+	}
+
+	if err := r.ParseForm(); err != nil {
+		return nil, err
+	}
+	return r.Form["paths"], nil
+}
+
+// POST /api/v1/files/delete with ["/foo/a.txt", "/bar/b.txt"] deletes the files
+// and returns result of every path. Files of the same folder are deleted together.
+func apiBatchDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println(r.Method, r.RequestURI)
+
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	// User keys are checked against the paths once they are read.
+	_, is_user := authenticateUser(r)
+	if !is_user && !apiKeyAuthorized(r) {
+		writeAPIError(w, http.StatusForbidden, "Forbidden")
+		return
+	}
+
+	if refuseInMaintenance(w) {
+		return
+	}
+
+	paths, err := batchPaths(r)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "paths should be a list of file paths")
+		return
+	}
+	if len(paths) == 0 || len(paths) > MAX_BATCH_PATHS {
+		writeAPIError(w, http.StatusBadRequest, fmt.Sprintf("Between 1 and %d paths are accepted", MAX_BATCH_PATHS))
+		return
+	}
+	if is_user && !apiPathsAuthorized(r, paths...) {
+		writeAPIError(w, http.StatusForbidden, "Forbidden")
+		return
+	}
+
+	results := make(map[string]*BatchResult)
+	fail := func(path string, status int, err error) {
+		results[path] = &BatchResult{Path: path, Status: status, Error: err.Error()}
+	}
+
+	// Existing files of every folder, so missing ones are reported rather than ignored.
+	folders := make(map[string][]string)
+	for _, path := range paths {
+		if _, seen := results[path]; seen {
+			continue
+		}
+		results[path] = &BatchResult{Path: path, Status: http.StatusNoContent}
+
+		if !strings.HasPrefix(path, "/") || strings.HasSuffix(path, "/") {
+			fail(path, http.StatusBadRequest, errors.New("Should be a file path"))
+			continue
+		}
+		if isHeld(path) {
+			fail(path, http.StatusLocked, ErrPathHeld)
+			continue
+		}
+		if lock, locked := lockedByOther(r, path); locked {
+			fail(path, http.StatusLocked, errors.New("File is locked by "+lock.Owner))
+			continue
+		}
+
+		folder := path[:strings.LastIndex(path, "/")+1]
+		folders[folder] = append(folders[folder], path[len(folder):])
+	}
+
+	deleted := 0
+	for folder, names := range folders {
+		err, entries := ListDirectoryEntries(folder)
+		if err != nil {
+			for _, name := range names {
+				fail(folder+name, seafileErrorHTTPStatus(err, http.StatusBadGateway), err)
+			}
+			continue
+		}
+
+		ids := make(map[string]string)
+		for _, entry := range entries {
+			if entry.Type == "file" {
+				ids[entry.Name] = entry.Id
+			}
+		}
+
+		var existing []string
+		for _, name := range names {
+			if _, ok := ids[name]; ok {
+				existing = append(existing, name)
+			} else {
+				fail(folder+name, http.StatusNotFound, seafile.ErrPathNotExist)
+			}
+		}
+		if len(existing) == 0 {
+			continue
+		}
+
+		errs := DeleteFiles(folder, existing)
+		for _, name := range existing {
+			if err, failed := errs[name]; failed {
+				fail(folder+name, seafileErrorHTTPStatus(err, http.StatusBadGateway), err)
+				continue
+			}
+
+			forgetDownloadLink(folder+name, ids[name])
+			metadata_index.Delete(folder + name)
+			releaseFileLock(folder + name)
+			deleted++
+		}
+	}
+
+	response := struct {
+		Deleted int            `json:"deleted"`
+		Results []*BatchResult `json:"results"`
+	}{Deleted: deleted}
+	for _, result := range results {
+		response.Results = append(response.Results, result)
+	}
+	sort.Slice(response.Results, func(i, j int) bool {
+		return response.Results[i].Path < response.Results[j].Path
+	})
+
+	writeAPI(w, http.StatusOK, response)
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+type BrowseCrumb struct {
+	Name string
+	URL  string
+}
+
+type BrowseEntry struct {
+	Name     string
+	URL      string
+	IsDir    bool
+	Size     string
+	Modified string
+	Version  string // Seafile file id, sent back by edit forms
+}
+
+type BrowsePage struct {
+	Path     string
+	Parent   string
+	Crumbs   []BrowseCrumb
+	Entries  []BrowseEntry
+	Editable bool
+}
+
+func escapedPath(path string) string {
+	u := &url.URL{Path: path}
+	return u.EscapedPath()
+}
+
+// Size with binary unit: 512 B, 1.5 KB, 20.0 MB.
+func formatByteSize(size int64) string {
+	if size < 1024 {
+		return fmt.Sprintf("%d B", size)
+	}
+
+	value := float64(size) / 1024
+	for _, unit := range []string{"KB", "MB", "GB"} {
+		if value < 1024 {
+			return fmt.Sprintf("%.1f %s", value, unit)
+		}
+		value /= 1024
+	}
+
+	return fmt.Sprintf("%.1f TB", value)
+}
+
+// Link to the file through /get/, signed when downloads are private.
+func browseFileURL(path string) string {
+	if private_downloads && signing_key != "" {
+		return signedDownloadPath(path, time.Now().Add(callback_link_ttl).Unix())
+	}
+
+	return escapedPath("/get" + path)
+}
+
+// GET /browse/folder/ renders HTML listing of the folder.
+// POST /browse/folder/ with action=delete or action=move&dst=new.txt changes
+// file name of the folder, see browseEdit.
+func browseHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println(r.Method, r.RequestURI)
+
+	if r.Method != "GET" && r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	folder := strings.TrimPrefix(r.URL.Path, "/browse")
+	if !strings.HasSuffix(folder, "/") {
+		http.Redirect(w, r, escapedPath("/browse"+folder+"/"), http.StatusMovedPermanently)
+		return
+	}
+
+	if r.Method == "POST" {
+		browseEdit(w, r, folder)
+		return
+	}
+
+	if !downloadAuthorized(r, folder) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	err, entries := ListDirectoryEntries(folder)
+	if isMissingPathError(err) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	page := BrowsePage{Path: folder, Editable: apiPathsAuthorized(r, folder)}
+
+	page.Crumbs = append(page.Crumbs, BrowseCrumb{Name: "/", URL: "/browse/"})
+	crumb_path := "/"
+	for _, name := range strings.Split(strings.Trim(folder, "/"), "/") {
+		if name == "" {
+			continue
+		}
+		crumb_path += name + "/"
+		page.Crumbs = append(page.Crumbs, BrowseCrumb{Name: name + "/", URL: escapedPath("/browse" + crumb_path)})
+	}
+
+	if len(page.Crumbs) > 1 {
+		page.Parent = page.Crumbs[len(page.Crumbs)-2].URL
+	}
+
+	// Folders first, then files, both by name.
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Type != entries[j].Type {
+			return entries[i].Type == "dir"
+		}
+		return entries[i].Name < entries[j].Name
+	})
+
+	for _, entry := range entries {
+		// Metadata sidecars are shown by /meta/.
+		if strings.HasSuffix(entry.Name, METADATA_SUFFIX) {
+			continue
+		}
+
+		item := BrowseEntry{
+			Name:     entry.Name,
+			IsDir:    entry.Type == "dir",
+			Modified: entry.MTime.Time().UTC().Format("2006-01-02 15:04"),
+		}
+
+		if item.IsDir {
+			item.URL = escapedPath("/browse" + folder + entry.Name + "/")
+		} else {
+			item.URL = browseFileURL(folder + entry.Name)
+			item.Size = formatByteSize(entry.Size)
+			item.Version = entry.Id
+		}
+
+		page.Entries = append(page.Entries, item)
+	}
+
+	display(w, "browse", page)
+}
+
+// Deletes or moves file of the listing. The form carries version of the file
+// it was rendered with: when somebody else changed the file meanwhile, the
+// edit is refused with 409 Conflict instead of clobbering their change.
+// dst without leading slash is a new name in the same folder.
+func browseEdit(w http.ResponseWriter, r *http.Request, folder string) {
+	name, version, dst := r.FormValue("name"), r.FormValue("version"), r.FormValue("dst")
+	if name == "" || strings.Contains(name, "/") {
+		http.Error(w, "name should be a file name", http.StatusBadRequest)
+		return
+	}
+	path := folder + name
+
+	action := r.FormValue("action")
+	paths := []string{path}
+	switch action {
+	case "delete":
+	case "move":
+		if dst == "" || strings.HasSuffix(dst, "/") {
+			http.Error(w, "dst should be a file name or path", http.StatusBadRequest)
+			return
+		}
+		if !strings.HasPrefix(dst, "/") {
+			dst = folder + dst
+		}
+		paths = append(paths, dst)
+	default:
+		http.Error(w, "action should be delete or move", http.StatusBadRequest)
+		return
+	}
+
+	if !apiPathsAuthorized(r, paths...) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	if version == "" {
+		http.Error(w, "version of the file is required", http.StatusPreconditionRequired)
+		return
+	}
+
+	if refuseInMaintenance(w) || refuseLocked(w, r, path) {
+		return
+	}
+
+	spec, err := GetFileDetail(path)
+	if isMissingPathError(err) {
+		http.Error(w, path+" was deleted meanwhile, reload the folder", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if spec.Id != version {
+		http.Error(w, path+" was changed meanwhile, reload the folder", http.StatusConflict)
+		return
+	}
+
+	if action == "delete" {
+		err = deleteFileVersion(path, spec)
+	} else if dst != path {
+		err = moveFileVersion(path, dst, spec)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), seafileErrorHTTPStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	// The listing is shown again with the same query, API key included.
+	listing := &url.URL{Path: "/browse" + folder, RawQuery: r.URL.RawQuery}
+	http.Redirect(w, r, listing.String(), http.StatusSeeOther)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func browseEditRequest(folder string, form url.Values) *http.Request {
+	r := httptest.NewRequest("POST", "/browse"+folder, strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.RemoteAddr = "127.0.0.1:1234"
+	return r
+}
+
+func TestBrowseEditChecksVersion(t *testing.T) {
+	memory := useMemoryStorage(t)
+	upload(t, "/docs/", "a.txt", "first")
+	spec, err := memory.FileDetail(TEST_REPO_ID, "/docs/a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	browseHandler(w, browseEditRequest("/docs/", url.Values{"action": {"delete"}, "name": {"a.txt"}}))
+	if w.Code != http.StatusPreconditionRequired {
+		t.Fatalf("Delete without version answered %d, want 428", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	browseHandler(w, browseEditRequest("/docs/", url.Values{"action": {"move"}, "name": {"a.txt"}, "version": {"stale"}, "dst": {"b.txt"}}))
+	if w.Code != http.StatusConflict {
+		t.Fatalf("Move with stale version answered %d, want 409", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	browseHandler(w, browseEditRequest("/docs/", url.Values{"action": {"move"}, "name": {"a.txt"}, "version": {spec.Id}, "dst": {"b.txt"}}))
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/browse/docs/" {
+		t.Fatalf("Move answered %d to %q", w.Code, w.Header().Get("Location"))
+	}
+	if _, err := memory.FileDetail(TEST_REPO_ID, "/docs/b.txt"); err != nil {
+		t.Fatalf("Moved file is missing: %v", err)
+	}
+
+	w = httptest.NewRecorder()
+	browseHandler(w, browseEditRequest("/docs/", url.Values{"action": {"delete"}, "name": {"a.txt"}, "version": {spec.Id}}))
+	if w.Code != http.StatusConflict {
+		t.Fatalf("Delete of moved file answered %d, want 409", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	browseHandler(w, browseEditRequest("/docs/", url.Values{"action": {"delete"}, "name": {"b.txt"}, "version": {spec.Id}}))
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("Delete answered %d: %s", w.Code, w.Body.String())
+	}
+	if _, err := memory.FileDetail(TEST_REPO_ID, "/docs/b.txt"); !isMissingPathError(err) {
+		t.Fatalf("Deleted file still exists: %v", err)
+	}
+}
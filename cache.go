@@ -0,0 +1,301 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const CACHE_TMP_PREFIX = "tmp-"
+
+// On-disk LRU cache of downloaded files.
+// Entries are keyed by path and Seafile file id, so a changed file is never
+// served from cache: its new id simply misses and the old entry is dropped.
+//
+// Expired entry is still served for max_stale while a fresh copy is fetched
+// in background, so slow file server doesn't hold the request up.
+type DiskCache struct {
+	dir       string
+	max_size  int64
+	ttl       time.Duration
+	max_stale time.Duration
+
+	mutex      sync.Mutex
+	entries    map[string]*cacheEntry
+	paths      map[string]string // path -> key of its latest entry
+	size       int64
+	refreshing map[string]bool // keys being fetched again
+}
+
+type cacheEntry struct {
+	key         string
+	path        string
+	size        int64
+	stored      time.Time
+	last_access time.Time
+}
+
+// Cache used by /get/, nil when disabled.
+var download_cache *DiskCache
+
+func cacheKey(path, file_id string) string {
+	hash := sha256.Sum256([]byte(path + "\n" + file_id))
+	return hex.EncodeToString(hash[:])
+}
+
+// Opens cache in dir, picking up files left from the previous run.
+func NewDiskCache(dir string, max_size int64, ttl, max_stale time.Duration) (*DiskCache, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	c := &DiskCache{
+		dir:        dir,
+		max_size:   max_size,
+		ttl:        ttl,
+		max_stale:  max_stale,
+		entries:    make(map[string]*cacheEntry),
+		paths:      make(map[string]string),
+		refreshing: make(map[string]bool),
+	}
+
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, info := range infos {
+		if info.IsDir() {
+			continue
+		}
+
+		// Unfinished downloads of the previous run.
+		if strings.HasPrefix(info.Name(), CACHE_TMP_PREFIX) {
+			os.Remove(filepath.Join(dir, info.Name()))
+			continue
+		}
+
+		c.entries[info.Name()] = &cacheEntry{
+			key:         info.Name(),
+			size:        info.Size(),
+			stored:      info.ModTime(),
+			last_access: info.ModTime(),
+		}
+		c.size += info.Size()
+	}
+
+	c.mutex.Lock()
+	c.evict()
+	c.mutex.Unlock()
+
+	return c, nil
+}
+
+// Opens cached copy of the file version, if it is there and not expired.
+func (c *DiskCache) Get(path, file_id string) (*os.File, bool) {
+	file, stale, ok := c.GetStale(path, file_id)
+	if stale {
+		file.Close()
+		return nil, false
+	}
+	return file, ok
+}
+
+// Same as Get, but expired copy within max_stale is opened too, stale is true then.
+func (c *DiskCache) GetStale(path, file_id string) (file *os.File, stale bool, ok bool) {
+	key := cacheKey(path, file_id)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false, false
+	}
+
+	if age := time.Since(entry.stored); c.ttl > 0 && age > c.ttl {
+		if age > c.ttl+c.max_stale {
+			c.remove(entry)
+			return nil, false, false
+		}
+		stale = true
+	}
+
+	file, err := os.Open(filepath.Join(c.dir, key))
+	if err != nil {
+		c.remove(entry)
+		return nil, false, false
+	}
+
+	entry.path = path
+	entry.last_access = time.Now()
+	c.paths[path] = key
+
+	return file, stale, true
+}
+
+// Fetches the file version again in background, once at a time.
+// fetch writes the content, the entry is replaced when it succeeds.
+func (c *DiskCache) Revalidate(path, file_id string, fetch func(w io.Writer) error) {
+	key := cacheKey(path, file_id)
+
+	c.mutex.Lock()
+	if c.refreshing[key] {
+		c.mutex.Unlock()
+		return
+	}
+	c.refreshing[key] = true
+	c.mutex.Unlock()
+
+	go func() {
+		defer func() {
+			c.mutex.Lock()
+			delete(c.refreshing, key)
+			c.mutex.Unlock()
+		}()
+
+		writer, err := c.Create(path, file_id)
+		if err != nil {
+			log.Println("Cache:", err)
+			return
+		}
+
+		if err := fetch(writer); err != nil {
+			log.Println("Cache cannot refresh", path, ">", err)
+			writer.Abort()
+			return
+		}
+
+		if err := writer.Commit(); err != nil {
+			log.Println("Cache:", err)
+		}
+	}()
+}
+
+// File being written into the cache. Its SHA-256 is computed on the way.
+type CacheWriter struct {
+	*os.File
+	cache   *DiskCache
+	path    string
+	file_id string
+	hash    hash.Hash
+}
+
+func (w *CacheWriter) Write(p []byte) (int, error) {
+	w.hash.Write(p)
+	return w.File.Write(p)
+}
+
+// Starts writing new cache entry for the file version.
+func (c *DiskCache) Create(path, file_id string) (*CacheWriter, error) {
+	file, err := ioutil.TempFile(c.dir, CACHE_TMP_PREFIX)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CacheWriter{File: file, cache: c, path: path, file_id: file_id, hash: sha256.New()}, nil
+}
+
+// Stores complete file in the cache.
+func (w *CacheWriter) Commit() error {
+	info, err := w.Stat()
+	if err != nil {
+		w.Abort()
+		return err
+	}
+
+	if err := w.Close(); err != nil {
+		os.Remove(w.Name())
+		return err
+	}
+
+	c := w.cache
+	key := cacheKey(w.path, w.file_id)
+
+	rememberContentDigest(w.file_id, hex.EncodeToString(w.hash.Sum(nil)))
+
+	if info.Size() > c.max_size {
+		os.Remove(w.Name())
+		return nil
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := os.Rename(w.Name(), filepath.Join(c.dir, key)); err != nil {
+		os.Remove(w.Name())
+		return err
+	}
+
+	// Previous version of the file is useless now.
+	if old_key, ok := c.paths[w.path]; ok && old_key != key {
+		if old, ok := c.entries[old_key]; ok {
+			c.remove(old)
+		}
+	}
+
+	if old, ok := c.entries[key]; ok {
+		c.size -= old.size
+	}
+
+	now := time.Now()
+	c.entries[key] = &cacheEntry{key: key, path: w.path, size: info.Size(), stored: now, last_access: now}
+	c.paths[w.path] = key
+	c.size += info.Size()
+	c.evict()
+
+	return nil
+}
+
+// Drops incomplete file.
+func (w *CacheWriter) Abort() {
+	w.Close()
+	os.Remove(w.Name())
+}
+
+// Removes all cached files.
+func (c *DiskCache) Purge() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, entry := range c.entries {
+		c.remove(entry)
+	}
+}
+
+// Removes least recently used entries until cache fits max_size. Called with mutex held.
+func (c *DiskCache) evict() {
+	for c.size > c.max_size {
+		var oldest *cacheEntry
+		for _, entry := range c.entries {
+			if oldest == nil || entry.last_access.Before(oldest.last_access) {
+				oldest = entry
+			}
+		}
+
+		if oldest == nil {
+			return
+		}
+
+		log.Println("Cache evicting", oldest.key, oldest.path)
+		c.remove(oldest)
+	}
+}
+
+// Called with mutex held.
+func (c *DiskCache) remove(entry *cacheEntry) {
+	os.Remove(filepath.Join(c.dir, entry.key))
+	delete(c.entries, entry.key)
+	if c.paths[entry.path] == entry.key {
+		delete(c.paths, entry.path)
+	}
+	c.size -= entry.size
+}
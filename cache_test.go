@@ -0,0 +1,79 @@
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func cacheFile(t *testing.T, c *DiskCache, path, file_id, content string) {
+	writer, err := c.Create(path, file_id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer.Write([]byte(content))
+	if err := writer.Commit(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func ageCacheEntry(c *DiskCache, path, file_id string, age time.Duration) {
+	c.mutex.Lock()
+	c.entries[cacheKey(path, file_id)].stored = time.Now().Add(-age)
+	c.mutex.Unlock()
+}
+
+func TestDiskCacheServesStaleWhileRevalidating(t *testing.T) {
+	c, err := NewDiskCache(t.TempDir(), 1<<20, time.Hour, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cacheFile(t, c, "/a.txt", "id1", "content")
+	ageCacheEntry(c, "/a.txt", "id1", 90*time.Minute)
+
+	if _, ok := c.Get("/a.txt", "id1"); ok {
+		t.Error("Get returned expired entry")
+	}
+
+	file, stale, ok := c.GetStale("/a.txt", "id1")
+	if !ok || !stale {
+		t.Fatalf("GetStale = stale %v, ok %v", stale, ok)
+	}
+	file.Close()
+
+	done := make(chan struct{})
+	c.Revalidate("/a.txt", "id1", func(w io.Writer) error {
+		defer close(done)
+		_, err := io.WriteString(w, "content")
+		return err
+	})
+	<-done
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if file, ok := c.Get("/a.txt", "id1"); ok {
+			data, _ := ioutil.ReadAll(file)
+			file.Close()
+			if string(data) != "content" {
+				t.Errorf("Refreshed entry has %q", data)
+			}
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("Entry wasn't refreshed")
+}
+
+func TestDiskCacheDropsEntriesBeyondMaxStale(t *testing.T) {
+	c, err := NewDiskCache(t.TempDir(), 1<<20, time.Hour, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cacheFile(t, c, "/a.txt", "id1", "content")
+	ageCacheEntry(c, "/a.txt", "id1", 3*time.Hour)
+
+	if _, _, ok := c.GetStale("/a.txt", "id1"); ok {
+		t.Error("Entry older than max stale is served")
+	}
+}
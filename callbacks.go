@@ -0,0 +1,221 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	CALLBACK_MAX_ATTEMPTS = 8
+	CALLBACK_RETRY_DELAY  = time.Second
+	CALLBACK_DEDUPE_TTL   = 10 * time.Minute
+
+	// Callbacks being delivered or waiting for a retry, more are dropped.
+	CALLBACK_MAX_PENDING = 1000
+
+	// Called when upload has no callback parameter. Usually nothing listens
+	// there, so it is called once without retries.
+	DEFAULT_CALLBACK_URL = "http://localhost:3000/seafile_uploads"
+)
+
+var callback_slots = make(chan struct{}, CALLBACK_MAX_PENDING)
+
+// Callbacks are delivered at least once: a callback is retried until the
+// receiver answers with 2xx, so receivers may see the same event several times.
+// Every callback carries event_id parameter (and X-Event-Id header) which stays
+// the same for all deliveries of the event, including repeated uploads of the
+// same content within CALLBACK_DEDUPE_TTL, so receivers can drop duplicates.
+// Deleting or moving the file away ends the event, upload after that is a new one.
+type callbackEvent struct {
+	id      string
+	path    string
+	created time.Time
+}
+
+var (
+	callback_events       = make(map[string]callbackEvent)
+	callback_events_mutex sync.Mutex
+)
+
+// Callback configured for uploads into folder prefix.
+type CallbackRoute struct {
+	Prefix string
+	URL    string
+}
+
+// Routes sorted by prefix length, longest first.
+var callback_routes []CallbackRoute
+
+// Parses SEAFILE_CALLBACK_ROUTES value: "/invoices/=http://billing/hook,/avatars/=http://profile/hook".
+func ParseCallbackRoutes(spec string) ([]CallbackRoute, error) {
+	var routes []CallbackRoute
+
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 {
+			return nil, errors.New("Invalid callback route, expected /prefix/=url: " + entry)
+		}
+
+		callback_url, err := url.Parse(strings.TrimSpace(parts[1]))
+		if err != nil || callback_url.Host == "" {
+			return nil, errors.New("Invalid callback url in route: " + entry)
+		}
+
+		prefix := "/" + strings.TrimLeft(strings.TrimSpace(parts[0]), "/")
+		routes = append(routes, CallbackRoute{Prefix: prefix, URL: callback_url.String()})
+	}
+
+	sort.SliceStable(routes, func(i, j int) bool {
+		return len(routes[i].Prefix) > len(routes[j].Prefix)
+	})
+
+	return routes, nil
+}
+
+// Callback configured for the folder, if any.
+func callbackRouteFor(folder string) string {
+	for _, route := range callback_routes {
+		if strings.HasPrefix(folder, route.Prefix) {
+			return route.URL
+		}
+	}
+
+	return ""
+}
+
+// Notifies client supplied callback and the one configured for the folder.
+// Without both DEFAULT_CALLBACK_URL is notified.
+func NotifyUpload(callback_url, folder, filename, hash string, provenance Provenance) {
+	routed := callbackRouteFor(folder)
+	if callback_url == "" && routed == "" {
+		notifyCallback(DEFAULT_CALLBACK_URL, folder, filename, hash, provenance, 1)
+		return
+	}
+
+	NotifyCallback(callback_url, folder, filename, hash, provenance)
+	if routed != callback_url {
+		NotifyCallback(routed, folder, filename, hash, provenance)
+	}
+}
+
+// Returns event id for the callback, reusing the recent one for the same event.
+func callbackEventId(callback_url, folder, filename, hash string) string {
+	key := callback_url + "\n" + folder + "\n" + filename + "\n" + hash
+	now := time.Now()
+
+	callback_events_mutex.Lock()
+	defer callback_events_mutex.Unlock()
+
+	for k, event := range callback_events {
+		if now.Sub(event.created) > CALLBACK_DEDUPE_TTL {
+			delete(callback_events, k)
+		}
+	}
+
+	if event, ok := callback_events[key]; ok {
+		return event.id
+	}
+
+	event := callbackEvent{id: newUUID(), path: folder + filename, created: now}
+	callback_events[key] = event
+	return event.id
+}
+
+// Ends events of the file when it is deleted or moved away.
+func forgetCallbackEvents(path string) {
+	callback_events_mutex.Lock()
+	defer callback_events_mutex.Unlock()
+
+	for key, event := range callback_events {
+		if event.path == path {
+			delete(callback_events, key)
+		}
+	}
+}
+
+// Notifies callback_url about stored file in background.
+// Provenance of the upload is passed as provenance_* parameters.
+func NotifyCallback(callback_url, folder, filename, hash string, provenance Provenance) {
+	notifyCallback(callback_url, folder, filename, hash, provenance, CALLBACK_MAX_ATTEMPTS)
+}
+
+func notifyCallback(callback_url, folder, filename, hash string, provenance Provenance, max_attempts int) {
+	if callback_url == "" {
+		return
+	}
+
+	event_id := callbackEventId(callback_url, folder, filename, hash)
+
+	select {
+	case callback_slots <- struct{}{}:
+	default:
+		log.Println("Too many pending callbacks, dropping", event_id, "to", callback_url)
+		return
+	}
+
+	go func() {
+		defer func() { <-callback_slots }()
+
+		params := provenance.Values()
+		params.Set("folder", folder)
+		params.Set("file", filename)
+		params.Set("hash", hash)
+		params.Set("event_id", event_id)
+
+		// Receiver can fetch the file right away without proxy credentials.
+		if download_url := SignedDownloadURL(folder+filename, callback_link_ttl); download_url != "" {
+			params.Set("download_url", download_url)
+		}
+		url_with_params := callback_url + "?" + params.Encode()
+
+		delay := CALLBACK_RETRY_DELAY
+		for attempt := 1; attempt <= max_attempts; attempt++ {
+			err := deliverCallback(url_with_params, event_id)
+			if err == nil {
+				log.Println("Called back to", callback_url, "event", event_id)
+				return
+			}
+
+			log.Printf("Callback %s attempt %d failed: %v\n", event_id, attempt, err)
+			if attempt < max_attempts {
+				time.Sleep(delay)
+				delay *= 2
+			}
+		}
+
+		log.Println("Giving up callback", event_id, "to", callback_url)
+	}()
+}
+
+func deliverCallback(url_with_params, event_id string) error {
+	req, err := http.NewRequest("GET", url_with_params, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Add("X-Event-Id", event_id)
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	return nil
+}
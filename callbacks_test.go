@@ -0,0 +1,92 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func callbackServer(hits *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(hits, 1)
+	}))
+}
+
+func waitForHits(hits *int32, want int32) int32 {
+	deadline := time.Now().Add(2 * time.Second)
+	for atomic.LoadInt32(hits) < want && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	return atomic.LoadInt32(hits)
+}
+
+func TestNotifyCallbackDelivers(t *testing.T) {
+	var hits int32
+	server := callbackServer(&hits)
+	defer server.Close()
+
+	NotifyCallback(server.URL, "/docs/", "a.txt", "hash-delivers", Provenance{})
+
+	if got := waitForHits(&hits, 1); got != 1 {
+		t.Errorf("Expected 1 delivery, got %d", got)
+	}
+}
+
+func TestNotifyCallbackDropsWhenFull(t *testing.T) {
+	var hits int32
+	server := callbackServer(&hits)
+	defer server.Close()
+
+	for i := 0; i < CALLBACK_MAX_PENDING; i++ {
+		callback_slots <- struct{}{}
+	}
+	NotifyCallback(server.URL, "/docs/", "a.txt", "hash-dropped", Provenance{})
+	for i := 0; i < CALLBACK_MAX_PENDING; i++ {
+		<-callback_slots
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if got := atomic.LoadInt32(&hits); got != 0 {
+		t.Errorf("Callback over the limit was delivered %d times", got)
+	}
+}
+
+func TestNotifyUploadSkipsDefaultForRoutedFolder(t *testing.T) {
+	var hits int32
+	server := callbackServer(&hits)
+	defer server.Close()
+
+	saved := callback_routes
+	defer func() { callback_routes = saved }()
+	callback_routes = []CallbackRoute{{Prefix: "/invoices/", URL: server.URL}}
+
+	NotifyUpload("", "/invoices/", "a.pdf", "hash-routed", Provenance{})
+
+	if got := waitForHits(&hits, 1); got != 1 {
+		t.Errorf("Expected 1 routed delivery, got %d", got)
+	}
+
+	callback_events_mutex.Lock()
+	defer callback_events_mutex.Unlock()
+	for key := range callback_events {
+		if strings.HasPrefix(key, DEFAULT_CALLBACK_URL) {
+			t.Error("Default callback was notified for routed folder")
+		}
+	}
+}
+
+func TestCallbackEventEndsOnDelete(t *testing.T) {
+	first := callbackEventId("http://hook", "/docs/", "a.txt", "hash-deleted")
+	if again := callbackEventId("http://hook", "/docs/", "a.txt", "hash-deleted"); again != first {
+		t.Error("Repeated upload got new event id")
+	}
+
+	publishChange(ChangeEvent{Type: "deleted", Path: "/docs/a.txt"})
+
+	if after := callbackEventId("http://hook", "/docs/", "a.txt", "hash-deleted"); after == first {
+		t.Error("Upload after delete got event id of the deleted file")
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"mime/multipart"
+)
+
+// Content-addressable layout: files are stored as
+// {folder}/ab/cd/abcd1234.../original-name.jpg where abcd1234... is SHA-256 of
+// the stored content. Same content always lands at the same path, so repeated
+// uploads are skipped and URLs stay stable.
+
+// Folder for content with given SHA-256 hex digest, relative to the upload folder.
+func contentAddressedFolder(digest string) string {
+	return digest[0:2] + "/" + digest[2:4] + "/" + digest + "/"
+}
+
+// Computes SHA-256 and size of the form file content as it will be stored.
+func hashFormFile(f *multipart.FileHeader, strip_metadata bool) (string, int64, error) {
+	file, err := f.Open()
+	if err != nil {
+		return "", 0, err
+	}
+	defer file.Close()
+
+	var src io.Reader = file
+	if strip_metadata {
+		src, err = StripImageMetadata(file)
+		if err != nil {
+			return "", 0, err
+		}
+	}
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, src)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), size, nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// SHA-256 of the file version, from known digests, the download cache or by
+// downloading it. Computed digests are remembered by file id.
+func fileDigest(path string, spec FileSpec) (string, error) {
+	if digest, ok := knownContentDigest(spec.Id); ok {
+		return digest, nil
+	}
+
+	var digest string
+	var err error
+
+	if file, ok := cachedFile(path, spec.Id); ok {
+		hash := sha256.New()
+		_, err = io.Copy(hash, file)
+		file.Close()
+		digest = hex.EncodeToString(hash.Sum(nil))
+	} else {
+		digest, err = hashRemoteFile(path)
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	rememberContentDigest(spec.Id, digest)
+	return digest, nil
+}
+
+// Sets Digest header (RFC 3230) when SHA-256 of the file version is already known.
+func setDigestHeader(w http.ResponseWriter, file_id string) {
+	digest, ok := knownContentDigest(file_id)
+	if !ok {
+		return
+	}
+
+	sum, err := hex.DecodeString(digest)
+	if err != nil {
+		return
+	}
+
+	w.Header().Set("Digest", "SHA-256="+base64.StdEncoding.EncodeToString(sum))
+}
+
+// Opens cached copy of the file version if download cache is enabled.
+func cachedFile(path, file_id string) (io.ReadCloser, bool) {
+	if download_cache == nil {
+		return nil, false
+	}
+
+	file, ok := download_cache.Get(path, file_id)
+	return file, ok
+}
+
+// Appends "<sha256>  <relative path>" lines for all files under folder.
+func folderChecksums(folder, relative string, lines []string) ([]string, error) {
+	err, entries := ListDirectoryEntries(folder)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		switch entry.Type {
+		case "dir":
+			lines, err = folderChecksums(folder+entry.Name+"/", relative+entry.Name+"/", lines)
+			if err != nil {
+				return nil, err
+			}
+		case "file":
+			digest, err := fileDigest(folder+entry.Name, entry)
+			if err != nil {
+				return nil, err
+			}
+			lines = append(lines, fmt.Sprintf("%s  %s", digest, relative+entry.Name))
+		}
+	}
+
+	return lines, nil
+}
+
+// GET /checksums?p=/folder returns SHA256SUMS manifest of the folder, verifiable with sha256sum -c.
+func checksumsHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println(r.Method, r.RequestURI)
+
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	folder := r.URL.Query().Get("p")
+	if folder == "" {
+		http.Error(w, "Missing folder parameter p", http.StatusBadRequest)
+		return
+	}
+
+	if !strings.HasSuffix(folder, "/") {
+		folder += "/"
+	}
+
+	if !downloadAuthorized(r, folder) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	lines, err := folderChecksums(folder, "", nil)
+	if isMissingPathError(err) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	for _, line := range lines {
+		fmt.Fprintln(w, line)
+	}
+}
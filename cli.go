@@ -0,0 +1,514 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// CLI exit codes by failure class.
+const (
+	EXIT_OK     = 0
+	EXIT_USAGE  = 2 // wrong arguments
+	EXIT_AUTH   = 3 // login or token problems
+	EXIT_LOCAL  = 4 // local file can't be read
+	EXIT_REMOTE = 5 // Seafile request failed
+)
+
+// Result of a CLI operation on one file, printed with --json.
+type CommandResult struct {
+	Path  string `json:"path,omitempty"`
+	Hash  string `json:"hash,omitempty"`
+	Size  int64  `json:"size"`
+	Error string `json:"error,omitempty"`
+}
+
+func printJSON(data interface{}) {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(data)
+}
+
+// Reports error and exits with code of its failure class.
+func commandFailed(json_output bool, code int, err error) {
+	if json_output {
+		printJSON(map[string]interface{}{"error": err.Error(), "exit_code": code})
+	} else {
+		log.Println(err)
+	}
+	os.Exit(code)
+}
+
+// Error with CLI exit code.
+type commandError struct {
+	code int
+	err  error
+}
+
+func (e *commandError) Error() string {
+	return e.err.Error()
+}
+
+// Upload command:
+//
+//	some-command | seafile-uploader upload --stdin --name report.csv --folder /reports/
+//	seafile-uploader upload [--json] --folder /reports/ report.csv summary.txt
+//	seafile-uploader upload --pick report.csv
+//	seafile-uploader upload --folder /site/ ./public
+//
+// Directories are uploaded recursively, skipping paths matched by SEAFILE_IGNORE
+// and .seafileignore files.
+func MaybeUploadRequest() {
+	if len(os.Args) < 2 || os.Args[1] != "upload" {
+		return
+	}
+
+	flags := flag.NewFlagSet("upload", flag.ExitOnError)
+	from_stdin := flags.Bool("stdin", false, "read file content from standard input")
+	name := flags.String("name", "", "file name for --stdin upload")
+	folder := flags.String("folder", default_folder, "target folder")
+	replace := flags.Bool("replace", false, "replace existing file with the same name")
+	pick := flags.Bool("pick", false, "choose target folder interactively")
+	json_output := flags.Bool("json", false, "print results as JSON")
+	flags.Parse(os.Args[2:])
+
+	if *from_stdin == (flags.NArg() > 0) || (*from_stdin && *name == "") {
+		commandFailed(*json_output, EXIT_USAGE, errors.New("USAGE: seafile-uploader upload [--json] --stdin --name report.csv [--folder /reports/ | --pick] [--replace]\n       seafile-uploader upload [--json] [--folder /reports/ | --pick] [--replace] file-or-dir..."))
+	}
+
+	if *pick {
+		// Standard input may carry file content, so ask on the terminal.
+		terminal, err := os.Open("/dev/tty")
+		if err != nil {
+			commandFailed(*json_output, EXIT_USAGE, errors.New("--pick needs a terminal: "+err.Error()))
+		}
+
+		*folder, err = PickFolder(*folder, terminal, os.Stderr)
+		terminal.Close()
+		if err != nil {
+			commandFailed(*json_output, EXIT_REMOTE, err)
+		}
+	}
+
+	var results []CommandResult
+	exit_code := EXIT_OK
+
+	report := func(result CommandResult, err error) {
+		if err != nil {
+			result.Error = err.Error()
+			if exit_code == EXIT_OK {
+				exit_code = EXIT_REMOTE
+				if cmd_err, ok := err.(*commandError); ok {
+					exit_code = cmd_err.code
+				}
+			}
+			if !*json_output {
+				log.Println(err)
+			}
+		} else if !*json_output {
+			fmt.Println(result.Path, result.Hash, result.Size)
+		}
+		results = append(results, result)
+	}
+
+	if *from_stdin {
+		report(uploadCommandFile(os.Stdin, *folder, *name, *replace))
+	}
+
+	for _, file_path := range flags.Args() {
+		info, err := os.Stat(file_path)
+		if err != nil {
+			report(CommandResult{Path: file_path}, &commandError{EXIT_LOCAL, err})
+			continue
+		}
+
+		if info.IsDir() {
+			uploadCommandDir(file_path, *folder, *replace, report)
+			continue
+		}
+
+		if isIgnored(ignore_patterns, filepath.Base(file_path), false) {
+			log.Println("Ignoring", file_path)
+			continue
+		}
+
+		file, err := os.Open(file_path)
+		if err != nil {
+			report(CommandResult{Path: file_path}, &commandError{EXIT_LOCAL, err})
+			continue
+		}
+
+		report(uploadCommandFile(file, *folder, filepath.Base(file_path), *replace))
+		file.Close()
+	}
+
+	if *json_output {
+		printJSON(map[string]interface{}{"files": results, "exit_code": exit_code})
+	}
+
+	os.Exit(exit_code)
+}
+
+// Uploads local directory tree into the folder keeping its structure.
+func uploadCommandDir(root, folder string, replace bool, report func(CommandResult, error)) {
+	folder = strings.TrimRight(folder, "/") + "/"
+	patterns := ignore_patterns
+
+	filepath.Walk(root, func(local_path string, info os.FileInfo, err error) error {
+		if err != nil {
+			report(CommandResult{Path: local_path}, &commandError{EXIT_LOCAL, err})
+			return nil
+		}
+
+		rel_path, err := filepath.Rel(root, local_path)
+		if err != nil {
+			return err
+		}
+		rel := filepath.ToSlash(rel_path)
+
+		if info.IsDir() {
+			if rel != "." && isIgnored(patterns, rel, true) {
+				log.Println("Ignoring", local_path)
+				return filepath.SkipDir
+			}
+
+			base := rel + "/"
+			if rel == "." {
+				base = ""
+			}
+
+			dir_patterns, err := readIgnoreFile(local_path, base)
+			if err != nil {
+				report(CommandResult{Path: local_path}, &commandError{EXIT_LOCAL, err})
+			}
+			patterns = append(patterns, dir_patterns...)
+			return nil
+		}
+
+		if info.Name() == IGNORE_FILE || !info.Mode().IsRegular() {
+			return nil
+		}
+
+		if isIgnored(patterns, rel, false) {
+			log.Println("Ignoring", local_path)
+			return nil
+		}
+
+		file, err := os.Open(local_path)
+		if err != nil {
+			report(CommandResult{Path: local_path}, &commandError{EXIT_LOCAL, err})
+			return nil
+		}
+		defer file.Close()
+
+		dir := folder
+		if rel_dir := path.Dir(rel); rel_dir != "." {
+			dir += rel_dir + "/"
+		}
+
+		report(uploadCommandFile(file, dir, info.Name(), replace))
+		return nil
+	})
+}
+
+// Counts bytes read through it.
+type countingReader struct {
+	reader io.Reader
+	count  int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.reader.Read(p)
+	c.count += int64(n)
+	return n, err
+}
+
+// Streams src to the folder, creating the folder when needed.
+func uploadCommandFile(src io.Reader, folder, name string, replace bool) (CommandResult, error) {
+	result := CommandResult{Path: folder + name}
+
+	filename, err := SanitizeFilename(name)
+	if err != nil {
+		return result, &commandError{EXIT_USAGE, err}
+	}
+
+	vars := folderVariables(time.Now().Format("2006-01-02"), newUUID(), "", filename)
+	dir, err := ExpandFolder(folder, vars)
+	if err != nil {
+		return result, &commandError{EXIT_USAGE, err}
+	}
+	result.Path = dir + filename
+
+	err, existing, dir_exist := IsDirectoryExist(dir)
+	if err != nil {
+		return result, err
+	}
+
+	if replace && isHeld(dir+filename) {
+		for _, spec := range existing {
+			if spec.Name == filename {
+				return result, ErrPathHeld
+			}
+		}
+	}
+
+	if !dir_exist {
+		if err := CreateDirectory(dir); err != nil {
+			return result, err
+		}
+	}
+
+	counter := &countingReader{reader: src}
+	result.Hash, err = UploadStream(counter, dir, filename, replace, global_upload_limiter)
+	result.Size = counter.count
+
+	return result, err
+}
+
+// Written next to the output while a download is in progress, so an
+// interrupted download can continue where it stopped: report.csv.resume.
+type DownloadResumeToken struct {
+	Path   string `json:"path"`
+	FileId string `json:"file_id"`
+	Size   int64  `json:"size"`
+	Offset int64  `json:"offset"`
+	Temp   string `json:"temp"`
+}
+
+const (
+	DOWNLOAD_RESUME_SUFFIX = ".resume"
+	DOWNLOAD_TEMP_SUFFIX   = ".part"
+
+	// How often the token is updated during the transfer.
+	DOWNLOAD_TOKEN_INTERVAL = 8 << 20
+)
+
+func writeResumeToken(file string, token DownloadResumeToken) error {
+	data, err := json.MarshalIndent(token, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := file + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+func readResumeToken(file string) (DownloadResumeToken, error) {
+	var token DownloadResumeToken
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return token, err
+	}
+
+	return token, json.Unmarshal(data, &token)
+}
+
+// Download command:
+//
+//	seafile-uploader download [--json] [--output report.csv] /reports/report.csv
+//	seafile-uploader download --resume /reports/report.csv
+//
+// Content goes to <output>.part and is renamed when complete. Progress is kept
+// in <output>.resume, --resume continues from it with a Range request as long
+// as the file in Seafile wasn't changed meanwhile, otherwise starts over.
+func MaybeDownloadRequest() {
+	if len(os.Args) < 2 || os.Args[1] != "download" {
+		return
+	}
+
+	flags := flag.NewFlagSet("download", flag.ExitOnError)
+	output := flags.String("output", "", "local file, name of the remote file by default")
+	resume := flags.Bool("resume", false, "continue interrupted download")
+	json_output := flags.Bool("json", false, "print result as JSON")
+	flags.Parse(os.Args[2:])
+
+	if flags.NArg() != 1 || !strings.HasPrefix(flags.Arg(0), "/") || strings.HasSuffix(flags.Arg(0), "/") {
+		commandFailed(*json_output, EXIT_USAGE, errors.New("USAGE: seafile-uploader download [--json] [--resume] [--output report.csv] /reports/report.csv"))
+	}
+
+	if *output == "" {
+		*output = path.Base(flags.Arg(0))
+	}
+
+	result, err := downloadCommandFile(flags.Arg(0), *output, *resume)
+	if err != nil {
+		code := EXIT_REMOTE
+		if cmd_err, ok := err.(*commandError); ok {
+			code = cmd_err.code
+		}
+		commandFailed(*json_output, code, err)
+	}
+
+	if *json_output {
+		printJSON(result)
+	} else {
+		fmt.Println(result.Path, result.Hash, result.Size)
+	}
+
+	os.Exit(EXIT_OK)
+}
+
+// Downloads remote file to output, continuing from its resume token when resume is set.
+func downloadCommandFile(remote, output string, resume bool) (CommandResult, error) {
+	result := CommandResult{Path: output}
+	token_file := output + DOWNLOAD_RESUME_SUFFIX
+
+	spec, err := GetFileDetail(remote)
+	if err != nil {
+		return result, err
+	}
+	result.Hash = spec.Id
+
+	token := DownloadResumeToken{Path: remote, FileId: spec.Id, Size: spec.Size, Temp: output + DOWNLOAD_TEMP_SUFFIX}
+	if resume {
+		previous, err := readResumeToken(token_file)
+		switch {
+		case os.IsNotExist(err):
+			log.Println("Nothing to resume, downloading", remote)
+		case err != nil:
+			return result, &commandError{EXIT_LOCAL, err}
+		case previous.Path != remote:
+			return result, &commandError{EXIT_USAGE, errors.New(token_file + " belongs to " + previous.Path)}
+		case previous.FileId != spec.Id:
+			log.Println(remote, "was changed since the download started, downloading again")
+		default:
+			token = previous
+		}
+	}
+
+	temp, err := os.OpenFile(token.Temp, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return result, &commandError{EXIT_LOCAL, err}
+	}
+	defer temp.Close()
+
+	// Bytes past the token may be incomplete, they are downloaded again.
+	if info, err := temp.Stat(); err != nil {
+		return result, &commandError{EXIT_LOCAL, err}
+	} else if info.Size() < token.Offset {
+		token.Offset = info.Size()
+	}
+	if err := temp.Truncate(token.Offset); err != nil {
+		return result, &commandError{EXIT_LOCAL, err}
+	}
+	if _, err := temp.Seek(token.Offset, io.SeekStart); err != nil {
+		return result, &commandError{EXIT_LOCAL, err}
+	}
+
+	if err := writeResumeToken(token_file, token); err != nil {
+		return result, &commandError{EXIT_LOCAL, err}
+	}
+
+	if token.Offset < token.Size {
+		if err := downloadRemainder(&token, temp, token_file); err != nil {
+			writeResumeToken(token_file, token)
+			return result, fmt.Errorf("%v, run download --resume to continue from byte %d", err, token.Offset)
+		}
+	}
+
+	// Transfer is complete only if the file is still the one it started with.
+	if spec, err := GetFileDetail(remote); err != nil {
+		return result, err
+	} else if spec.Id != token.FileId {
+		os.Remove(token_file)
+		return result, errors.New(remote + " was changed during the download, run download again")
+	}
+	if token.Offset != token.Size {
+		return result, fmt.Errorf("Downloaded %d bytes of %d", token.Offset, token.Size)
+	}
+
+	if err := temp.Close(); err != nil {
+		return result, &commandError{EXIT_LOCAL, err}
+	}
+	if err := os.Rename(token.Temp, output); err != nil {
+		return result, &commandError{EXIT_LOCAL, err}
+	}
+	os.Remove(token_file)
+
+	result.Size = token.Size
+	return result, nil
+}
+
+// Appends the rest of the file to temp starting at token offset, updating the token as it goes.
+func downloadRemainder(token *DownloadResumeToken, temp *os.File, token_file string) error {
+	link, err := GetDownloadFileLink(token.Path)
+	if err != nil {
+		return err
+	}
+
+	header := http.Header{}
+	if token.Offset > 0 {
+		header.Set("Range", fmt.Sprintf("bytes=%d-", token.Offset))
+		log.Println("Resuming", token.Path, "from byte", token.Offset)
+	}
+
+	resp, _, err := fileServerGet(link, header, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusPartialContent:
+		if first, _, ok := parseContentRange(resp.Header.Get("Content-Range")); !ok || first != token.Offset {
+			return errors.New("Unexpected Content-Range: " + resp.Header.Get("Content-Range"))
+		}
+	case resp.StatusCode == http.StatusOK:
+		// Range was ignored, the whole file comes again.
+		if token.Offset > 0 {
+			log.Println("File server doesn't support ranges, downloading", token.Path, "from the start")
+			token.Offset = 0
+			if err := temp.Truncate(0); err != nil {
+				return &commandError{EXIT_LOCAL, err}
+			}
+			if _, err := temp.Seek(0, io.SeekStart); err != nil {
+				return &commandError{EXIT_LOCAL, err}
+			}
+		}
+	default:
+		return errors.New("Download failed: " + resp.Status)
+	}
+
+	buffer := make([]byte, 32*1024)
+	saved := token.Offset
+	for {
+		n, read_err := resp.Body.Read(buffer)
+		if n > 0 {
+			if _, err := temp.Write(buffer[:n]); err != nil {
+				return &commandError{EXIT_LOCAL, err}
+			}
+			token.Offset += int64(n)
+
+			if token.Offset-saved >= DOWNLOAD_TOKEN_INTERVAL {
+				if err := temp.Sync(); err != nil {
+					return &commandError{EXIT_LOCAL, err}
+				}
+				if err := writeResumeToken(token_file, *token); err != nil {
+					return &commandError{EXIT_LOCAL, err}
+				}
+				saved = token.Offset
+			}
+		}
+
+		if read_err == io.EOF {
+			return nil
+		}
+		if read_err != nil {
+			return read_err
+		}
+	}
+}
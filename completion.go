@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const bashCompletion = `_seafile_uploader() {
+    local cur prev
+    cur="${COMP_WORDS[COMP_CWORD]}"
+    prev="${COMP_WORDS[COMP_CWORD-1]}"
+
+    if [ "$COMP_CWORD" -eq 1 ]; then
+        COMPREPLY=($(compgen -W "login upload download completion" -- "$cur"))
+        return
+    fi
+
+    if [ "$prev" = "--folder" ]; then
+        compopt -o nospace
+        COMPREPLY=($(seafile-uploader __complete-folder "$cur" 2>/dev/null))
+        return
+    fi
+
+    case "${COMP_WORDS[1]}" in
+        upload)
+            if [[ "$cur" == -* ]]; then
+                COMPREPLY=($(compgen -W "--stdin --name --folder --pick --replace --json --profile" -- "$cur"))
+            else
+                COMPREPLY=($(compgen -f -- "$cur"))
+            fi
+            ;;
+        download)
+            if [[ "$cur" == -* ]]; then
+                COMPREPLY=($(compgen -W "--output --resume --json --profile" -- "$cur"))
+            fi
+            ;;
+        login)
+            COMPREPLY=($(compgen -W "--json --profile" -- "$cur"))
+            ;;
+        completion)
+            COMPREPLY=($(compgen -W "bash zsh fish" -- "$cur"))
+            ;;
+    esac
+}
+
+complete -F _seafile_uploader seafile-uploader
+`
+
+const zshCompletion = `#compdef seafile-uploader
+
+_seafile_uploader_folders() {
+    local -a folders
+    folders=(${(f)"$(seafile-uploader __complete-folder "$PREFIX" 2>/dev/null)"})
+    compadd -U -S '' -- $folders
+}
+
+_seafile_uploader() {
+    local -a commands
+    commands=(
+        'login:get API token'
+        'upload:upload files to Seafile'
+        'download:download file from Seafile'
+        'completion:print shell completion script'
+    )
+
+    if (( CURRENT == 2 )); then
+        _describe command commands
+        return
+    fi
+
+    shift words
+    (( CURRENT-- ))
+
+    case $words[1] in
+        upload)
+            _arguments \
+                '--stdin[read file content from standard input]' \
+                '--name[file name for --stdin upload]:name:' \
+                '--folder[target folder]:folder:_seafile_uploader_folders' \
+                '--pick[choose target folder interactively]' \
+                '--replace[replace existing file with the same name]' \
+                '--json[print results as JSON]' \
+                '--profile[configuration profile]:profile:' \
+                '*:file:_files'
+            ;;
+        download)
+            _arguments \
+                '--output[local file]:file:_files' \
+                '--resume[continue interrupted download]' \
+                '--json[print result as JSON]' \
+                '--profile[configuration profile]:profile:' \
+                ':path:'
+            ;;
+        login)
+            _arguments '--json[print result as JSON]' '--profile[configuration profile]:profile:' ':username:' ':password:'
+            ;;
+        completion)
+            _values shell bash zsh fish
+            ;;
+    esac
+}
+
+compdef _seafile_uploader seafile-uploader
+`
+
+const fishCompletion = `complete -c seafile-uploader -f
+complete -c seafile-uploader -n __fish_use_subcommand -a login -d 'Get API token'
+complete -c seafile-uploader -n __fish_use_subcommand -a upload -d 'Upload files to Seafile'
+complete -c seafile-uploader -n __fish_use_subcommand -a download -d 'Download file from Seafile'
+complete -c seafile-uploader -n __fish_use_subcommand -a completion -d 'Print shell completion script'
+complete -c seafile-uploader -n '__fish_seen_subcommand_from completion' -a 'bash zsh fish'
+complete -c seafile-uploader -n '__fish_seen_subcommand_from login upload download' -l json -d 'Print results as JSON'
+complete -c seafile-uploader -l profile -x -d 'Configuration profile'
+complete -c seafile-uploader -n '__fish_seen_subcommand_from upload' -F
+complete -c seafile-uploader -n '__fish_seen_subcommand_from upload' -l stdin -d 'Read file content from standard input'
+complete -c seafile-uploader -n '__fish_seen_subcommand_from upload' -l name -r -d 'File name for --stdin upload'
+complete -c seafile-uploader -n '__fish_seen_subcommand_from upload' -l folder -x -a '(seafile-uploader __complete-folder (commandline -ct) 2>/dev/null)' -d 'Target folder'
+complete -c seafile-uploader -n '__fish_seen_subcommand_from upload' -l pick -d 'Choose target folder interactively'
+complete -c seafile-uploader -n '__fish_seen_subcommand_from upload' -l replace -d 'Replace existing file with the same name'
+complete -c seafile-uploader -n '__fish_seen_subcommand_from download' -l output -r -F -d 'Local file'
+complete -c seafile-uploader -n '__fish_seen_subcommand_from download' -l resume -d 'Continue interrupted download'
+`
+
+// Prints completion script, doesn't need any configuration:
+//
+//	seafile-uploader completion bash > /etc/bash_completion.d/seafile-uploader
+//	seafile-uploader completion zsh > "${fpath[1]}/_seafile-uploader"
+//	seafile-uploader completion fish > ~/.config/fish/completions/seafile-uploader.fish
+func MaybeCompletionRequest() {
+	if len(os.Args) < 2 || os.Args[1] != "completion" {
+		return
+	}
+
+	scripts := map[string]string{"bash": bashCompletion, "zsh": zshCompletion, "fish": fishCompletion}
+
+	if len(os.Args) < 3 || scripts[os.Args[2]] == "" {
+		commandFailed(false, EXIT_USAGE, errors.New("USAGE: seafile-uploader completion bash|zsh|fish"))
+	}
+
+	fmt.Print(scripts[os.Args[2]])
+	os.Exit(EXIT_OK)
+}
+
+// Subfolders of the folder, sorted by name.
+func listSubfolders(folder string) ([]string, error) {
+	err, entries := ListDirectoryEntries(folder)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if entry.Type == "dir" {
+			names = append(names, entry.Name)
+		}
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// Prints remote folders starting with the prefix, used by completion scripts:
+//
+//	seafile-uploader __complete-folder /rep
+func MaybeCompleteFolderRequest() {
+	if len(os.Args) < 2 || os.Args[1] != "__complete-folder" {
+		return
+	}
+
+	prefix := "/"
+	if len(os.Args) > 2 && os.Args[2] != "" {
+		prefix = "/" + strings.TrimLeft(os.Args[2], "/")
+	}
+
+	parent := prefix[:strings.LastIndex(prefix, "/")+1]
+	partial := prefix[len(parent):]
+
+	names, err := listSubfolders(parent)
+	if err != nil {
+		os.Exit(EXIT_REMOTE)
+	}
+
+	for _, name := range names {
+		if strings.HasPrefix(name, partial) {
+			fmt.Println(parent + name + "/")
+		}
+	}
+
+	os.Exit(EXIT_OK)
+}
+
+// Lets user walk remote folders and choose one, starting from start.
+// A name which is not in the list picks new folder, created on upload.
+func PickFolder(start string, in io.Reader, out io.Writer) (string, error) {
+	folder := "/" + strings.Trim(start, "/") + "/"
+	if folder == "//" {
+		folder = "/"
+	}
+
+	input := bufio.NewScanner(in)
+
+	for {
+		names, err := listSubfolders(folder)
+		if err != nil {
+			return "", err
+		}
+
+		fmt.Fprintln(out, "Folder:", folder)
+		for i, name := range names {
+			fmt.Fprintf(out, "  %d) %s/\n", i+1, name)
+		}
+		fmt.Fprint(out, "Number to open, .. to go up, new name to create, Enter to choose: ")
+
+		if !input.Scan() {
+			if err := input.Err(); err != nil {
+				return "", err
+			}
+			return "", errors.New("No folder chosen")
+		}
+
+		answer := strings.TrimSpace(input.Text())
+
+		if answer == "" {
+			return folder, nil
+		}
+
+		if answer == ".." {
+			if folder != "/" {
+				folder = folder[:strings.LastIndex(strings.TrimSuffix(folder, "/"), "/")+1]
+			}
+			continue
+		}
+
+		if n, err := strconv.Atoi(answer); err == nil {
+			if n < 1 || n > len(names) {
+				fmt.Fprintln(out, "No such folder:", n)
+				continue
+			}
+			folder += names[n-1] + "/"
+			continue
+		}
+
+		return folder + strings.Trim(answer, "/") + "/", nil
+	}
+}
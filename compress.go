@@ -0,0 +1,132 @@
+package main
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Smaller responses are not worth compressing.
+const COMPRESS_MIN_SIZE = 1024
+
+// Content types which compress well. Images, video and archives are already compressed.
+var compressible_types = []string{
+	"application/json",
+	"application/javascript",
+	"application/xml",
+	"application/xhtml+xml",
+	"application/x-yaml",
+	"application/yaml",
+	"image/svg+xml",
+}
+
+func compressibleType(content_type string) bool {
+	media_type := strings.TrimSpace(strings.SplitN(content_type, ";", 2)[0])
+	return strings.HasPrefix(media_type, "text/") || stringInSlice(media_type, compressible_types)
+}
+
+// Whether Accept-Encoding allows gzip: "gzip, deflate, br" or "gzip;q=0.8".
+func acceptsGzip(r *http.Request) bool {
+	for _, entry := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		parts := strings.Split(entry, ";")
+		name := strings.TrimSpace(parts[0])
+		if name != "gzip" && name != "*" {
+			continue
+		}
+
+		for _, param := range parts[1:] {
+			if q := strings.TrimSpace(param); strings.HasPrefix(q, "q=") {
+				if value, err := strconv.ParseFloat(q[2:], 64); err == nil && value == 0 {
+					return false
+				}
+			}
+		}
+		return true
+	}
+
+	return false
+}
+
+// Compresses complete (200) responses of compressible types on the fly.
+// Partial and already encoded responses are passed as is.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	gzip          *gzip.Writer
+	wrote_headers bool
+}
+
+func (g *gzipResponseWriter) WriteHeader(status int) {
+	if g.wrote_headers {
+		return
+	}
+	g.wrote_headers = true
+
+	header := g.Header()
+	if status == http.StatusOK && compressibleType(header.Get("Content-Type")) {
+		header.Add("Vary", "Accept-Encoding")
+
+		length, err := strconv.ParseInt(header.Get("Content-Length"), 10, 64)
+		if header.Get("Content-Encoding") == "" && header.Get("Content-Range") == "" && (err != nil || length >= COMPRESS_MIN_SIZE) {
+			header.Del("Content-Length")
+			header.Set("Content-Encoding", "gzip")
+
+			// Compressed body differs from the stored file byte by byte,
+			// checksums of the stored file don't match it.
+			if etag := header.Get("ETag"); strings.HasPrefix(etag, `"`) {
+				header.Set("ETag", "W/"+etag)
+			}
+			header.Del("Digest")
+			header.Del("Content-MD5")
+
+			g.gzip = gzip.NewWriter(g.ResponseWriter)
+		}
+	}
+
+	g.ResponseWriter.WriteHeader(status)
+}
+
+func (g *gzipResponseWriter) Write(p []byte) (int, error) {
+	if !g.wrote_headers {
+		if g.Header().Get("Content-Type") == "" {
+			g.Header().Set("Content-Type", http.DetectContentType(p))
+		}
+		g.WriteHeader(http.StatusOK)
+	}
+
+	if g.gzip != nil {
+		return g.gzip.Write(p)
+	}
+	return g.ResponseWriter.Write(p)
+}
+
+func (g *gzipResponseWriter) Flush() {
+	if g.gzip != nil {
+		g.gzip.Flush()
+	}
+
+	if f, ok := g.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (g *gzipResponseWriter) Close() error {
+	if g.gzip != nil {
+		return g.gzip.Close()
+	}
+	return nil
+}
+
+// Wraps GET handler with gzip compression when enabled and accepted by the client.
+func withCompression(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !compress_downloads || r.Method != "GET" || !acceptsGzip(r) {
+			handler(w, r)
+			return
+		}
+
+		g := &gzipResponseWriter{ResponseWriter: w}
+		defer g.Close()
+		handler(g, r)
+	}
+}
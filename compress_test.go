@@ -0,0 +1,32 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGzipDropsIdentityChecksums(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	g := &gzipResponseWriter{ResponseWriter: recorder}
+
+	g.Header().Set("Content-Type", "text/plain")
+	g.Header().Set("ETag", `"abc"`)
+	g.Header().Set("Digest", "SHA-256=47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=")
+	g.Header().Set("Content-MD5", "1B2M2Y8AsgTpgAmY7PhCfg==")
+	g.WriteHeader(http.StatusOK)
+	g.Write([]byte(strings.Repeat("seafile ", COMPRESS_MIN_SIZE)))
+	g.Close()
+
+	header := recorder.Header()
+	if header.Get("Content-Encoding") != "gzip" {
+		t.Fatal("Response wasn't compressed")
+	}
+	if header.Get("Digest") != "" || header.Get("Content-MD5") != "" {
+		t.Errorf("Checksums of identity body were kept: %v", header)
+	}
+	if header.Get("ETag") != `W/"abc"` {
+		t.Errorf("ETag should be weak, got %s", header.Get("ETag"))
+	}
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/lazureykis/dotenv"
+	"log"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Where configuration value came from.
+const (
+	CONFIG_SOURCE_ENV     = "env"
+	CONFIG_SOURCE_FILE    = "file"
+	CONFIG_SOURCE_DEFAULT = "default"
+	CONFIG_SOURCE_FLAG    = "flag"
+)
+
+// Effective configuration value for the startup audit and /admin/config.
+type ConfigEntry struct {
+	Name    string `json:"name"`
+	Value   string `json:"value"`
+	Source  string `json:"source"`
+	Secret  bool   `json:"secret,omitempty"`
+	Profile string `json:"profile,omitempty"`
+}
+
+var (
+	// Variables set in the process environment before .env was loaded.
+	env_config_keys = make(map[string]bool)
+
+	// Variables added by .env file.
+	file_config_keys = make(map[string]bool)
+
+	// Variables read so far, in order.
+	config_entries []ConfigEntry
+
+	// Selected profile, its keys are prefixed with upper-cased name: STAGING_SEAFILE_URL.
+	config_profile string
+)
+
+// Loads .env file remembering which variables were already set by the environment.
+func loadConfigSources() {
+	for _, pair := range os.Environ() {
+		env_config_keys[strings.SplitN(pair, "=", 2)[0]] = true
+	}
+
+	dotenv.Go()
+
+	for _, pair := range os.Environ() {
+		name := strings.SplitN(pair, "=", 2)[0]
+		if !env_config_keys[name] {
+			file_config_keys[name] = true
+		}
+	}
+}
+
+// Removes --profile name (or --profile=name) from command line arguments,
+// so commands can parse their own flags.
+func profileFromArgs() string {
+	profile := ""
+	args := []string{os.Args[0]}
+
+	for i := 1; i < len(os.Args); i++ {
+		arg := os.Args[i]
+
+		switch {
+		case arg == "--profile" || arg == "-profile":
+			if i+1 < len(os.Args) {
+				profile = os.Args[i+1]
+				i++
+			}
+		case strings.HasPrefix(arg, "--profile="), strings.HasPrefix(arg, "-profile="):
+			profile = strings.SplitN(arg, "=", 2)[1]
+		default:
+			args = append(args, arg)
+		}
+	}
+
+	os.Args = args
+	return profile
+}
+
+// Selects profile given by --profile flag or SEAFILE_PROFILE variable.
+// Profile keys (PROD_SEAFILE_URL, PROD_SEAFILE_TOKEN...) override plain ones.
+func selectConfigProfile() {
+	if profile := profileFromArgs(); profile != "" {
+		config_profile = profile
+		config_entries = append(config_entries, ConfigEntry{Name: "SEAFILE_PROFILE", Value: profile, Source: CONFIG_SOURCE_FLAG})
+	} else {
+		config_profile = configValue("SEAFILE_PROFILE", "")
+	}
+
+	if config_profile == "" {
+		return
+	}
+
+	for _, c := range config_profile {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			log.Fatalln("Invalid profile name, only letters and digits are allowed:", config_profile)
+		}
+	}
+
+	prefix := profileConfigKey("SEAFILE_")
+	for _, pair := range os.Environ() {
+		if strings.HasPrefix(pair, prefix) {
+			return
+		}
+	}
+
+	log.Fatalln("Unknown profile " + config_profile + ": no " + prefix + "* keys configured.")
+}
+
+// Name of the key in the selected profile.
+func profileConfigKey(name string) string {
+	return strings.ToUpper(config_profile) + "_" + name
+}
+
+func readConfig(name, default_value string, secret bool) string {
+	key, profile := name, ""
+	if config_profile != "" {
+		if _, ok := os.LookupEnv(profileConfigKey(name)); ok {
+			key, profile = profileConfigKey(name), config_profile
+		}
+	}
+
+	value, ok := os.LookupEnv(key)
+
+	source := CONFIG_SOURCE_FILE
+	if env_config_keys[key] {
+		source = CONFIG_SOURCE_ENV
+	}
+
+	if !ok || value == "" {
+		value = default_value
+		source = CONFIG_SOURCE_DEFAULT
+	}
+
+	config_entries = append(config_entries, ConfigEntry{Name: name, Value: value, Source: source, Secret: secret, Profile: profile})
+	return value
+}
+
+// Reads configuration variable, falling back to default_value when it is blank.
+func configValue(name, default_value string) string {
+	return readConfig(name, default_value, false)
+}
+
+// Same as configValue but the value is masked in the configuration audit.
+func secretConfigValue(name string) string {
+	return readConfig(name, "", true)
+}
+
+// Effective configuration with secrets masked.
+func ConfigAudit() []ConfigEntry {
+	entries := make([]ConfigEntry, len(config_entries))
+
+	for i, entry := range config_entries {
+		if entry.Secret && entry.Value != "" {
+			entry.Value = "********"
+		}
+		entries[i] = entry
+	}
+
+	return entries
+}
+
+// Finds keys in .env file and SEAFILE_* environment variables which were never read.
+// Returns warnings with suggestions for misspelled keys.
+func UnknownConfigKeys() []string {
+	known := make(map[string]bool)
+	for _, entry := range config_entries {
+		known[entry.Name] = true
+	}
+
+	candidates := make(map[string]string)
+	for name := range file_config_keys {
+		candidates[name] = CONFIG_SOURCE_FILE
+	}
+	for name := range env_config_keys {
+		if strings.HasPrefix(name, "SEAFILE_") {
+			candidates[name] = CONFIG_SOURCE_ENV
+		}
+	}
+
+	var warnings []string
+	for name, source := range candidates {
+		if known[name] {
+			continue
+		}
+
+		// Keys of other profiles: STAGING_SEAFILE_URL.
+		if i := strings.Index(name, "_SEAFILE_"); i > 0 && known[name[i+1:]] {
+			continue
+		}
+
+		warning := "Unknown config key " + name + " (" + source + ")"
+		if suggestion := closestConfigKey(name, known); suggestion != "" {
+			warning += ", did you mean " + suggestion + "?"
+		}
+		warnings = append(warnings, warning)
+	}
+
+	sort.Strings(warnings)
+	return warnings
+}
+
+// Known key within small edit distance of name, if any.
+func closestConfigKey(name string, known map[string]bool) string {
+	best, best_distance := "", 4
+	for key := range known {
+		if d := editDistance(name, key); d < best_distance {
+			best, best_distance = key, d
+		}
+	}
+	return best
+}
+
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = previous[j] + 1
+			if current[j-1]+1 < current[j] {
+				current[j] = current[j-1] + 1
+			}
+			if previous[j-1]+cost < current[j] {
+				current[j] = previous[j-1] + cost
+			}
+		}
+		previous, current = current, previous
+	}
+
+	return previous[len(b)]
+}
+
+// Warns about unknown config keys and refuses to start on them in strict mode.
+func checkUnknownConfigKeys(strict bool) {
+	warnings := UnknownConfigKeys()
+	for _, warning := range warnings {
+		log.Println(warning)
+	}
+
+	if strict && len(warnings) > 0 {
+		log.Fatalln("Refusing to start with unknown config keys (SEAFILE_STRICT_CONFIG is on).")
+	}
+}
+
+func logConfigAudit() {
+	data, err := json.Marshal(ConfigAudit())
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	log.Println("Configuration:", string(data))
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"bufio"
+	"mime"
+	"net/http"
+	"path/filepath"
+)
+
+// Content type by file extension, empty when unknown.
+func contentTypeByExtension(path string) string {
+	return mime.TypeByExtension(filepath.Ext(path))
+}
+
+// Detects content type from the extension, falling back to sniffing first 512
+// bytes of the body. Body may be nil when it's not the beginning of the file.
+func detectContentType(path string, body *bufio.Reader) string {
+	if content_type := contentTypeByExtension(path); content_type != "" {
+		return content_type
+	}
+
+	if body != nil {
+		// Peek returns what's available with an error for short files.
+		head, _ := body.Peek(512)
+		if len(head) > 0 {
+			return http.DetectContentType(head)
+		}
+	}
+
+	return "application/octet-stream"
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// Digests kept, the least recently used ones are forgotten.
+const MAX_CONTENT_DIGESTS = 10000
+
+// SHA-256 of file contents known by Seafile file id.
+// Filled by uploads and by hashing downloaded files, so the same existing
+// file is downloaded for comparison at most once.
+var (
+	content_digests       = make(map[string]*list.Element)
+	content_digests_order = list.New() // front is the most recently used
+	content_digests_mutex sync.Mutex
+)
+
+type contentDigest struct {
+	file_id string
+	digest  string
+}
+
+func rememberContentDigest(file_id, digest string) {
+	if file_id == "" {
+		return
+	}
+
+	content_digests_mutex.Lock()
+	defer content_digests_mutex.Unlock()
+
+	if element, ok := content_digests[file_id]; ok {
+		element.Value.(*contentDigest).digest = digest
+		content_digests_order.MoveToFront(element)
+		return
+	}
+
+	content_digests[file_id] = content_digests_order.PushFront(&contentDigest{file_id: file_id, digest: digest})
+
+	for content_digests_order.Len() > MAX_CONTENT_DIGESTS {
+		oldest := content_digests_order.Back()
+		content_digests_order.Remove(oldest)
+		delete(content_digests, oldest.Value.(*contentDigest).file_id)
+	}
+}
+
+func knownContentDigest(file_id string) (string, bool) {
+	content_digests_mutex.Lock()
+	defer content_digests_mutex.Unlock()
+
+	element, ok := content_digests[file_id]
+	if !ok {
+		return "", false
+	}
+
+	content_digests_order.MoveToFront(element)
+	return element.Value.(*contentDigest).digest, true
+}
+
+// Checks whether existing file at path has the same content as the upload.
+// Sizes are compared first, then SHA-256 digests.
+func sameContent(fileDigest func() (string, int64, error), path string, existing FileSpec) (bool, error) {
+	digest, size, err := fileDigest()
+	if err != nil {
+		return false, err
+	}
+
+	if size != existing.Size {
+		return false, nil
+	}
+
+	existing_digest, ok := knownContentDigest(existing.Id)
+	if !ok {
+		existing_digest, err = hashRemoteFile(path)
+		if err != nil {
+			return false, err
+		}
+		rememberContentDigest(existing.Id, existing_digest)
+	}
+
+	return digest == existing_digest, nil
+}
+
+// Downloads the file from Seafile and computes its SHA-256.
+func hashRemoteFile(path string) (string, error) {
+	link, err := GetDownloadFileLink(path)
+	if err != nil {
+		return "", err
+	}
+
+	resp, _, err := fileServerGet(link, nil, nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.New("Cannot download " + path + ": " + resp.Status)
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, resp.Body); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestContentDigestsAreBounded(t *testing.T) {
+	rememberContentDigest("id0", "digest")
+	rememberContentDigest("id1", "digest")
+	knownContentDigest("id0")
+	for i := 2; i <= MAX_CONTENT_DIGESTS; i++ {
+		rememberContentDigest("id"+strconv.Itoa(i), "digest")
+	}
+
+	if len(content_digests) != MAX_CONTENT_DIGESTS {
+		t.Errorf("%d digests are kept, want %d", len(content_digests), MAX_CONTENT_DIGESTS)
+	}
+	if _, ok := knownContentDigest("id1"); ok {
+		t.Error("Least recently used digest is kept")
+	}
+	if _, ok := knownContentDigest("id0"); !ok {
+		t.Error("Recently used digest is forgotten")
+	}
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+const (
+	DIAGNOSTICS_TIMEOUT = 10 * time.Second
+
+	// Local folders with less free space fail the disk check.
+	DIAGNOSTICS_MIN_FREE = 1 << 30
+
+	// Certificates expiring sooner are reported.
+	DIAGNOSTICS_CERT_WARNING = 14 * 24 * time.Hour
+)
+
+// Result of one live check: pass, warn, fail or skip.
+type DiagnosticCheck struct {
+	Name     string            `json:"name"`
+	Status   string            `json:"status"`
+	Message  string            `json:"message,omitempty"`
+	Details  map[string]string `json:"details,omitempty"`
+	Duration string            `json:"duration"`
+}
+
+type DiagnosticsReport struct {
+	OK     bool              `json:"ok"`
+	Time   string            `json:"time"`
+	Checks []DiagnosticCheck `json:"checks"`
+}
+
+// Check outcome other than pass or fail.
+var (
+	errDiagnosticSkipped = errors.New("skip")
+	errDiagnosticWarning = errors.New("warn")
+)
+
+type diagnostic struct {
+	name string
+	run  func(details map[string]string) (string, error)
+}
+
+var diagnostics = []diagnostic{
+	{"dns", diagnoseDNS},
+	{"tls", diagnoseTLS},
+	{"auth", diagnoseAuth},
+	{"upload_link", diagnoseUploadLink},
+	{"cache", diagnoseCache},
+	{"disk", diagnoseDisk},
+}
+
+// Runs every check, they are independent so a failed one doesn't stop the rest.
+func RunDiagnostics() DiagnosticsReport {
+	report := DiagnosticsReport{OK: true, Time: time.Now().UTC().Format(time.RFC3339)}
+
+	for _, d := range diagnostics {
+		start := time.Now()
+		details := make(map[string]string)
+		message, err := d.run(details)
+
+		check := DiagnosticCheck{Name: d.name, Status: "pass", Message: message, Details: details}
+		switch {
+		case err == errDiagnosticSkipped:
+			check.Status = "skip"
+		case err == errDiagnosticWarning:
+			check.Status = "warn"
+		case err != nil:
+			check.Status = "fail"
+			check.Message = err.Error()
+			report.OK = false
+		}
+		check.Duration = time.Since(start).Round(time.Millisecond).String()
+		if len(check.Details) == 0 {
+			check.Details = nil
+		}
+
+		report.Checks = append(report.Checks, check)
+	}
+
+	return report
+}
+
+func seafileHost() (*url.URL, error) {
+	seafile, err := url.Parse(seafile_url)
+	if err != nil {
+		return nil, err
+	}
+	if seafile.Hostname() == "" {
+		return nil, errors.New("SEAFILE_URL has no host: " + seafile_url)
+	}
+	return seafile, nil
+}
+
+func diagnoseDNS(details map[string]string) (string, error) {
+	seafile, err := seafileHost()
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), DIAGNOSTICS_TIMEOUT)
+	defer cancel()
+
+	addrs, err := net.DefaultResolver.LookupHost(ctx, seafile.Hostname())
+	if err != nil {
+		return "", err
+	}
+
+	details["host"] = seafile.Hostname()
+	return fmt.Sprintf("%s resolves to %v", seafile.Hostname(), addrs), nil
+}
+
+// Verifies certificate chain of Seafile like any request does, and its expiry.
+func diagnoseTLS(details map[string]string) (string, error) {
+	seafile, err := seafileHost()
+	if err != nil {
+		return "", err
+	}
+	if seafile.Scheme != "https" {
+		return "Seafile is not reached over https", errDiagnosticSkipped
+	}
+
+	port := seafile.Port()
+	if port == "" {
+		port = "443"
+	}
+
+	dialer := &net.Dialer{Timeout: DIAGNOSTICS_TIMEOUT}
+	conn, err := tls.DialWithDialer(dialer, "tcp", net.JoinHostPort(seafile.Hostname(), port), &tls.Config{ServerName: seafile.Hostname()})
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	certificate := conn.ConnectionState().PeerCertificates[0]
+	details["subject"] = certificate.Subject.CommonName
+	details["issuer"] = certificate.Issuer.CommonName
+	details["expires"] = certificate.NotAfter.UTC().Format(time.RFC3339)
+
+	if time.Until(certificate.NotAfter) < DIAGNOSTICS_CERT_WARNING {
+		return "Certificate expires on " + details["expires"], errDiagnosticWarning
+	}
+
+	return "Certificate chain is valid", nil
+}
+
+func diagnoseAuth(details map[string]string) (string, error) {
+	if err := PingAuth(); err != nil {
+		return "", err
+	}
+
+	return "Token is accepted", nil
+}
+
+// Fetches a fresh upload link, the cached one may hide a broken file server.
+func diagnoseUploadLink(details map[string]string) (string, error) {
+	repos := ConfiguredRepos()
+	if len(repos) == 0 {
+		return "", errors.New("No library is configured")
+	}
+
+	for _, repo_id := range repos {
+		if _, err := clientFor(repo_id).UploadLink(repo_id, ""); err != nil {
+			return "", fmt.Errorf("Library %s: %v", repo_id, err)
+		}
+	}
+
+	details["libraries"] = fmt.Sprint(len(repos))
+	return "Upload links are issued", nil
+}
+
+func diagnoseCache(details map[string]string) (string, error) {
+	if download_cache == nil {
+		return "Download cache is disabled", errDiagnosticSkipped
+	}
+
+	details["dir"] = download_cache.dir
+
+	file, err := ioutil.TempFile(download_cache.dir, CACHE_TMP_PREFIX)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(file.Name())
+
+	probe := []byte("seafile-uploader diagnostics " + newUUID())
+	_, err = file.Write(probe)
+	if close_err := file.Close(); err == nil {
+		err = close_err
+	}
+	if err != nil {
+		return "", err
+	}
+
+	data, err := ioutil.ReadFile(file.Name())
+	if err != nil {
+		return "", err
+	}
+	if string(data) != string(probe) {
+		return "", errors.New("Cache file reads back different content")
+	}
+
+	return "Cache is writable", nil
+}
+
+// Free space of local folders: temporary files of uploads, caches and snapshots.
+func diagnoseDisk(details map[string]string) (string, error) {
+	folders := map[string]string{"temp": os.TempDir()}
+	if download_cache != nil {
+		folders["cache"] = download_cache.dir
+	}
+	if snapshot_dir != "" {
+		folders["snapshot"] = snapshot_dir
+	}
+	if quarantine_dir != "" {
+		folders["quarantine"] = quarantine_dir
+	}
+
+	var low []string
+	for name, folder := range folders {
+		free, err := freeDiskSpace(folder)
+		if err == errDiagnosticSkipped {
+			return "Free space can't be measured on this platform", err
+		}
+		if err != nil {
+			return "", fmt.Errorf("%s %s: %v", name, folder, err)
+		}
+
+		details[name] = fmt.Sprintf("%s: %d MB free", folder, free>>20)
+		if free < DIAGNOSTICS_MIN_FREE {
+			low = append(low, folder)
+		}
+	}
+
+	if len(low) > 0 {
+		return "", fmt.Errorf("Less than %d MB free in %v", DIAGNOSTICS_MIN_FREE>>20, low)
+	}
+
+	return "Enough free space", nil
+}
+
+// GET /admin/diagnostics runs live checks of Seafile and local resources.
+// Answers 503 when any check fails, so it works with curl --fail.
+func adminDiagnosticsHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println(r.Method, r.RequestURI)
+
+	if !adminAuthorized(r, ROLE_VIEWER) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	report := RunDiagnostics()
+
+	status := http.StatusOK
+	if !report.OK {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, report)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"time"
+)
+
+// Direct upload instructions: client posts multipart form to Link itself,
+// so large files don't pass through the proxy.
+type DirectUpload struct {
+	Link      string            `json:"upload_link"`
+	Method    string            `json:"method"`
+	FileField string            `json:"file_field"`
+	Fields    map[string]string `json:"fields"`
+}
+
+// Gets fresh (not cached) upload link restricted to the folder.
+func GetFolderUploadLink(folder string) (string, error) {
+	repo_id, repo_folder := RouteRepo(folder)
+	return clientFor(repo_id).UploadLink(repo_id, repo_folder)
+}
+
+// GET /upload-link?folder=/foo/ returns short-lived Seafile upload link and form fields.
+func uploadLinkHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println(r.Method, r.RequestURI)
+
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	api_key, ok := AuthenticateAPIKey(r)
+	if !ok {
+		http.Error(w, "Invalid API key", http.StatusUnauthorized)
+		return
+	}
+
+	if err := checkUploadWindow(api_key, time.Now()); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	if refuseInMaintenance(w) {
+		return
+	}
+
+	folder := r.URL.Query().Get("folder")
+	if folder == "" {
+		folder = default_folder
+	}
+
+	// {filename_ext} is unknown until the client picks a file.
+	vars := folderVariables(time.Now().Format("2006-01-02"), newUUID(), api_key, "")
+	delete(vars, "filename_ext")
+
+	dir, err := ExpandFolder(folder, vars)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err, _, dir_exist := IsDirectoryExist(dir)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if !dir_exist {
+		if err := CreateDirectory(dir); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	link, err := GetFolderUploadLink(dir)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	_, repo_folder := RouteRepo(dir)
+
+	writeJSON(w, http.StatusOK, DirectUpload{
+		Link:      link + "?ret-json=1",
+		Method:    "POST",
+		FileField: "file",
+		Fields:    map[string]string{"parent_dir": repo_folder},
+	})
+}
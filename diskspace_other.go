@@ -0,0 +1,8 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package main
+
+func freeDiskSpace(dir string) (int64, error) {
+	return 0, errDiagnosticSkipped
+}
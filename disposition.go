@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Sets Content-Disposition: attachment for ?download=1 or ?filename=name.ext
+// so browsers save the file instead of rendering it.
+func setContentDisposition(w http.ResponseWriter, r *http.Request, file_path string) {
+	query := r.URL.Query()
+	filename := query.Get("filename")
+	download, _ := strconv.ParseBool(query.Get("download"))
+
+	if filename == "" && !download {
+		return
+	}
+
+	if filename == "" {
+		filename = path.Base(file_path)
+	}
+
+	w.Header().Set("Content-Disposition", contentDisposition("attachment", filename))
+}
+
+// Builds disposition with ASCII fallback filename and RFC 5987 encoded filename*.
+func contentDisposition(disposition, filename string) string {
+	fallback := strings.Map(func(r rune) rune {
+		if r < 0x20 || r > 0x7e || r == '"' || r == '\\' {
+			return '_'
+		}
+		return r
+	}, filename)
+
+	return fmt.Sprintf(`%s; filename="%s"; filename*=UTF-8''%s`, disposition, fallback, rfc5987Escape(filename))
+}
+
+// Percent-encodes everything except RFC 5987 attr-char.
+func rfc5987Escape(s string) string {
+	var b strings.Builder
+
+	for _, c := range []byte(s) {
+		if ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') || strings.IndexByte("!#$&+-.^_`|~", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+
+	return b.String()
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// Every /api/v1 response is an envelope: {"data": ...} on success,
+// {"error": {"code": "not_found", "message": "..."}} on failure.
+// Request parameters may be sent as query, form or JSON object.
+// JSON array bodies are left to the handler.
+type APIResponse struct {
+	Data     interface{} `json:"data,omitempty"`
+	Error    *APIError   `json:"error,omitempty"`
+	Warnings []string    `json:"warnings,omitempty"`
+}
+
+type APIError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type apiContextKey struct{}
+
+// Whether request came through /api/v1, including aliases of /upload and /get/.
+func isAPIRequest(r *http.Request) bool {
+	api, _ := r.Context().Value(apiContextKey{}).(bool)
+	return api
+}
+
+// Error code derived from the status: 404 is "not_found", 412 is "precondition_failed".
+func apiErrorCode(status int) string {
+	text := http.StatusText(status)
+	if text == "" {
+		return "error"
+	}
+	return strings.ToLower(strings.Replace(strings.Replace(text, " ", "_", -1), "-", "_", -1))
+}
+
+func writeAPI(w http.ResponseWriter, status int, data interface{}) {
+	writeJSON(w, status, APIResponse{Data: data})
+}
+
+func writeAPIError(w http.ResponseWriter, status int, message string) {
+	status = seafileErrorStatus(w, status)
+	writeJSON(w, status, APIResponse{Error: &APIError{Code: apiErrorCode(status), Message: message}})
+}
+
+// Turns plain text errors of shared handlers (http.Error, bare status codes)
+// into error envelopes. Successful responses pass through untouched.
+type apiResponseWriter struct {
+	http.ResponseWriter
+	wrote_header bool
+	error_status int
+	error_body   bytes.Buffer
+}
+
+func (a *apiResponseWriter) WriteHeader(status int) {
+	if a.wrote_header {
+		return
+	}
+	a.wrote_header = true
+
+	if status >= 400 && !strings.HasPrefix(a.Header().Get("Content-Type"), "application/json") {
+		a.error_status = status
+		return
+	}
+
+	a.ResponseWriter.WriteHeader(status)
+}
+
+func (a *apiResponseWriter) Write(p []byte) (int, error) {
+	if !a.wrote_header {
+		a.WriteHeader(http.StatusOK)
+	}
+
+	if a.error_status != 0 {
+		return a.error_body.Write(p)
+	}
+
+	return a.ResponseWriter.Write(p)
+}
+
+func (a *apiResponseWriter) Flush() {
+	if a.error_status != 0 {
+		return
+	}
+
+	if f, ok := a.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (a *apiResponseWriter) finish() {
+	if a.error_status == 0 {
+		return
+	}
+
+	message := strings.TrimSpace(a.error_body.String())
+	if message == "" {
+		message = http.StatusText(a.error_status)
+	}
+
+	a.Header().Del("Content-Type")
+	writeAPIError(a.ResponseWriter, a.error_status, message)
+}
+
+// Limit of JSON body, same as net/http uses for url-encoded forms.
+var MAX_JSON_BODY_SIZE int64 = 10 << 20 // 10MB
+
+var errJSONBodyTooLarge = errors.New("JSON body is too large")
+
+// Merges JSON object body into r.Form, so handlers read parameters with r.FormValue
+// whatever way they were sent.
+func parseJSONParams(w http.ResponseWriter, r *http.Request) error {
+	r.Form = r.URL.Query()
+
+	data, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, MAX_JSON_BODY_SIZE))
+	if err != nil {
+		if int64(len(data)) >= MAX_JSON_BODY_SIZE {
+			return errJSONBodyTooLarge
+		}
+		return err
+	}
+
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		r.Body = ioutil.NopCloser(bytes.NewReader(data))
+		return nil
+	}
+
+	var params map[string]interface{}
+	if err := json.Unmarshal(data, &params); err != nil {
+		return err
+	}
+
+	for key, value := range params {
+		switch value := value.(type) {
+		case string:
+			r.Form.Set(key, value)
+		case nil:
+		default:
+			data, _ := json.Marshal(value)
+			r.Form.Set(key, string(data))
+		}
+	}
+
+	return nil
+}
+
+// Wraps /api/v1 handler.
+func apiHandler(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r = r.WithContext(context.WithValue(r.Context(), apiContextKey{}, true))
+
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") && r.Method != "GET" && r.Method != "HEAD" {
+			if err := parseJSONParams(w, r); err == errJSONBodyTooLarge {
+				writeAPIError(w, http.StatusRequestEntityTooLarge, err.Error())
+				return
+			} else if err != nil {
+				writeAPIError(w, http.StatusBadRequest, "Invalid JSON body: "+err.Error())
+				return
+			}
+		}
+
+		if err := validateAPIRequest(r); err != nil {
+			writeAPIError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		aw := &apiResponseWriter{ResponseWriter: w}
+		handler(aw, r)
+		aw.finish()
+	}
+}
+
+// Serves /api/v1/upload and /api/v1/get/... with the handlers of /upload and /get/.
+func apiAlias(handler http.HandlerFunc) http.HandlerFunc {
+	return apiHandler(func(w http.ResponseWriter, r *http.Request) {
+		aliased := r.Clone(r.Context())
+		aliased.URL.Path = strings.TrimPrefix(r.URL.Path, "/api/v1")
+		aliased.URL.RawPath = strings.TrimPrefix(r.URL.RawPath, "/api/v1")
+		aliased.RequestURI = strings.TrimPrefix(r.RequestURI, "/api/v1")
+
+		handler(w, aliased)
+	})
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+)
+
+var (
+	jpegSignature = []byte{0xFF, 0xD8}
+	pngSignature  = []byte{0x89, 'P', 'N', 'G', '\r', '\n', 0x1A, '\n'}
+
+	// JPEG APPn segments carrying EXIF/XMP (APP1) and IPTC (APP13) metadata.
+	jpegMetadataMarkers = map[byte]bool{0xE1: true, 0xED: true}
+
+	// PNG ancillary chunks carrying EXIF and textual metadata.
+	pngMetadataChunks = map[string]bool{"eXIf": true, "tEXt": true, "zTXt": true, "iTXt": true}
+)
+
+// Removes EXIF/GPS metadata from JPEG and PNG images.
+// Other content is returned untouched. Note that EXIF orientation is dropped too.
+func StripImageMetadata(src io.Reader) (io.Reader, error) {
+	data, err := ioutil.ReadAll(src)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case bytes.HasPrefix(data, jpegSignature):
+		data, err = stripJPEGMetadata(data)
+	case bytes.HasPrefix(data, pngSignature):
+		data, err = stripPNGMetadata(data)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return bytes.NewReader(data), nil
+}
+
+func stripJPEGMetadata(data []byte) ([]byte, error) {
+	result := &bytes.Buffer{}
+	result.Write(jpegSignature)
+
+	pos := len(jpegSignature)
+	for pos < len(data) {
+		if data[pos] != 0xFF || pos+1 >= len(data) {
+			return nil, errors.New("Invalid JPEG segment")
+		}
+
+		marker := data[pos+1]
+
+		// Start of scan: the rest is compressed image data.
+		if marker == 0xDA {
+			result.Write(data[pos:])
+			break
+		}
+
+		// Markers without payload.
+		if marker == 0x01 || (marker >= 0xD0 && marker <= 0xD9) || marker == 0xFF {
+			result.Write(data[pos : pos+2])
+			pos += 2
+			continue
+		}
+
+		if pos+4 > len(data) {
+			return nil, errors.New("Truncated JPEG segment")
+		}
+
+		segment_end := pos + 2 + int(binary.BigEndian.Uint16(data[pos+2:pos+4]))
+		if segment_end > len(data) {
+			return nil, errors.New("Truncated JPEG segment")
+		}
+
+		if !jpegMetadataMarkers[marker] {
+			result.Write(data[pos:segment_end])
+		}
+
+		pos = segment_end
+	}
+
+	return result.Bytes(), nil
+}
+
+func stripPNGMetadata(data []byte) ([]byte, error) {
+	result := &bytes.Buffer{}
+	result.Write(pngSignature)
+
+	pos := len(pngSignature)
+	for pos < len(data) {
+		if pos+8 > len(data) {
+			return nil, errors.New("Truncated PNG chunk")
+		}
+
+		// length + type + data + crc
+		chunk_end := pos + 12 + int(binary.BigEndian.Uint32(data[pos:pos+4]))
+		if chunk_end > len(data) {
+			return nil, errors.New("Truncated PNG chunk")
+		}
+
+		if !pngMetadataChunks[string(data[pos+4:pos+8])] {
+			result.Write(data[pos:chunk_end])
+		}
+
+		pos = chunk_end
+	}
+
+	return result.Bytes(), nil
+}
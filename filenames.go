@@ -0,0 +1,86 @@
+package main
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"golang.org/x/text/unicode/norm"
+	"path"
+	"strings"
+	"unicode"
+)
+
+// What to do when uploaded file name already exists in target folder.
+const (
+	COLLISION_SKIP        = "skip"
+	COLLISION_OVERWRITE   = "overwrite"
+	COLLISION_RENAME      = "rename"
+	COLLISION_RENAME_UUID = "rename-uuid"
+)
+
+var collision_policies = []string{COLLISION_SKIP, COLLISION_OVERWRITE, COLLISION_RENAME, COLLISION_RENAME_UUID}
+
+// Normalizes filename to unicode NFC and strips control characters.
+// Names with path separators or pointing to directories are rejected.
+func SanitizeFilename(filename string) (string, error) {
+	filename = norm.NFC.String(filename)
+
+	filename = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, filename)
+
+	filename = strings.TrimSpace(filename)
+
+	if strings.ContainsAny(filename, "/\\") {
+		return "", errors.New("Invalid filename: " + filename)
+	}
+
+	if filename == "" || filename == "." || filename == ".." {
+		return "", errors.New("Invalid filename: " + filename)
+	}
+
+	return filename, nil
+}
+
+// Decides under which name file should be stored according to collision policy.
+// Returns target name, whether existing file must be replaced and whether file should be skipped.
+func ResolveCollision(policy, filename string, existing []string) (target string, replace bool, skip bool) {
+	if !stringInSlice(filename, existing) {
+		return filename, false, false
+	}
+
+	ext := path.Ext(filename)
+	base := strings.TrimSuffix(filename, ext)
+
+	switch policy {
+	case COLLISION_OVERWRITE:
+		return filename, true, false
+	case COLLISION_RENAME:
+		for i := 1; ; i++ {
+			target = fmt.Sprintf("%s (%d)%s", base, i, ext)
+			if !stringInSlice(target, existing) {
+				return target, false, false
+			}
+		}
+	case COLLISION_RENAME_UUID:
+		return base + "-" + newUUID() + ext, false, false
+	default:
+		return filename, false, true
+	}
+}
+
+// Random (version 4) UUID.
+func newUUID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
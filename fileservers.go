@@ -0,0 +1,275 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const FILE_SERVER_PROBE_TIMEOUT = 5 * time.Second
+
+// Path segments where Seafile file server links start, whatever the root they are served from.
+var file_server_paths = []string{"/files/", "/upload-api/", "/upload-aj/", "/update-api/", "/zip/"}
+
+// One of several endpoints of the Seafile file server (seafhttp). Links issued by
+// Seafile are valid on all of them, so transfers go to the healthy one with the best
+// score: probed latency multiplied by configured cost.
+type FileServer struct {
+	base *url.URL
+	cost float64
+
+	mutex   sync.Mutex
+	healthy bool
+	latency time.Duration
+}
+
+var (
+	file_servers               []*FileServer
+	file_server_probe_interval time.Duration
+)
+
+// Parses SEAFILE_FILE_SERVERS value: "http://fs1:8082,http://fs2:8082=2.5" (optional cost, 1 by default).
+func ParseFileServers(spec string) ([]*FileServer, error) {
+	var servers []*FileServer
+
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		cost := 1.0
+		if i := strings.LastIndex(entry, "="); i > 0 {
+			value, err := strconv.ParseFloat(entry[i+1:], 64)
+			if err != nil || value <= 0 {
+				return nil, errors.New("Invalid file server cost: " + entry)
+			}
+			cost, entry = value, entry[:i]
+		}
+
+		base, err := url.Parse(strings.TrimRight(entry, "/"))
+		if err != nil || base.Host == "" || base.Scheme != "http" && base.Scheme != "https" {
+			return nil, errors.New("Invalid file server URL: " + entry)
+		}
+
+		servers = append(servers, &FileServer{base: base, cost: cost, healthy: true})
+	}
+
+	return servers, nil
+}
+
+func (s *FileServer) String() string {
+	return s.base.String()
+}
+
+func (s *FileServer) score() (float64, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.latency.Seconds() * s.cost, s.healthy
+}
+
+func (s *FileServer) setHealthy(healthy bool, latency time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if healthy != s.healthy {
+		if healthy {
+			log.Println("File server", s, "is up")
+		} else {
+			log.Println("File server", s, "is down")
+		}
+	}
+	s.healthy = healthy
+
+	if healthy {
+		// Smoothed, so a single slow probe doesn't move all transfers around.
+		if s.latency == 0 {
+			s.latency = latency
+		} else {
+			s.latency = (s.latency*7 + latency*3) / 10
+		}
+	}
+}
+
+// Best server except the excluded ones, nil when there is none.
+// Servers marked down are used only when nothing else is left.
+func pickFileServer(exclude ...*FileServer) *FileServer {
+	var best, fallback *FileServer
+	var best_score float64
+
+	for _, server := range file_servers {
+		excluded := false
+		for _, e := range exclude {
+			if e == server {
+				excluded = true
+			}
+		}
+		if excluded {
+			continue
+		}
+
+		score, healthy := server.score()
+		if !healthy {
+			if fallback == nil {
+				fallback = server
+			}
+			continue
+		}
+
+		if best == nil || score < best_score {
+			best, best_score = server, score
+		}
+	}
+
+	if best == nil {
+		return fallback
+	}
+	return best
+}
+
+// Points Seafile file server link to the server. Unknown links are left as they are.
+func routeFileServerLink(link string, server *FileServer) string {
+	if server == nil {
+		return link
+	}
+
+	u, err := url.Parse(link)
+	if err != nil {
+		return link
+	}
+
+	for _, segment := range file_server_paths {
+		if i := strings.Index(u.Path, segment); i >= 0 {
+			routed := *server.base
+			routed.Path = server.base.Path + u.Path[i:]
+			routed.RawPath = ""
+			routed.RawQuery = u.RawQuery
+			return routed.String()
+		}
+	}
+
+	return link
+}
+
+// Requests link with GET, starting at server (nil picks the best one) and failing over
+// to other servers when it can't be reached. Returns the server which answered,
+// so the rest of the transfer sticks to it.
+func fileServerGet(link string, header http.Header, server *FileServer) (*http.Response, *FileServer, error) {
+	if len(file_servers) == 0 {
+		req, err := http.NewRequest("GET", link, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		copyHeader(req.Header, header)
+
+		resp, err := http.DefaultClient.Do(req)
+		return resp, nil, err
+	}
+
+	if server == nil {
+		server = pickFileServer()
+	}
+
+	var tried []*FileServer
+	for {
+		req, err := http.NewRequest("GET", routeFileServerLink(link, server), nil)
+		if err != nil {
+			return nil, server, err
+		}
+		copyHeader(req.Header, header)
+
+		resp, err := http.DefaultClient.Do(req)
+		if err == nil {
+			return resp, server, nil
+		}
+
+		server.setHealthy(false, 0)
+		tried = append(tried, server)
+
+		next := pickFileServer(tried...)
+		if next == nil {
+			return nil, server, err
+		}
+
+		log.Println("File server", server, "failed:", err, "- switching to", next)
+		server = next
+	}
+}
+
+func copyHeader(dst, src http.Header) {
+	for name, values := range src {
+		for _, value := range values {
+			dst.Add(name, value)
+		}
+	}
+}
+
+// Posts body built by new_body to link, failing over to other servers the same way.
+// new_body returns nil when the body can't be sent again, like a streamed one.
+func fileServerPost(link string, new_body func() io.Reader, content_length int64, header http.Header) (*http.Response, error) {
+	server := pickFileServer()
+	body := new_body()
+
+	var tried []*FileServer
+	for {
+		req, err := http.NewRequest("POST", routeFileServerLink(link, server), body)
+		if err != nil {
+			return nil, err
+		}
+		req.ContentLength = content_length
+		copyHeader(req.Header, header)
+
+		resp, err := http.DefaultClient.Do(req)
+		if err == nil || server == nil {
+			return resp, err
+		}
+
+		server.setHealthy(false, 0)
+		tried = append(tried, server)
+
+		next := pickFileServer(tried...)
+		if next == nil {
+			return nil, err
+		}
+
+		if body = new_body(); body == nil {
+			return nil, err
+		}
+
+		log.Println("File server", server, "failed:", err, "- switching to", next)
+		server = next
+	}
+}
+
+// Seafile file server answers its protocol version without authentication.
+func (s *FileServer) probe() {
+	client := &http.Client{Timeout: FILE_SERVER_PROBE_TIMEOUT}
+
+	start := time.Now()
+	resp, err := client.Get(s.base.String() + "/protocol-version")
+	if err != nil {
+		s.setHealthy(false, 0)
+		return
+	}
+	resp.Body.Close()
+
+	s.setHealthy(resp.StatusCode == http.StatusOK, time.Since(start))
+}
+
+// Probes all file servers periodically.
+func runFileServerProbes() {
+	for {
+		for _, server := range file_servers {
+			server.probe()
+		}
+
+		time.Sleep(file_server_probe_interval)
+	}
+}
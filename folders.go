@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"path"
+	"regexp"
+	"strings"
+)
+
+var folderVariableRegexp = regexp.MustCompile(`\{([a-z_]*)\}`)
+
+// Expands {date}, {uuid}, {api_key} and {filename_ext} variables in folder path.
+// Unknown variables and values escaping the library root are rejected.
+func ExpandFolder(folder string, vars map[string]string) (string, error) {
+	var expand_err error
+
+	expanded := folderVariableRegexp.ReplaceAllStringFunc(folder, func(match string) string {
+		name := match[1 : len(match)-1]
+
+		value, ok := vars[name]
+		if !ok {
+			expand_err = errors.New("Unknown folder variable: " + match)
+			return ""
+		}
+
+		if value == "" || strings.ContainsAny(value, "/\\") || value == ".." {
+			expand_err = errors.New("Cannot expand folder variable " + match + " for this request")
+			return ""
+		}
+
+		return value
+	})
+
+	if expand_err != nil {
+		return "", expand_err
+	}
+
+	if strings.ContainsAny(expanded, "{}") {
+		return "", errors.New("Invalid folder: " + folder)
+	}
+
+	// Folders are relative to the library root: photos/ is /photos/.
+	if !strings.HasPrefix(expanded, "/") {
+		expanded = "/" + expanded
+	}
+
+	for _, segment := range strings.Split(expanded, "/") {
+		if segment == ".." {
+			return "", errors.New("Invalid folder: " + folder)
+		}
+	}
+
+	expanded = path.Clean(expanded)
+	if expanded != "/" {
+		expanded += "/"
+	}
+
+	return expanded, nil
+}
+
+// Folder variables available for uploaded file.
+func folderVariables(date, uuid, api_key, filename string) map[string]string {
+	ext := strings.ToLower(strings.TrimPrefix(path.Ext(filename), "."))
+	if ext == "" {
+		ext = "noext"
+	}
+
+	return map[string]string{
+		"date":         date,
+		"uuid":         uuid,
+		"api_key":      api_key,
+		"filename_ext": ext,
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import "testing"
+
+func TestExpandFolder(t *testing.T) {
+	vars := folderVariables("2024-05-20", "c4e6a9a5", "app", "photo.JPG")
+
+	cases := []struct {
+		folder   string
+		expanded string
+		fails    bool
+	}{
+		{"/uploads/{date}/", "/uploads/2024-05-20/", false},
+		{"uploads/{api_key}", "/uploads/app/", false},
+		{"", "/", false},
+		{"/{filename_ext}/{uuid}", "/jpg/c4e6a9a5/", false},
+		{"/uploads/../secret/", "", true},
+		{"/{unknown}/", "", true},
+	}
+
+	for _, c := range cases {
+		expanded, err := ExpandFolder(c.folder, vars)
+		if c.fails {
+			if err == nil {
+				t.Errorf("ExpandFolder(%q) = %q, want error", c.folder, expanded)
+			}
+			continue
+		}
+		if err != nil || expanded != c.expanded {
+			t.Errorf("ExpandFolder(%q) = %q, %v, want %q", c.folder, expanded, err, c.expanded)
+		}
+	}
+}
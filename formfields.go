@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+	"mime/multipart"
+	"strings"
+)
+
+// Alternative upload form field names of legacy clients: canonical name -> aliases.
+var form_field_aliases = make(map[string][]string)
+
+// Parses SEAFILE_FORM_FIELDS value: "file=attachment,folder=dir,callback=notify_url".
+// A field may have several aliases: "file=attachment,file=upload".
+func ParseFormFieldAliases(spec string) (map[string][]string, error) {
+	aliases := make(map[string][]string)
+
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[1]) == "" {
+			return nil, errors.New("Invalid form field alias, expected field=alias: " + entry)
+		}
+
+		name, alias := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		if name != "file" && !stringInSlice(name, reserved_form_fields) {
+			return nil, errors.New("Unknown form field: " + name)
+		}
+
+		aliases[name] = append(aliases[name], alias)
+	}
+
+	return aliases, nil
+}
+
+// Moves values of aliased fields to their canonical names,
+// so aliases are neither missed nor stored as metadata.
+func normalizeFormFields(form *multipart.Form) {
+	for name, aliases := range form_field_aliases {
+		for _, alias := range aliases {
+			if values, ok := form.Value[alias]; ok {
+				form.Value[name] = append(form.Value[name], values...)
+				delete(form.Value, alias)
+			}
+
+			if files, ok := form.File[alias]; ok {
+				form.File[name] = append(form.File[name], files...)
+				delete(form.File, alias)
+			}
+		}
+	}
+}
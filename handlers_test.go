@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/lazureykis/seafile-uploader/pkg/seafile"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const TEST_REPO_ID = "99b758e6-91ab-4265-b705-925367374cf0"
+
+// Serves handlers from in-memory library, restoring the configuration after the test.
+func useMemoryStorage(t *testing.T) *seafile.MemoryStorage {
+	saved_storage, saved_repo, saved_keys, saved_local, saved_policy := storage, default_repo, api_keys, api_local, collision_policy
+	t.Cleanup(func() {
+		storage, default_repo, api_keys, api_local, collision_policy = saved_storage, saved_repo, saved_keys, saved_local, saved_policy
+	})
+
+	memory := seafile.NewMemoryStorage()
+	memory.AddRepo(Repo{Id: TEST_REPO_ID, Name: "test"})
+
+	storage = memory
+	default_repo = TEST_REPO_ID
+	api_keys = map[string]string{}
+	api_local = true
+	collision_policy = COLLISION_SKIP
+	return memory
+}
+
+func uploadRequest(t *testing.T, folder, filename, content string) *http.Request {
+	body := &bytes.Buffer{}
+	form := multipart.NewWriter(body)
+	form.WriteField("folder", folder)
+	part, err := form.CreateFormFile("file", filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write([]byte(content))
+	form.Close()
+
+	r := httptest.NewRequest("POST", "/upload", body)
+	r.Header.Set("Content-Type", form.FormDataContentType())
+	r.Header.Set("Accept", "application/json")
+	return r
+}
+
+type uploadResponse struct {
+	Uploaded int            `json:"uploaded"`
+	Files    []UploadResult `json:"files"`
+}
+
+func upload(t *testing.T, folder, filename, content string) uploadResponse {
+	w := httptest.NewRecorder()
+	uploadHandler(w, uploadRequest(t, folder, filename, content))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Upload answered %d: %s", w.Code, w.Body.String())
+	}
+
+	var response uploadResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	return response
+}
+
+func TestUploadAndDownload(t *testing.T) {
+	memory := useMemoryStorage(t)
+
+	response := upload(t, "/docs/", "hello.txt", "hello, world")
+	if response.Uploaded != 1 || len(response.Files) != 1 || response.Files[0].Path != "/docs/hello.txt" {
+		t.Fatalf("Unexpected upload response: %+v", response)
+	}
+
+	spec, err := memory.FileDetail(TEST_REPO_ID, "/docs/hello.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spec.Id != response.Files[0].Hash {
+		t.Errorf("Stored id %s, reported %s", spec.Id, response.Files[0].Hash)
+	}
+
+	w := httptest.NewRecorder()
+	downloadHandler(w, httptest.NewRequest("GET", "/get/docs/hello.txt", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "hello, world" {
+		t.Fatalf("Download answered %d: %q", w.Code, w.Body.String())
+	}
+	if etag := w.Header().Get("ETag"); etag != `"`+spec.Id+`"` {
+		t.Errorf("Unexpected ETag %s", etag)
+	}
+
+	r := httptest.NewRequest("GET", "/get/docs/hello.txt", nil)
+	r.Header.Set("Range", "bytes=7-")
+	w = httptest.NewRecorder()
+	downloadHandler(w, r)
+	if w.Code != http.StatusPartialContent || w.Body.String() != "world" {
+		t.Errorf("Range download answered %d: %q", w.Code, w.Body.String())
+	}
+
+	r = httptest.NewRequest("GET", "/get/docs/hello.txt", nil)
+	r.Header.Set("If-None-Match", `"`+spec.Id+`"`)
+	w = httptest.NewRecorder()
+	downloadHandler(w, r)
+	if w.Code != http.StatusNotModified {
+		t.Errorf("Conditional download answered %d", w.Code)
+	}
+}
+
+func TestDownloadMissingFile(t *testing.T) {
+	useMemoryStorage(t)
+
+	w := httptest.NewRecorder()
+	downloadHandler(w, httptest.NewRequest("GET", "/get/missing.txt", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Missing file answered %d", w.Code)
+	}
+}
+
+func TestUploadCollisionSkipsDifferentContent(t *testing.T) {
+	memory := useMemoryStorage(t)
+
+	upload(t, "/docs/", "report.txt", "first")
+	response := upload(t, "/docs/", "report.txt", "second")
+	if response.Uploaded != 0 || len(response.Files) != 1 || !response.Files[0].Skipped || !response.Files[0].Conflict {
+		t.Fatalf("Unexpected upload response: %+v", response)
+	}
+
+	file, err := memory.DownloadFile(TEST_REPO_ID, "/docs/report.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if data, _ := ioutil.ReadAll(file); string(data) != "first" {
+		t.Errorf("Existing file was changed: %q", data)
+	}
+}
+
+func TestAPIDeleteFile(t *testing.T) {
+	memory := useMemoryStorage(t)
+	upload(t, "/docs/", "old.txt", "old")
+
+	r := httptest.NewRequest("DELETE", "/api/v1/file?p=/docs/old.txt", nil)
+	r.RemoteAddr = "127.0.0.1:1234"
+	w := httptest.NewRecorder()
+	apiHandler(apiFileHandler)(w, r)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Delete answered %d: %s", w.Code, w.Body.String())
+	}
+
+	if _, err := memory.FileDetail(TEST_REPO_ID, "/docs/old.txt"); !isMissingPathError(err) {
+		t.Errorf("File wasn't deleted: %v", err)
+	}
+}
+
+func TestAPIRefusesLargeJSONBody(t *testing.T) {
+	useMemoryStorage(t)
+	saved_size := MAX_JSON_BODY_SIZE
+	defer func() { MAX_JSON_BODY_SIZE = saved_size }()
+	MAX_JSON_BODY_SIZE = 64
+
+	body := `{"src": "/docs/a.txt", "dst": "/docs/` + strings.Repeat("b", 64) + `.txt"}`
+	r := httptest.NewRequest("POST", "/api/v1/file/move", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	r.RemoteAddr = "127.0.0.1:1234"
+	w := httptest.NewRecorder()
+	apiHandler(apiMoveHandler)(w, r)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("Large body answered %d: %s", w.Code, w.Body.String())
+	}
+}
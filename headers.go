@@ -0,0 +1,81 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Policy for the proxy's own pages: no scripts, styles and images from the proxy only.
+const DEFAULT_CONTENT_SECURITY_POLICY = "default-src 'none'; style-src 'self'; img-src 'self' data:; form-action 'self'; frame-ancestors 'none'; base-uri 'none'"
+
+var (
+	security_headers        bool
+	content_security_policy string
+	referrer_policy         string
+	hsts_max_age            int
+)
+
+// Whether request came over TLS, directly or through a terminating reverse proxy.
+func isSecureRequest(r *http.Request) bool {
+	return r.TLS != nil || strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https")
+}
+
+// Adds Content-Security-Policy to HTML responses which don't set their own.
+type securityHeadersWriter struct {
+	http.ResponseWriter
+	wrote_header bool
+}
+
+func (s *securityHeadersWriter) WriteHeader(status int) {
+	if !s.wrote_header {
+		s.wrote_header = true
+
+		header := s.Header()
+		if content_security_policy != "" && header.Get("Content-Security-Policy") == "" &&
+			strings.HasPrefix(header.Get("Content-Type"), "text/html") {
+			header.Set("Content-Security-Policy", content_security_policy)
+		}
+	}
+
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *securityHeadersWriter) Write(p []byte) (int, error) {
+	if !s.wrote_header {
+		if s.Header().Get("Content-Type") == "" {
+			s.Header().Set("Content-Type", http.DetectContentType(p))
+		}
+		s.WriteHeader(http.StatusOK)
+	}
+
+	return s.ResponseWriter.Write(p)
+}
+
+func (s *securityHeadersWriter) Flush() {
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Sets X-Content-Type-Options, Referrer-Policy and, over TLS, Strict-Transport-Security
+// on every response, and Content-Security-Policy on HTML pages.
+func withSecurityHeaders(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !security_headers {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		header := w.Header()
+		header.Set("X-Content-Type-Options", "nosniff")
+		if referrer_policy != "" {
+			header.Set("Referrer-Policy", referrer_policy)
+		}
+		if hsts_max_age > 0 && isSecureRequest(r) {
+			header.Set("Strict-Transport-Security", "max-age="+strconv.Itoa(hsts_max_age))
+		}
+
+		handler.ServeHTTP(&securityHeadersWriter{ResponseWriter: w}, r)
+	})
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Legal holds make files immutable: held files can't be deleted, moved or
+// overwritten by anyone until the hold is released via /admin/holds.
+// Path ending with / holds everything in the folder. New files may still be added.
+var ErrPathHeld = errors.New("Path is under legal hold")
+
+var (
+	legal_holds       = make(map[string]bool)
+	legal_holds_file  string
+	legal_holds_mutex sync.RWMutex
+)
+
+// Loads holds saved by the previous run.
+func loadLegalHolds(file string) error {
+	legal_holds_file = file
+
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var paths []string
+	if err := json.Unmarshal(data, &paths); err != nil {
+		return err
+	}
+
+	for _, path := range paths {
+		legal_holds[path] = true
+	}
+	return nil
+}
+
+// Called with mutex held.
+func saveLegalHolds() error {
+	if legal_holds_file == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(heldPaths(), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := legal_holds_file + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, legal_holds_file)
+}
+
+// Called with mutex held.
+func heldPaths() []string {
+	paths := []string{}
+	for path := range legal_holds {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// Whether path or one of its folders is held.
+func isHeld(path string) bool {
+	legal_holds_mutex.RLock()
+	defer legal_holds_mutex.RUnlock()
+
+	for held := range legal_holds {
+		if held == path || strings.HasSuffix(held, "/") && strings.HasPrefix(path, held) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// GET /admin/holds lists held paths, POST /admin/holds?p=/path places a hold,
+// DELETE /admin/holds?p=/path releases it.
+func adminHoldsHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println(r.Method, r.RequestURI)
+
+	role := ROLE_VIEWER
+	if r.Method != "GET" {
+		role = ROLE_ADMIN
+	}
+
+	if !adminAuthorized(r, role) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	path := r.FormValue("p")
+	if r.Method != "GET" && !strings.HasPrefix(path, "/") {
+		http.Error(w, "Missing path parameter p", http.StatusBadRequest)
+		return
+	}
+
+	legal_holds_mutex.Lock()
+	defer legal_holds_mutex.Unlock()
+
+	switch r.Method {
+	case "GET":
+	case "POST":
+		legal_holds[path] = true
+		log.Println("Legal hold placed on", path)
+	case "DELETE":
+		delete(legal_holds, path)
+		log.Println("Legal hold released from", path)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if r.Method != "GET" {
+		if err := saveLegalHolds(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	writeJSON(w, http.StatusOK, map[string][]string{"holds": heldPaths()})
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Per-directory ignore file with gitignore-style patterns.
+const IGNORE_FILE = ".seafileignore"
+
+// Patterns from SEAFILE_IGNORE, applied to every upload command.
+var ignore_patterns []ignorePattern
+
+type ignorePattern struct {
+	base     string // directory of the ignore file relative to upload root: "" or "docs/"
+	pattern  string
+	negate   bool
+	dir_only bool
+	anchored bool
+}
+
+// Parses gitignore-style lines: "*.partial", "node_modules/", "/build", "!keep.tmp".
+// Blank lines and lines starting with # are skipped.
+func ParseIgnorePatterns(base string, lines []string) []ignorePattern {
+	var patterns []ignorePattern
+
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		p := ignorePattern{base: base}
+
+		if strings.HasPrefix(line, "!") {
+			p.negate = true
+			line = line[1:]
+		}
+
+		line = strings.TrimPrefix(line, "**/")
+		line = strings.TrimSuffix(line, "/**")
+
+		if strings.HasSuffix(line, "/") {
+			p.dir_only = true
+			line = strings.TrimRight(line, "/")
+		}
+
+		if strings.Contains(line, "/") {
+			p.anchored = true
+			line = strings.TrimPrefix(line, "/")
+		}
+
+		if line == "" {
+			continue
+		}
+
+		p.pattern = line
+		patterns = append(patterns, p)
+	}
+
+	return patterns
+}
+
+// Reads IGNORE_FILE of the local directory, if there is one.
+func readIgnoreFile(dir, base string) ([]ignorePattern, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, IGNORE_FILE))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return ParseIgnorePatterns(base, strings.Split(string(data), "\n")), nil
+}
+
+func (p ignorePattern) matches(rel string, is_dir bool) bool {
+	if p.dir_only && !is_dir {
+		return false
+	}
+
+	if !strings.HasPrefix(rel, p.base) {
+		return false
+	}
+	rel = rel[len(p.base):]
+
+	if !p.anchored {
+		rel = path.Base(rel)
+	}
+
+	matched, _ := path.Match(p.pattern, rel)
+	return matched
+}
+
+// Whether path relative to upload root is ignored. The last matching pattern wins.
+func isIgnored(patterns []ignorePattern, rel string, is_dir bool) bool {
+	ignored := false
+
+	for _, p := range patterns {
+		if p.matches(rel, is_dir) {
+			ignored = !p.negate
+		}
+	}
+
+	return ignored
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Largest side of resized image and largest source image accepted.
+const (
+	IMAGE_MAX_SIDE   = 4096
+	IMAGE_MAX_PIXELS = 50 * 1000 * 1000
+)
+
+// Fit modes of /img/: contain keeps the whole image inside the box,
+// cover fills the box cropping the center, fill stretches the image.
+const (
+	IMAGE_FIT_CONTAIN = "contain"
+	IMAGE_FIT_COVER   = "cover"
+	IMAGE_FIT_FILL    = "fill"
+)
+
+type imageVariant struct {
+	width  int
+	height int
+	fit    string
+}
+
+// Parses w, h and fit query parameters.
+func parseImageVariant(query url.Values) (imageVariant, error) {
+	v := imageVariant{fit: query.Get("fit")}
+	if v.fit == "" {
+		v.fit = IMAGE_FIT_CONTAIN
+	}
+	if v.fit != IMAGE_FIT_CONTAIN && v.fit != IMAGE_FIT_COVER && v.fit != IMAGE_FIT_FILL {
+		return v, errors.New("fit should be one of: contain, cover, fill")
+	}
+
+	for name, value := range map[string]*int{"w": &v.width, "h": &v.height} {
+		if s := query.Get(name); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil || n <= 0 || n > IMAGE_MAX_SIDE {
+				return v, errors.New("Invalid " + name + ": " + s)
+			}
+			*value = n
+		}
+	}
+
+	if v.width == 0 && v.height == 0 {
+		return v, errors.New("w or h is required")
+	}
+
+	return v, nil
+}
+
+func (v imageVariant) String() string {
+	return strconv.Itoa(v.width) + "x" + strconv.Itoa(v.height) + "-" + v.fit
+}
+
+// Target size and the part of source to use. Images are never upscaled.
+func (v imageVariant) layout(bounds image.Rectangle) (int, int, image.Rectangle) {
+	src_w, src_h := bounds.Dx(), bounds.Dy()
+	w, h := v.width, v.height
+
+	// Missing side keeps the aspect ratio.
+	if w == 0 {
+		w = src_w * h / src_h
+	}
+	if h == 0 {
+		h = src_h * w / src_w
+	}
+
+	switch {
+	case v.fit == IMAGE_FIT_FILL:
+		// As requested.
+	case v.fit == IMAGE_FIT_COVER && v.width > 0 && v.height > 0:
+		// Crop the center of the source to the target aspect ratio.
+		if src_w*h > src_h*w {
+			crop_w := src_h * w / h
+			x := bounds.Min.X + (src_w-crop_w)/2
+			bounds = image.Rect(x, bounds.Min.Y, x+crop_w, bounds.Max.Y)
+		} else {
+			crop_h := src_w * h / w
+			y := bounds.Min.Y + (src_h-crop_h)/2
+			bounds = image.Rect(bounds.Min.X, y, bounds.Max.X, y+crop_h)
+		}
+	default:
+		if src_w*h > src_h*w {
+			h = src_h * w / src_w
+		} else {
+			w = src_w * h / src_h
+		}
+	}
+
+	if w > bounds.Dx() || h > bounds.Dy() {
+		w, h = bounds.Dx(), bounds.Dy()
+	}
+	if w < 1 {
+		w = 1
+	}
+	if h < 1 {
+		h = 1
+	}
+
+	return w, h, bounds
+}
+
+// Scales part of src to w x h averaging source pixels covered by every target pixel.
+func resizeImage(src image.Image, area image.Rectangle, w, h int) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+
+	for y := 0; y < h; y++ {
+		y0 := area.Min.Y + y*area.Dy()/h
+		y1 := area.Min.Y + (y+1)*area.Dy()/h
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+
+		for x := 0; x < w; x++ {
+			x0 := area.Min.X + x*area.Dx()/w
+			x1 := area.Min.X + (x+1)*area.Dx()/w
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r, g, b, a = r+uint64(cr), g+uint64(cg), b+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+
+			dst.SetRGBA(x, y, color.RGBA{
+				R: uint8(r / n >> 8),
+				G: uint8(g / n >> 8),
+				B: uint8(b / n >> 8),
+				A: uint8(a / n >> 8),
+			})
+		}
+	}
+
+	return dst
+}
+
+// Resizes encoded image. GIFs are converted to PNG.
+func resizeImageData(data []byte, v imageVariant) ([]byte, string, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", err
+	}
+	if config.Width*config.Height > IMAGE_MAX_PIXELS {
+		return nil, "", errors.New("Image is too large")
+	}
+
+	src, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", err
+	}
+
+	w, h, area := v.layout(src.Bounds())
+	dst := resizeImage(src, area, w, h)
+
+	var out bytes.Buffer
+	if format == "jpeg" {
+		err = jpeg.Encode(&out, dst, &jpeg.Options{Quality: 85})
+		return out.Bytes(), "image/jpeg", err
+	}
+
+	err = png.Encode(&out, dst)
+	return out.Bytes(), "image/png", err
+}
+
+// GET /img/folder/photo.jpg?w=800&h=600&fit=cover serves resized copy of the image.
+// Results are cached like downloads, keyed by file version and size.
+func imageHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println(r.Method, r.RequestURI)
+
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/img")
+
+	variant, err := parseImageVariant(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !downloadAuthorized(r, path) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	spec, err := GetFileDetail(path)
+	if isMissingPathError(err) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Variants are cached under their own path and id, so they neither replace
+	// each other nor the original in the cache.
+	variant_path := path + "?" + variant.String()
+	variant_id := spec.Id + "-" + variant.String()
+	modtime := spec.MTime.Time()
+
+	w.Header().Set("ETag", `"`+variant_id+`"`)
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	content_type := "image/png"
+	if detectContentType(path, nil) == "image/jpeg" {
+		content_type = "image/jpeg"
+	}
+
+	if memory_cache != nil {
+		if data, ok := memory_cache.Get(variant_path, variant_id); ok {
+			w.Header().Set("Content-Type", content_type)
+			w.Header().Set("X-Cache", "HIT")
+			http.ServeContent(w, r, path, modtime, bytes.NewReader(data))
+			return
+		}
+	}
+
+	if download_cache != nil {
+		if file, ok := download_cache.Get(variant_path, variant_id); ok {
+			defer file.Close()
+			w.Header().Set("Content-Type", content_type)
+			w.Header().Set("X-Cache", "HIT")
+			http.ServeContent(w, r, path, modtime, file)
+			return
+		}
+	}
+
+	body, err := openRemoteFile(path, spec)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	original, err := ioutil.ReadAll(body)
+	body.Close()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	data, content_type, err := resizeImageData(original, variant)
+	if err != nil {
+		http.Error(w, "Cannot resize image: "+err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	if memory_cache != nil {
+		memory_cache.Put(variant_path, variant_id, data)
+	}
+
+	if download_cache != nil {
+		if cache_writer, err := download_cache.Create(variant_path, variant_id); err == nil {
+			if _, err := cache_writer.Write(data); err != nil {
+				cache_writer.Abort()
+			} else if err := cache_writer.Commit(); err != nil {
+				log.Println("Cache:", err)
+			}
+		} else {
+			log.Println("Cache:", err)
+		}
+	}
+
+	w.Header().Set("Content-Type", content_type)
+	w.Header().Set("X-Cache", "MISS")
+	http.ServeContent(w, r, path, modtime, bytes.NewReader(data))
+}
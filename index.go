@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Local index of custom file metadata, keyed by path.
+// It is kept in memory and saved to SEAFILE_INDEX_FILE when configured,
+// sidecars in the library stay the source of truth.
+type MetadataIndex struct {
+	file    string
+	mutex   sync.RWMutex
+	entries map[string]map[string]interface{}
+}
+
+var metadata_index = &MetadataIndex{entries: make(map[string]map[string]interface{})}
+
+// Loads index from file, which may not exist yet.
+func LoadMetadataIndex(file string) (*MetadataIndex, error) {
+	index := &MetadataIndex{file: file, entries: make(map[string]map[string]interface{})}
+
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return index, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &index.entries); err != nil {
+		return nil, err
+	}
+
+	return index, nil
+}
+
+// Metadata of the file, nil when there is none.
+func (index *MetadataIndex) Get(path string) map[string]interface{} {
+	index.mutex.RLock()
+	defer index.mutex.RUnlock()
+
+	return index.entries[path]
+}
+
+// Replaces metadata of the file.
+func (index *MetadataIndex) Set(path string, metadata map[string]interface{}) {
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+
+	if len(metadata) == 0 {
+		delete(index.entries, path)
+	} else {
+		index.entries[path] = metadata
+	}
+	index.save()
+}
+
+// Forgets metadata of the file.
+func (index *MetadataIndex) Delete(path string) {
+	index.Set(path, nil)
+}
+
+// Moves metadata along with the file.
+func (index *MetadataIndex) Rename(old_path, new_path string) {
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+
+	if metadata, ok := index.entries[old_path]; ok {
+		delete(index.entries, old_path)
+		index.entries[new_path] = metadata
+		index.save()
+	}
+}
+
+// Copies metadata along with the file, or with every file of a folder
+// when paths end with a slash.
+func (index *MetadataIndex) Copy(old_path, new_path string) {
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+
+	copies := make(map[string]map[string]interface{})
+	for path, metadata := range index.entries {
+		if path == old_path || strings.HasSuffix(old_path, "/") && strings.HasPrefix(path, old_path) {
+			copies[new_path+path[len(old_path):]] = metadata
+		}
+	}
+
+	if len(copies) == 0 {
+		return
+	}
+
+	for path, metadata := range copies {
+		index.entries[path] = metadata
+	}
+	index.save()
+}
+
+// Writes index file atomically. Called with mutex held.
+func (index *MetadataIndex) save() {
+	if index.file == "" {
+		return
+	}
+
+	data, err := json.Marshal(index.entries)
+	if err != nil {
+		log.Println("Index:", err)
+		return
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(index.file), ".index-")
+	if err != nil {
+		log.Println("Index:", err)
+		return
+	}
+
+	_, err = tmp.Write(data)
+	if close_err := tmp.Close(); err == nil {
+		err = close_err
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), index.file)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		log.Println("Index:", err)
+	}
+}
+
+// Whether metadata has all filter values. List values match when they contain the value.
+func metadataMatches(metadata map[string]interface{}, filters map[string]string) bool {
+	for key, expected := range filters {
+		switch value := metadata[key].(type) {
+		case string:
+			if value != expected {
+				return false
+			}
+		case []interface{}:
+			found := false
+			for _, item := range value {
+				if item == expected {
+					found = true
+				}
+			}
+			if !found {
+				return false
+			}
+		case []string:
+			if !stringInSlice(expected, value) {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// Files with metadata accepted by match.
+func (index *MetadataIndex) Find(match func(path string, metadata map[string]interface{}) bool) map[string]map[string]interface{} {
+	index.mutex.RLock()
+	defer index.mutex.RUnlock()
+
+	found := make(map[string]map[string]interface{})
+	for path, metadata := range index.entries {
+		if match(path, metadata) {
+			found[path] = metadata
+		}
+	}
+
+	return found
+}
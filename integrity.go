@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"strings"
+)
+
+// Integrity mode for archival workflows (SEAFILE_INTEGRITY=true): every stored
+// upload is checked against what Seafile reports (file id and size) before
+// callbacks fire, and files in SEAFILE_INTEGRITY_PARANOID_FOLDERS are downloaded
+// back and hashed. Hashes declared by clients are checked in any mode:
+//
+//	form field sha256=<hex>, one per file in order of the files
+//	part header X-Content-SHA256: <hex> or Digest: SHA-256=<base64>
+var (
+	integrity_mode             bool
+	integrity_paranoid_folders []string
+)
+
+var ErrIntegrity = errors.New("Integrity check failed")
+
+// SHA-256 declared by client for index-th file of the upload, empty when there is none.
+func declaredDigest(form *multipart.Form, f *multipart.FileHeader, index int) (string, error) {
+	digest := f.Header.Get("X-Content-SHA256")
+
+	for _, value := range strings.Split(f.Header.Get("Digest"), ",") {
+		value = strings.TrimSpace(value)
+		if i := strings.Index(value, "="); i > 0 && strings.EqualFold(value[:i], "SHA-256") {
+			sum, err := base64.StdEncoding.DecodeString(value[i+1:])
+			if err != nil {
+				return "", errors.New("Invalid Digest of " + f.Filename)
+			}
+			digest = hex.EncodeToString(sum)
+		}
+	}
+
+	if values := form.Value["sha256"]; digest == "" && len(values) > 0 {
+		if len(values) != len(form.File["file"]) {
+			return "", errors.New("sha256 should be given for every file")
+		}
+		digest = values[index]
+	}
+
+	digest = strings.ToLower(strings.TrimSpace(digest))
+	if digest != "" {
+		if sum, err := hex.DecodeString(digest); err != nil || len(sum) != 32 {
+			return "", errors.New("Invalid SHA-256 of " + f.Filename)
+		}
+	}
+
+	return digest, nil
+}
+
+// Compares received content with the hash declared by client.
+// Declared hash is of the file as sent, before metadata stripping.
+func checkDeclaredDigest(form *multipart.Form, f *multipart.FileHeader, index int) error {
+	declared, err := declaredDigest(form, f, index)
+	if err != nil || declared == "" {
+		return err
+	}
+
+	received, _, err := hashFormFile(f, false)
+	if err != nil {
+		return err
+	}
+
+	if received != declared {
+		return fmt.Errorf("%w: %s was received with SHA-256 %s, %s declared", ErrIntegrity, f.Filename, received, declared)
+	}
+
+	return nil
+}
+
+func isParanoidFolder(path string) bool {
+	for _, folder := range integrity_paranoid_folders {
+		if strings.HasPrefix(path, folder) {
+			return true
+		}
+	}
+	return false
+}
+
+// Checks the stored file: Seafile should report the id returned by the upload
+// (when known) and the size sent, paranoid folders compare SHA-256 of the
+// downloaded file too.
+func verifyStoredFile(path, file_id, digest string, size int64) error {
+	if !integrity_mode {
+		return nil
+	}
+
+	spec, err := GetFileDetail(path)
+	if err != nil {
+		return fmt.Errorf("%w: %s can't be checked: %v", ErrIntegrity, path, err)
+	}
+
+	if file_id != "" && spec.Id != file_id {
+		return fmt.Errorf("%w: %s is stored as %s, upload returned %s", ErrIntegrity, path, spec.Id, file_id)
+	}
+
+	if spec.Size != size {
+		return fmt.Errorf("%w: %s is stored with %d bytes, %d sent", ErrIntegrity, path, spec.Size, size)
+	}
+
+	if isParanoidFolder(path) {
+		stored, err := hashRemoteFile(path)
+		if err != nil {
+			return fmt.Errorf("%w: %s can't be downloaded back: %v", ErrIntegrity, path, err)
+		}
+
+		if stored != digest {
+			return fmt.Errorf("%w: %s is stored with SHA-256 %s, %s sent", ErrIntegrity, path, stored, digest)
+		}
+	}
+
+	rememberContentDigest(spec.Id, digest)
+	return nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"path"
+	"strings"
+	"time"
+)
+
+// Release pointers: upload form field latest=latest.json (relative to the upload
+// folder) or latest=/releases/latest.json makes the proxy rewrite that file after
+// the upload completes. Seafile replaces a file in a single commit, and the pointer
+// is written only after the release file is stored, so readers of the pointer
+// see either the previous release or the new one, never a partial one.
+type LatestPointer struct {
+	File    string `json:"file"`
+	Path    string `json:"path"`
+	Id      string `json:"id,omitempty"`
+	SHA256  string `json:"sha256,omitempty"`
+	Size    int64  `json:"size"`
+	Updated string `json:"updated"`
+}
+
+// Folder and name of the pointer for uploads into dir.
+func latestPointerPath(latest, dir string) (string, string, error) {
+	if !strings.HasPrefix(latest, "/") {
+		name, err := SanitizeFilename(latest)
+		return dir, name, err
+	}
+
+	if strings.HasSuffix(latest, "/") {
+		return "", "", errors.New("Latest pointer should be a file: " + latest)
+	}
+
+	name, err := SanitizeFilename(path.Base(latest))
+	return strings.TrimSuffix(path.Dir(latest), "/") + "/", name, err
+}
+
+// Replaces pointer file with the reference to the stored file.
+func UpdateLatestPointer(latest, dir, filename, id, digest string, size int64) error {
+	pointer_dir, pointer_name, err := latestPointerPath(latest, dir)
+	if err != nil {
+		return err
+	}
+
+	if isHeld(pointer_dir + pointer_name) {
+		return ErrPathHeld
+	}
+
+	data, err := json.MarshalIndent(LatestPointer{
+		File:    filename,
+		Path:    dir + filename,
+		Id:      id,
+		SHA256:  digest,
+		Size:    size,
+		Updated: time.Now().UTC().Format(time.RFC3339),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if pointer_dir != dir {
+		err, _, exists := IsDirectoryExist(pointer_dir)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			if err := CreateDirectory(pointer_dir); err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err = UploadFile(bytes.NewReader(data), pointer_dir, pointer_name, true)
+	return err
+}
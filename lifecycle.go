@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Tombstone left in place of archived file.
+const TOMBSTONE_SUFFIX = ".archived.json"
+
+// Files under Prefix older than Age are moved to the archive folder.
+// Archive folder is usually routed to another library with SEAFILE_REPO_ROUTES:
+// "/archive/=archive-repo-id", so /logs/a.log becomes /archive/logs/a.log there.
+type LifecycleRule struct {
+	Prefix string
+	Age    time.Duration
+}
+
+var (
+	lifecycle_rules      []LifecycleRule
+	archive_folder       string
+	lifecycle_tombstones bool
+	lifecycle_interval   time.Duration
+)
+
+type Tombstone struct {
+	File         string `json:"file"`
+	ArchivedPath string `json:"archived_path"`
+	Archived     string `json:"archived"`
+}
+
+// Parses age like "30d", "12h" or "90m".
+func parseAge(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil || days <= 0 {
+			return 0, errors.New("Invalid age: " + s)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+
+	age, err := time.ParseDuration(s)
+	if err != nil || age <= 0 {
+		return 0, errors.New("Invalid age: " + s)
+	}
+	return age, nil
+}
+
+// Parses SEAFILE_LIFECYCLE_RULES value: "/logs/=30d,/tmp/=12h".
+func ParseLifecycleRules(spec string) ([]LifecycleRule, error) {
+	var rules []LifecycleRule
+
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 {
+			return nil, errors.New("Invalid lifecycle rule, expected /prefix/=age: " + entry)
+		}
+
+		age, err := parseAge(parts[1])
+		if err != nil {
+			return nil, err
+		}
+
+		prefix := "/" + strings.Trim(strings.TrimSpace(parts[0]), "/") + "/"
+		rules = append(rules, LifecycleRule{Prefix: strings.Replace(prefix, "//", "/", 1), Age: age})
+	}
+
+	sort.SliceStable(rules, func(i, j int) bool {
+		return len(rules[i].Prefix) > len(rules[j].Prefix)
+	})
+
+	return rules, nil
+}
+
+// Applies lifecycle rules every lifecycle_interval.
+func runLifecycle() {
+	for {
+		for _, rule := range lifecycle_rules {
+			archived, err := ApplyLifecycleRule(rule, time.Now())
+			if err != nil {
+				log.Println("Lifecycle", rule.Prefix, "failed:", err)
+			}
+			if archived > 0 {
+				log.Println("Lifecycle archived", archived, "files from", rule.Prefix)
+			}
+		}
+
+		time.Sleep(lifecycle_interval)
+	}
+}
+
+// Moves files of the rule older than its age to the archive folder.
+func ApplyLifecycleRule(rule LifecycleRule, now time.Time) (int, error) {
+	cutoff := now.Add(-rule.Age)
+	archive := strings.TrimRight(archive_folder, "/")
+	archived := 0
+
+	err := walkFolder(rule.Prefix, "", func(file_path, _ string, spec FileSpec) error {
+		if strings.HasPrefix(file_path, archive+"/") || strings.HasSuffix(spec.Name, TOMBSTONE_SUFFIX) {
+			return nil
+		}
+
+		if !spec.MTime.Time().Before(cutoff) {
+			return nil
+		}
+
+		if isHeld(file_path) {
+			log.Println("Lifecycle skipping held", file_path)
+			return nil
+		}
+
+		// Lock holder is still working with the file.
+		if lock, locked := fileLock(file_path); locked {
+			log.Println("Lifecycle skipping", file_path, "locked by", lock.Owner)
+			return nil
+		}
+
+		if err := ArchiveFile(file_path, spec.Id, archive+file_path, now); err != nil {
+			return err
+		}
+		archived++
+		return nil
+	})
+
+	return archived, err
+}
+
+// Copies file to archive_path (server-side) and deletes the original.
+// Older archived file of the same name is kept, the file is archived as
+// "name (1).ext" then. Copy with the same id is left from the interrupted run.
+func ArchiveFile(file_path, file_id, archive_path string, now time.Time) error {
+	dir := file_path[:strings.LastIndex(file_path, "/")+1]
+	name := file_path[len(dir):]
+	archive_dir := archive_path[:strings.LastIndex(archive_path, "/")+1]
+	original := file_path
+
+	err, existing, exists := IsDirectoryExist(archive_dir)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		if err := CreateDirectory(archive_dir); err != nil {
+			return err
+		}
+	}
+
+	copied := false
+	var names []string
+	for _, spec := range existing {
+		names = append(names, spec.Name)
+		copied = copied || spec.Name == name && spec.Id == file_id
+	}
+
+	if !copied {
+		// Seafile copies keeping the name, so the file is renamed in place first.
+		if target, _, _ := ResolveCollision(COLLISION_RENAME, name, names); target != name {
+			err, siblings, _ := IsDirectoryExist(dir)
+			if err != nil {
+				return err
+			}
+			for _, spec := range siblings {
+				names = append(names, spec.Name)
+			}
+
+			target, _, _ = ResolveCollision(COLLISION_RENAME, name, names)
+			if err := MoveFile(file_path, dir+target); err != nil {
+				return err
+			}
+
+			file_path = dir + target
+			archive_path = archive_dir + target
+		}
+
+		if err := CopyFile(dir, file_path[len(dir):], archive_dir); err != nil {
+			return err
+		}
+	}
+
+	if err := DeleteFile(file_path); err != nil {
+		return err
+	}
+
+	metadata_index.Rename(original, archive_path)
+
+	if lifecycle_tombstones {
+		data, err := json.MarshalIndent(Tombstone{
+			File:         name,
+			ArchivedPath: archive_path,
+			Archived:     now.UTC().Format(time.RFC3339),
+		}, "", "  ")
+		if err != nil {
+			return err
+		}
+
+		if _, err := UploadFile(bytes.NewReader(data), dir, name+TOMBSTONE_SUFFIX, true); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
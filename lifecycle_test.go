@@ -0,0 +1,58 @@
+package main
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestArchiveFileKeepsOlderArchive(t *testing.T) {
+	memory := useMemoryStorage(t)
+	upload(t, "/archive/docs/", "report.txt", "old")
+	upload(t, "/docs/", "report.txt", "new")
+
+	spec, err := GetFileDetail("/docs/report.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ArchiveFile("/docs/report.txt", spec.Id, "/archive/docs/report.txt", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	for path, content := range map[string]string{"/archive/docs/report.txt": "old", "/archive/docs/report (1).txt": "new"} {
+		file, err := memory.DownloadFile(TEST_REPO_ID, path)
+		if err != nil {
+			t.Fatal(path, err)
+		}
+		data, _ := ioutil.ReadAll(file)
+		file.Close()
+		if string(data) != content {
+			t.Errorf("%s has %q, want %q", path, data, content)
+		}
+	}
+
+	if _, err := memory.FileDetail(TEST_REPO_ID, "/docs/report.txt"); !isMissingPathError(err) {
+		t.Errorf("Archived file wasn't deleted: %v", err)
+	}
+}
+
+func TestArchiveFileFinishesInterruptedRun(t *testing.T) {
+	memory := useMemoryStorage(t)
+	upload(t, "/archive/docs/", "report.txt", "same")
+	upload(t, "/docs/", "report.txt", "same")
+
+	spec, err := GetFileDetail("/docs/report.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ArchiveFile("/docs/report.txt", spec.Id, "/archive/docs/report.txt", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := memory.FileDetail(TEST_REPO_ID, "/archive/docs/report (1).txt"); !isMissingPathError(err) {
+		t.Errorf("Copy left by the interrupted run was archived again: %v", err)
+	}
+	if _, err := memory.FileDetail(TEST_REPO_ID, "/docs/report.txt"); !isMissingPathError(err) {
+		t.Errorf("Archived file wasn't deleted: %v", err)
+	}
+}
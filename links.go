@@ -0,0 +1,121 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Temporary file server links reused for SEAFILE_DOWNLOAD_LINK_TTL.
+// Links are keyed by path and file id: the link serves the file version it was
+// issued for, so a changed file must not be read through the old link.
+type downloadLink struct {
+	link    string
+	expires time.Time
+}
+
+// File details are reused along with links, so downloads through a fresh link
+// need no Seafile request. Changes made through the proxy drop them, see publishChange.
+type fileDetail struct {
+	spec    FileSpec
+	expires time.Time
+}
+
+var (
+	download_links       = make(map[string]downloadLink)
+	file_details         = make(map[string]fileDetail)
+	download_links_mutex sync.Mutex
+)
+
+// Details of the file, from cache when they are fresh.
+func CachedFileDetail(path string) (FileSpec, error) {
+	if download_link_ttl <= 0 {
+		return GetFileDetail(path)
+	}
+
+	now := time.Now()
+
+	download_links_mutex.Lock()
+	cached, ok := file_details[path]
+	download_links_mutex.Unlock()
+
+	if ok && now.Before(cached.expires) {
+		return cached.spec, nil
+	}
+
+	spec, err := GetFileDetail(path)
+	if err != nil {
+		return spec, err
+	}
+
+	download_links_mutex.Lock()
+	defer download_links_mutex.Unlock()
+
+	for k, cached := range file_details {
+		if now.After(cached.expires) {
+			delete(file_details, k)
+		}
+	}
+	file_details[path] = fileDetail{spec: spec, expires: now.Add(download_link_ttl)}
+
+	return spec, nil
+}
+
+// Drops cached details of the file.
+func forgetFileDetail(path string) {
+	download_links_mutex.Lock()
+	delete(file_details, path)
+	download_links_mutex.Unlock()
+}
+
+// Link to the file version, from cache when it is fresh.
+func CachedDownloadLink(path, file_id string) (string, error) {
+	if download_link_ttl <= 0 {
+		return GetDownloadFileLink(path)
+	}
+
+	key := path + "\n" + file_id
+	now := time.Now()
+
+	download_links_mutex.Lock()
+	cached, ok := download_links[key]
+	download_links_mutex.Unlock()
+
+	if ok && now.Before(cached.expires) {
+		return cached.link, nil
+	}
+
+	link, err := GetDownloadFileLink(path)
+	if err != nil {
+		return "", err
+	}
+
+	download_links_mutex.Lock()
+	defer download_links_mutex.Unlock()
+
+	for k, cached := range download_links {
+		if now.After(cached.expires) {
+			delete(download_links, k)
+		}
+	}
+	download_links[key] = downloadLink{link: link, expires: now.Add(download_link_ttl)}
+
+	return link, nil
+}
+
+// Drops cached link. Returns whether there was one.
+func forgetDownloadLink(path, file_id string) bool {
+	key := path + "\n" + file_id
+
+	download_links_mutex.Lock()
+	defer download_links_mutex.Unlock()
+
+	_, ok := download_links[key]
+	delete(download_links, key)
+	return ok
+}
+
+// File server answers for expired or unknown access tokens.
+func isStaleLinkStatus(status int) bool {
+	return status == http.StatusBadRequest || status == http.StatusForbidden || status == http.StatusNotFound
+}
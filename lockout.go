@@ -0,0 +1,222 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// Every failure slows the next answer to the client down by this much more.
+	AUTH_FAILURE_DELAY     = 250 * time.Millisecond
+	AUTH_FAILURE_MAX_DELAY = 5 * time.Second
+)
+
+// Failed authentications of one client: address and credentials it presents.
+type authFailures struct {
+	count        int
+	last         time.Time
+	locked_until time.Time
+}
+
+var (
+	auth_failures       = make(map[string]*authFailures)
+	auth_failures_mutex sync.Mutex
+
+	// Totals since start, shown by /admin/auth.
+	auth_failures_total int64
+	auth_lockouts_total int64
+
+	// Failures within auth_lockout_duration which lock the client out, zero disables lockouts.
+	auth_lockout_threshold int
+	auth_lockout_duration  time.Duration
+)
+
+// Failures are counted per address, so guessing a new key every time doesn't
+// start over. Valid keys get a bucket of their own: behind a reverse proxy all
+// clients share the address, and a guesser shouldn't lock out the rest.
+// Secrets are never kept, only a short hash of them: "10.0.0.1 5f2b9e1c".
+func authClient(r *http.Request) string {
+	if !knownCredentials(r) {
+		return sourceIP(r)
+	}
+
+	credentials := requestAPIKey(r) + "\n" + r.Header.Get("X-Admin-Key")
+	sum := sha256.Sum256([]byte(credentials))
+	return sourceIP(r) + " " + hex.EncodeToString(sum[:4])
+}
+
+// Time until which client is locked out, zero when it isn't.
+func authLockedUntil(client string) time.Time {
+	auth_failures_mutex.Lock()
+	defer auth_failures_mutex.Unlock()
+
+	failures, ok := auth_failures[client]
+	if !ok || time.Now().After(failures.locked_until) {
+		return time.Time{}
+	}
+	return failures.locked_until
+}
+
+// Counts failure and returns how long to delay the answer.
+func recordAuthFailure(client string, r *http.Request) time.Duration {
+	now := time.Now()
+
+	auth_failures_mutex.Lock()
+	defer auth_failures_mutex.Unlock()
+
+	for key, failures := range auth_failures {
+		if now.Sub(failures.last) > auth_lockout_duration && now.After(failures.locked_until) {
+			delete(auth_failures, key)
+		}
+	}
+
+	failures, ok := auth_failures[client]
+	if !ok {
+		failures = &authFailures{}
+		auth_failures[client] = failures
+	}
+	failures.count++
+	failures.last = now
+	auth_failures_total++
+
+	log.Println("Auth failure from", client, r.Method, r.URL.Path, "failures:", failures.count)
+
+	if auth_lockout_threshold > 0 && failures.count >= auth_lockout_threshold {
+		failures.locked_until = now.Add(auth_lockout_duration)
+		failures.count = 0
+		auth_lockouts_total++
+		log.Println("Auth lockout of", client, "until", failures.locked_until.Format(time.RFC3339))
+	}
+
+	delay := time.Duration(failures.count) * AUTH_FAILURE_DELAY
+	if delay > AUTH_FAILURE_MAX_DELAY {
+		delay = AUTH_FAILURE_MAX_DELAY
+	}
+	return delay
+}
+
+func resetAuthFailures(client string) {
+	auth_failures_mutex.Lock()
+	defer auth_failures_mutex.Unlock()
+
+	if failures, ok := auth_failures[client]; ok && time.Now().After(failures.locked_until) {
+		delete(auth_failures, client)
+	}
+}
+
+// Whether request carries any credentials.
+func hasCredentials(r *http.Request) bool {
+	return requestAPIKey(r) != "" || r.Header.Get("X-Admin-Key") != "" || r.URL.Query().Get("sig") != ""
+}
+
+// Whether presented API or admin key is one of configured ones.
+func knownCredentials(r *http.Request) bool {
+	if requestAPIKey(r) != "" {
+		if _, ok := authenticateUser(r); ok {
+			return true
+		}
+		if _, ok := AuthenticateAPIKey(r); ok && len(api_keys) > 0 {
+			return true
+		}
+	}
+
+	if secret := r.Header.Get("X-Admin-Key"); secret != "" {
+		for key_secret := range admin_keys {
+			if subtle.ConstantTimeCompare([]byte(secret), []byte(key_secret)) == 1 {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// 401 or 403 answered to unknown credentials. 403 answered to a valid key or
+// without credentials is a policy decision, like an upload window, legal hold
+// or sandbox, not somebody guessing credentials.
+func isAuthFailure(r *http.Request, status int) bool {
+	switch status {
+	case http.StatusUnauthorized:
+		return true
+	case http.StatusForbidden:
+		return hasCredentials(r) && !knownCredentials(r)
+	}
+
+	return false
+}
+
+// Watches answers for 401 and 403 to count failed authentications.
+type authStatusWriter struct {
+	http.ResponseWriter
+	r      *http.Request
+	client string
+}
+
+func (a *authStatusWriter) WriteHeader(status int) {
+	if isAuthFailure(a.r, status) {
+		time.Sleep(recordAuthFailure(a.client, a.r))
+	} else if status < 400 && hasCredentials(a.r) {
+		resetAuthFailures(a.client)
+	}
+
+	a.ResponseWriter.WriteHeader(status)
+}
+
+func (a *authStatusWriter) Flush() {
+	if f, ok := a.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Refuses locked out clients with 429 and slows down repeated failures.
+func withAuthLockout(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client := authClient(r)
+
+		if until := authLockedUntil(client); !until.IsZero() {
+			w.Header().Set("Retry-After", strconv.Itoa(int(time.Until(until).Seconds())+1))
+			http.Error(w, "Too many failed authentications", http.StatusTooManyRequests)
+			return
+		}
+
+		handler.ServeHTTP(&authStatusWriter{ResponseWriter: w, r: r, client: client}, r)
+	})
+}
+
+// GET /admin/auth shows failure totals and locked out clients.
+func adminAuthHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println(r.Method, r.RequestURI)
+
+	if !adminAuthorized(r, ROLE_VIEWER) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	auth_failures_mutex.Lock()
+	locked := make(map[string]string)
+	now := time.Now()
+	for client, failures := range auth_failures {
+		if now.Before(failures.locked_until) {
+			locked[client] = failures.locked_until.UTC().Format(time.RFC3339)
+		}
+	}
+	stats := map[string]interface{}{
+		"failures_total": auth_failures_total,
+		"lockouts_total": auth_lockouts_total,
+		"locked":         locked,
+	}
+	auth_failures_mutex.Unlock()
+
+	writeJSON(w, http.StatusOK, stats)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestGuessedKeysLockOutAddress(t *testing.T) {
+	saved_keys, saved_threshold, saved_duration := api_keys, auth_lockout_threshold, auth_lockout_duration
+	defer func() {
+		api_keys, auth_lockout_threshold, auth_lockout_duration = saved_keys, saved_threshold, saved_duration
+		auth_failures = make(map[string]*authFailures)
+	}()
+	api_keys = map[string]string{"secret": "app"}
+	auth_lockout_threshold = 3
+	auth_lockout_duration = time.Minute
+	auth_failures = make(map[string]*authFailures)
+
+	handler := withAuthLockout(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !apiKeyAuthorized(r) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	request := func(key string) int {
+		r := httptest.NewRequest("GET", "/api/v1/dir?p=/", nil)
+		r.RemoteAddr = "10.0.0.1:1234"
+		r.Header.Set("X-Api-Key", key)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	for i := 0; i < auth_lockout_threshold; i++ {
+		if code := request("guess" + strconv.Itoa(i)); code != http.StatusForbidden {
+			t.Fatalf("Guess %d answered %d", i, code)
+		}
+	}
+
+	if code := request("guess-next"); code != http.StatusTooManyRequests {
+		t.Errorf("Address guessing different keys answered %d, want 429", code)
+	}
+	if code := request("secret"); code != http.StatusOK {
+		t.Errorf("Valid key behind the same address answered %d", code)
+	}
+}
+
+func TestIsAuthFailure(t *testing.T) {
+	saved := api_keys
+	defer func() { api_keys = saved }()
+	api_keys = map[string]string{"secret": "app"}
+
+	request := func(key string) *http.Request {
+		r := httptest.NewRequest("DELETE", "/api/v1/file?p=/held.txt", nil)
+		if key != "" {
+			r.Header.Set("X-Api-Key", key)
+		}
+		return r
+	}
+
+	cases := []struct {
+		key     string
+		status  int
+		failure bool
+	}{
+		{"", http.StatusUnauthorized, true},
+		{"guess", http.StatusForbidden, true},
+		{"secret", http.StatusForbidden, false},
+		{"", http.StatusForbidden, false},
+		{"secret", http.StatusLocked, false},
+	}
+
+	for _, c := range cases {
+		if got := isAuthFailure(request(c.key), c.status); got != c.failure {
+			t.Errorf("isAuthFailure(key %q, %d) = %v, want %v", c.key, c.status, got, c.failure)
+		}
+	}
+}
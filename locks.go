@@ -0,0 +1,253 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Files locked through /api/v1/file/lock with Seafile Professional file locks.
+// Seafile sees every lock as taken by the proxy account, so the proxy remembers
+// which API key took it and refuses changes of the file by other keys.
+// Locks are saved to SEAFILE_LOCKS_FILE when configured.
+type FileLock struct {
+	Path     string `json:"path"`
+	Owner    string `json:"owner,omitempty"`
+	LockedAt string `json:"locked_at"`
+}
+
+var (
+	file_locks       = make(map[string]FileLock)
+	file_locks_file  string
+	file_locks_mutex sync.RWMutex
+)
+
+// Loads locks taken before restart.
+func loadFileLocks(file string) error {
+	file_locks_file = file
+
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var locks []FileLock
+	if err := json.Unmarshal(data, &locks); err != nil {
+		return err
+	}
+
+	for _, lock := range locks {
+		file_locks[lock.Path] = lock
+	}
+	return nil
+}
+
+// Called with mutex held.
+func saveFileLocks() error {
+	if file_locks_file == "" {
+		return nil
+	}
+
+	locks := []FileLock{}
+	for _, lock := range file_locks {
+		locks = append(locks, lock)
+	}
+
+	data, err := json.MarshalIndent(locks, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := file_locks_file + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file_locks_file)
+}
+
+// Lock of the file taken by any API key.
+func fileLock(path string) (FileLock, bool) {
+	file_locks_mutex.RLock()
+	defer file_locks_mutex.RUnlock()
+
+	lock, ok := file_locks[path]
+	return lock, ok
+}
+
+// Lock of the file taken by another API key than the one of the request.
+func lockedByOther(r *http.Request, path string) (FileLock, bool) {
+	lock, ok := fileLock(path)
+	if !ok {
+		return lock, false
+	}
+
+	return lock, lock.Owner != requestKeyName(r)
+}
+
+// Refuses with 423 when one of paths is locked by another API key, returns true then.
+func refuseLocked(w http.ResponseWriter, r *http.Request, paths ...string) bool {
+	for _, path := range paths {
+		if lock, locked := lockedByOther(r, path); locked {
+			http.Error(w, "File is locked by "+lock.Owner+": "+path, http.StatusLocked)
+			return true
+		}
+	}
+
+	return false
+}
+
+// Keeps the lock with the file when it is moved.
+func moveFileLock(src, dst string) {
+	file_locks_mutex.Lock()
+	defer file_locks_mutex.Unlock()
+
+	if lock, ok := file_locks[src]; ok {
+		delete(file_locks, src)
+		lock.Path = dst
+		file_locks[dst] = lock
+		if err := saveFileLocks(); err != nil {
+			log.Println("Locks:", err)
+		}
+	}
+}
+
+// Forgets lock of the deleted file, Seafile drops it along with the file.
+func releaseFileLock(path string) {
+	file_locks_mutex.Lock()
+	defer file_locks_mutex.Unlock()
+
+	if _, ok := file_locks[path]; ok {
+		delete(file_locks, path)
+		if err := saveFileLocks(); err != nil {
+			log.Println("Locks:", err)
+		}
+	}
+}
+
+// Locks the file in Seafile.
+func LockFile(path string) error {
+	repo_id, repo_path := RouteRepo(path)
+
+	log.Println("Locking", path)
+
+	if err := clientFor(repo_id).LockFile(repo_id, repo_path); err != nil {
+		return fmt.Errorf("Cannot lock %s > %w", path, err)
+	}
+
+	return nil
+}
+
+// Unlocks the file in Seafile.
+func UnlockFile(path string) error {
+	repo_id, repo_path := RouteRepo(path)
+
+	log.Println("Unlocking", path)
+
+	if err := clientFor(repo_id).UnlockFile(repo_id, repo_path); err != nil {
+		return fmt.Errorf("Cannot unlock %s > %w", path, err)
+	}
+
+	return nil
+}
+
+// GET /api/v1/file/lock?p=/foo/file.txt tells whether the file is locked.
+// POST locks it, DELETE unlocks it. Only the API key which took the lock
+// can release it, admin key with operator role can release any lock.
+func apiLockHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println(r.Method, r.RequestURI)
+
+	if r.Method != "GET" && r.Method != "POST" && r.Method != "DELETE" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	force := r.Method == "DELETE" && adminAuthorized(r, ROLE_OPERATOR)
+	if !apiPathsAuthorized(r, r.FormValue("p")) && !force {
+		writeAPIError(w, http.StatusForbidden, "Forbidden")
+		return
+	}
+
+	path := r.FormValue("p")
+	if !strings.HasPrefix(path, "/") || strings.HasSuffix(path, "/") {
+		writeAPIError(w, http.StatusBadRequest, "p should be a file path")
+		return
+	}
+
+	file_locks_mutex.RLock()
+	lock, locked := file_locks[path]
+	file_locks_mutex.RUnlock()
+
+	if r.Method == "GET" {
+		status := map[string]interface{}{"path": path, "locked": locked}
+		if locked {
+			status["lock"] = lock
+		}
+		writeAPI(w, http.StatusOK, status)
+		return
+	}
+
+	if refuseUnsupported(w, "file_lock") || refuseInMaintenance(w) {
+		return
+	}
+
+	if !force && refuseLocked(w, r, path) {
+		return
+	}
+
+	if r.Method == "DELETE" {
+		if err := UnlockFile(path); err != nil {
+			writeAPIError(w, seafileErrorHTTPStatus(err, http.StatusBadGateway), err.Error())
+			return
+		}
+
+		file_locks_mutex.Lock()
+		delete(file_locks, path)
+		err := saveFileLocks()
+		file_locks_mutex.Unlock()
+		if err != nil {
+			log.Println("Locks:", err)
+		}
+
+		Audit(AuditEvent{Event: "file_unlocked", IP: sourceIP(r), APIKey: lock.Owner, Path: path,
+			Details: map[string]string{"forced": strconv.FormatBool(force)}})
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if _, err := GetFileDetail(path); err != nil {
+		writeAPIError(w, seafileErrorHTTPStatus(err, http.StatusInternalServerError), err.Error())
+		return
+	}
+
+	// Locking again by the owner only refreshes the lock.
+	if !locked {
+		if err := LockFile(path); err != nil {
+			writeAPIError(w, seafileErrorHTTPStatus(err, http.StatusBadGateway), err.Error())
+			return
+		}
+	}
+
+	owner := requestKeyName(r)
+	lock = FileLock{Path: path, Owner: owner, LockedAt: time.Now().UTC().Format(time.RFC3339)}
+
+	file_locks_mutex.Lock()
+	file_locks[path] = lock
+	err := saveFileLocks()
+	file_locks_mutex.Unlock()
+	if err != nil {
+		log.Println("Locks:", err)
+	}
+
+	Audit(AuditEvent{Event: "file_locked", IP: sourceIP(r), APIKey: owner, Path: path})
+	writeAPI(w, http.StatusOK, map[string]interface{}{"path": path, "locked": true, "lock": lock})
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"container/list"
+	"sync"
+)
+
+// Bounded in-memory LRU cache for small hot files (thumbnails, CSS...),
+// keyed like the disk cache by path and Seafile file id.
+type MemoryCache struct {
+	max_size   int64
+	max_object int64
+
+	mutex   sync.Mutex
+	order   *list.List // front is the most recently used
+	entries map[string]*list.Element
+	size    int64
+}
+
+type memoryEntry struct {
+	key  string
+	data []byte
+}
+
+// Cache used by /get/, nil when disabled.
+var memory_cache *MemoryCache
+
+func NewMemoryCache(max_size, max_object int64) *MemoryCache {
+	return &MemoryCache{
+		max_size:   max_size,
+		max_object: max_object,
+		order:      list.New(),
+		entries:    make(map[string]*list.Element),
+	}
+}
+
+// Whether object of given size may be stored.
+func (c *MemoryCache) Fits(size int64) bool {
+	return size >= 0 && size <= c.max_object && size <= c.max_size
+}
+
+func (c *MemoryCache) Get(path, file_id string) ([]byte, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	element, ok := c.entries[cacheKey(path, file_id)]
+	if !ok {
+		return nil, false
+	}
+
+	c.order.MoveToFront(element)
+	return element.Value.(*memoryEntry).data, true
+}
+
+func (c *MemoryCache) Put(path, file_id string, data []byte) {
+	if !c.Fits(int64(len(data))) {
+		return
+	}
+
+	key := cacheKey(path, file_id)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&memoryEntry{key: key, data: data})
+	c.size += int64(len(data))
+
+	for c.size > c.max_size {
+		oldest := c.order.Back()
+		entry := oldest.Value.(*memoryEntry)
+		c.order.Remove(oldest)
+		delete(c.entries, entry.key)
+		c.size -= int64(len(entry.data))
+	}
+}
+
+// Removes all cached objects.
+func (c *MemoryCache) Purge() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.order.Init()
+	c.entries = make(map[string]*list.Element)
+	c.size = 0
+}
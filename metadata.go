@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Seafile has no arbitrary metadata, so client supplied form fields
+// (author, source, tags...) are stored in "<name>.meta.json" next to the file.
+const METADATA_SUFFIX = ".meta.json"
+
+// Upload form fields which are not metadata.
+var reserved_form_fields = []string{"folder", "folders[]", "folders", "callback", "strip_exif", "latest", "sha256", "submit",
+	"provenance_system", "provenance_job_id", "provenance_commit"}
+
+// With SEAFILE_UPLOAD_SIDECARS on, the sidecar is written for every upload and
+// also records who uploaded the file and what was stored, so this information
+// survives without the proxy. SEAFILE_METADATA_FOLDER moves sidecars out of the
+// data folders into a parallel tree: /.metadata/photos/a.jpg.meta.json.
+type FileMetadata struct {
+	File         string                 `json:"file"`
+	OriginalName string                 `json:"original_name,omitempty"`
+	Uploader     string                 `json:"uploader,omitempty"`
+	SourceIP     string                 `json:"source_ip,omitempty"`
+	SHA256       string                 `json:"sha256,omitempty"`
+	Size         int64                  `json:"size,omitempty"`
+	Uploaded     string                 `json:"uploaded,omitempty"`
+	Provenance   *Provenance            `json:"provenance,omitempty"`
+	Metadata     map[string]interface{} `json:"metadata"`
+}
+
+// Prefix of explicit metadata fields: x-meta-owner=alice is stored as owner=alice.
+const METADATA_FIELD_PREFIX = "x-meta-"
+
+// Collects metadata fields from upload form.
+// Single values are stored as strings, repeated ones as lists.
+func metadataFromForm(form map[string][]string) map[string]interface{} {
+	metadata := make(map[string]interface{})
+
+	for key, values := range form {
+		if stringInSlice(key, reserved_form_fields) || len(values) == 0 {
+			continue
+		}
+
+		if strings.HasPrefix(strings.ToLower(key), METADATA_FIELD_PREFIX) {
+			key = key[len(METADATA_FIELD_PREFIX):]
+			if key == "" {
+				continue
+			}
+		}
+
+		if len(values) == 1 {
+			metadata[key] = values[0]
+		} else {
+			metadata[key] = values
+		}
+	}
+
+	return metadata
+}
+
+func copyMetadata(metadata map[string]interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(metadata))
+	for key, value := range metadata {
+		copied[key] = value
+	}
+	return copied
+}
+
+// Folder where sidecars of files in folder are stored.
+func metadataFolder(folder string) string {
+	if metadata_folder == "" {
+		return folder
+	}
+
+	return strings.TrimRight(metadata_folder, "/") + folder
+}
+
+// Client address without port.
+func sourceIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// Stores metadata sidecar for the file in folder, replacing the previous one.
+func UploadMetadata(folder string, metadata FileMetadata) error {
+	data, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	sidecar_folder := metadataFolder(folder)
+	if sidecar_folder != folder {
+		err, _, exists := IsDirectoryExist(sidecar_folder)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			if err := CreateDirectory(sidecar_folder); err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err = UploadFile(bytes.NewReader(data), sidecar_folder, metadata.File+METADATA_SUFFIX, true)
+	return err
+}
+
+// GET /meta/folder/file.jpg returns metadata stored with the file.
+func metadataHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println(r.Method, r.RequestURI)
+
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	request_uri, err := url.ParseRequestURI(r.RequestURI)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	path := strings.Replace(request_uri.Path, "/meta/", "/", 1)
+
+	if !downloadAuthorized(r, path) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	folder := path[:strings.LastIndex(path, "/")+1]
+	link, err := GetDownloadFileLink(metadataFolder(folder) + path[len(folder):] + METADATA_SUFFIX)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	resp, _, err := fileServerGet(link, nil, nil)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		http.Error(w, resp.Status, resp.StatusCode)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	io.Copy(w, resp.Body)
+}
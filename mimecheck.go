@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// What is done with uploads whose content doesn't match their extension.
+const (
+	MIME_MISMATCH_OFF    = "off"
+	MIME_MISMATCH_FLAG   = "flag"
+	MIME_MISMATCH_REJECT = "reject"
+)
+
+var mime_mismatch string
+
+// Extensions under which executables are expected.
+var executable_extensions = []string{".exe", ".dll", ".msi", ".com", ".scr", ".sys", ".bin", ".so", ".dylib", ".elf", ".run", ".appimage", ".o"}
+
+func ParseMimeMismatchMode(mode string) (string, error) {
+	switch mode {
+	case MIME_MISMATCH_OFF, MIME_MISMATCH_FLAG, MIME_MISMATCH_REJECT:
+		return mode, nil
+	}
+
+	return "", errors.New("Unknown MIME mismatch mode: " + mode)
+}
+
+// Sniffs content type, recognizing executables which http.DetectContentType doesn't know.
+func sniffContentType(head []byte) string {
+	switch {
+	case bytes.HasPrefix(head, []byte("MZ")):
+		return "application/x-msdownload"
+	case bytes.HasPrefix(head, []byte("\x7fELF")):
+		return "application/x-executable"
+	case bytes.HasPrefix(head, []byte("\xcf\xfa\xed\xfe")), bytes.HasPrefix(head, []byte("\xce\xfa\xed\xfe")),
+		bytes.HasPrefix(head, []byte("\xca\xfe\xba\xbe")):
+		return "application/x-mach-binary"
+	}
+
+	return http.DetectContentType(head)
+}
+
+func isExecutableType(content_type string) bool {
+	return stringInSlice(content_type, []string{"application/x-msdownload", "application/x-executable", "application/x-mach-binary"})
+}
+
+// Whether sniffed type wildly disagrees with the type of the extension: an executable
+// under a non-executable name, or a different kind of content (image vs text).
+// Generic sniffing results and unknown extensions are never a mismatch.
+func contentTypeMismatch(filename, sniffed string) bool {
+	ext := strings.ToLower(filepath.Ext(filename))
+
+	if isExecutableType(sniffed) {
+		return ext != "" && !stringInSlice(ext, executable_extensions)
+	}
+
+	declared := contentTypeByExtension(filename)
+	if declared == "" {
+		return false
+	}
+
+	sniffed = strings.SplitN(sniffed, ";", 2)[0]
+	if sniffed == "application/octet-stream" || sniffed == "text/plain" {
+		return false
+	}
+
+	// XML-based formats (SVG, RSS, XHTML) sniff as plain XML.
+	declared = strings.SplitN(declared, ";", 2)[0]
+	if isXMLType(sniffed) && isXMLType(declared) {
+		return false
+	}
+
+	return strings.SplitN(declared, "/", 2)[0] != strings.SplitN(sniffed, "/", 2)[0]
+}
+
+// text/xml, application/xml or one of +xml types: image/svg+xml.
+func isXMLType(content_type string) bool {
+	return strings.HasSuffix(content_type, "/xml") || strings.HasSuffix(content_type, "+xml")
+}
+
+// Checks uploaded file content against its name, recording mismatches in the audit log.
+// Returns rejection reason when the upload should be rejected.
+func checkContentType(r *http.Request, api_key, filename string, f *multipart.FileHeader) (string, error) {
+	if mime_mismatch == MIME_MISMATCH_OFF {
+		return "", nil
+	}
+
+	file, err := f.Open()
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+
+	sniffed := sniffContentType(head[:n])
+	if !contentTypeMismatch(filename, sniffed) {
+		return "", nil
+	}
+
+	Audit(AuditEvent{
+		Event:  "content_type_mismatch",
+		IP:     sourceIP(r),
+		APIKey: api_key,
+		Path:   filename,
+		Details: map[string]string{
+			"extension_type": contentTypeByExtension(filename),
+			"sniffed_type":   sniffed,
+			"action":         mime_mismatch,
+		},
+	})
+
+	if mime_mismatch == MIME_MISMATCH_REJECT {
+		return "Content of " + filename + " doesn't match its extension (" + sniffed + ")", nil
+	}
+
+	return "", nil
+}
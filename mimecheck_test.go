@@ -0,0 +1,28 @@
+package main
+
+import "testing"
+
+func TestContentTypeMismatch(t *testing.T) {
+	cases := []struct {
+		filename string
+		content  string
+		mismatch bool
+	}{
+		{"logo.svg", `<?xml version="1.0" encoding="UTF-8"?><svg xmlns="http://www.w3.org/2000/svg"></svg>`, false},
+		{"logo.svg", `<svg xmlns="http://www.w3.org/2000/svg"></svg>`, false},
+		{"feed.xml", `<?xml version="1.0"?><rss></rss>`, false},
+		{"notes.txt", "plain text", false},
+		{"photo.jpg", "\xff\xd8\xff\xe0\x00\x10JFIF\x00", false},
+		{"photo.jpg", `<?xml version="1.0"?><svg></svg>`, true},
+		{"notes.txt", "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR", true},
+		{"report.pdf", "MZ\x90\x00\x03", true},
+		{"setup.exe", "MZ\x90\x00\x03", false},
+	}
+
+	for _, c := range cases {
+		sniffed := sniffContentType([]byte(c.content))
+		if got := contentTypeMismatch(c.filename, sniffed); got != c.mismatch {
+			t.Errorf("contentTypeMismatch(%q, %q) = %v, want %v", c.filename, sniffed, got, c.mismatch)
+		}
+	}
+}
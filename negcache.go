@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"github.com/lazureykis/seafile-uploader/pkg/seafile"
+	"sync"
+	"time"
+)
+
+var ErrPathMissing = seafile.ErrPathNotExist
+
+// Recently missing paths with expiration time, so clients polling for
+// not-yet-uploaded files don't turn into a flood of Seafile API calls.
+var (
+	missing_paths       = make(map[string]time.Time)
+	missing_paths_mutex sync.Mutex
+)
+
+func isMissingPathError(err error) bool {
+	return errors.Is(err, seafile.ErrPathNotExist)
+}
+
+// Reports whether path is known to be missing.
+func isKnownMissing(path string) bool {
+	if negative_cache_ttl <= 0 {
+		return false
+	}
+
+	missing_paths_mutex.Lock()
+	defer missing_paths_mutex.Unlock()
+
+	expires, ok := missing_paths[path]
+	if ok && time.Now().After(expires) {
+		delete(missing_paths, path)
+		return false
+	}
+
+	return ok
+}
+
+func rememberMissing(path string) {
+	if negative_cache_ttl <= 0 {
+		return
+	}
+
+	now := time.Now()
+
+	missing_paths_mutex.Lock()
+	defer missing_paths_mutex.Unlock()
+
+	for p, expires := range missing_paths {
+		if now.After(expires) {
+			delete(missing_paths, p)
+		}
+	}
+
+	missing_paths[path] = now.Add(negative_cache_ttl)
+}
+
+// Called when file appears so it's visible immediately.
+func forgetMissing(path string) {
+	missing_paths_mutex.Lock()
+	delete(missing_paths, path)
+	missing_paths_mutex.Unlock()
+}
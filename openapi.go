@@ -0,0 +1,564 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// /api/v1 operations. The OpenAPI document served at /api/openapi.json is built
+// from them, and apiHandler validates requests against the same definitions,
+// so the document can't drift from what the handlers accept.
+type APIOperation struct {
+	Method      string
+	Path        string
+	Summary     string
+	Params      []APIParam
+	Response    string // schema name, empty for no content
+	Status      int
+	AdminRole   string // X-Admin-Key role instead of API key
+	Multipart   bool
+	Description string
+}
+
+// Parameter sent in query, urlencoded form or JSON object alike.
+type APIParam struct {
+	Name        string
+	Type        string // string, integer, boolean or array of strings
+	Required    bool
+	Path        bool // should start with a slash
+	Min, Max    int  // integer bounds, zero when unbounded
+	Description string
+}
+
+var p_param = APIParam{Name: "p", Type: "string", Required: true, Path: true, Description: "Path in the proxy tree"}
+
+var api_operations = []APIOperation{
+	{Method: "GET", Path: "/api/v1/dir", Summary: "List folder", Params: []APIParam{p_param}, Response: "DirectoryListing",
+		Description: "Files may be filtered by metadata: meta.owner=alice"},
+	{Method: "POST", Path: "/api/v1/dir", Summary: "Create folder", Status: http.StatusCreated, Response: "DirectoryListing", Params: []APIParam{p_param,
+		{Name: "parents", Type: "boolean", Description: "Create missing parents, existing folder is not an error"}}},
+	{Method: "GET", Path: "/api/v1/stat", Summary: "File details", Params: []APIParam{p_param}, Response: "Entry"},
+	{Method: "GET", Path: "/api/v1/file/detail", Summary: "File details", Params: []APIParam{p_param}, Response: "Entry"},
+	{Method: "DELETE", Path: "/api/v1/file", Summary: "Delete file", Params: []APIParam{p_param}, Status: http.StatusNoContent},
+	{Method: "POST", Path: "/api/v1/file/move", Summary: "Move or rename file", Response: "Entry", Params: []APIParam{
+		{Name: "src", Type: "string", Required: true, Path: true},
+		{Name: "dst", Type: "string", Required: true, Path: true}}},
+	{Method: "POST", Path: "/api/v1/file/copy", Summary: "Copy file or folder into folder", Response: "Entry", Params: []APIParam{
+		{Name: "src", Type: "string", Required: true, Path: true, Description: "File, or folder ending with a slash"},
+		{Name: "dst", Type: "string", Required: true, Path: true, Description: "Folder"}}},
+	{Method: "GET", Path: "/api/v1/file/history", Summary: "File revisions", Params: []APIParam{p_param}, Response: "FileHistory"},
+	{Method: "POST", Path: "/api/v1/file/revert", Summary: "Restore file revision", Response: "Entry", Params: []APIParam{p_param,
+		{Name: "commit_id", Type: "string", Required: true}}},
+	{Method: "GET", Path: "/api/v1/file/lock", Summary: "File lock", Params: []APIParam{p_param}, Response: "FileLockStatus"},
+	{Method: "POST", Path: "/api/v1/file/lock", Summary: "Lock file", Params: []APIParam{p_param}, Response: "FileLockStatus",
+		Description: "Other API keys can't change the file until it is unlocked. Needs Seafile Professional."},
+	{Method: "DELETE", Path: "/api/v1/file/lock", Summary: "Unlock file", Params: []APIParam{p_param}, Status: http.StatusNoContent,
+		Description: "Only the API key which locked the file, or admin key with operator role, can unlock it."},
+	{Method: "POST", Path: "/api/v1/files/delete", Summary: "Delete files", Response: "BatchDeleteResults", Params: []APIParam{
+		{Name: "paths", Type: "array", Description: "File paths, the body may also be a JSON array of them"}}},
+	{Method: "GET", Path: "/api/v1/watch", Summary: "List watch webhooks", Response: "WatchSubscriptions"},
+	{Method: "POST", Path: "/api/v1/watch", Summary: "Register watch webhook", Status: http.StatusCreated, Response: "WatchSubscription",
+		Description: "Changes under prefix are POSTed to url as ChangeEvent", Params: []APIParam{
+			{Name: "prefix", Type: "string", Required: true, Path: true, Description: "Watched folder"},
+			{Name: "url", Type: "string", Required: true}}},
+	{Method: "DELETE", Path: "/api/v1/watch", Summary: "Remove watch webhook", Status: http.StatusNoContent, Params: []APIParam{
+		{Name: "id", Type: "string", Required: true}}},
+	{Method: "GET", Path: "/api/v1/watch/stream", Summary: "Stream changes", Description: "text/event-stream of ChangeEvent", Params: []APIParam{
+		{Name: "prefix", Type: "string", Required: true, Path: true, Description: "Watched folder"}}},
+	{Method: "GET", Path: "/api/v1/search", Summary: "Search files", Response: "SearchResults", Params: []APIParam{
+		{Name: "q", Type: "string", Required: true},
+		{Name: "page", Type: "integer", Min: 1},
+		{Name: "per_page", Type: "integer", Min: 1, Max: 100}}},
+	{Method: "GET", Path: "/api/v1/events", Summary: "Recent changes", Response: "ActivityEvents", Params: []APIParam{
+		{Name: "p", Type: "string", Path: true, Description: "Only changes in the folder"},
+		{Name: "page", Type: "integer", Min: 1},
+		{Name: "per_page", Type: "integer", Min: 1, Max: 100}}},
+	{Method: "GET", Path: "/api/v1/tags", Summary: "List tags", Response: "Tags"},
+	{Method: "POST", Path: "/api/v1/tags", Summary: "Define tag in every library", Status: http.StatusCreated, Response: "Tag", Params: []APIParam{
+		{Name: "name", Type: "string", Required: true},
+		{Name: "color", Type: "string", Description: "#999999 by default"}}},
+	{Method: "GET", Path: "/api/v1/tags/files", Summary: "Files by tag or tags of file", Response: "TaggedFiles",
+		Description: "With tag lists files having it, with p lists tags of the file", Params: []APIParam{
+			{Name: "tag", Type: "string"},
+			{Name: "p", Type: "string", Path: true}}},
+	{Method: "POST", Path: "/api/v1/tags/files", Summary: "Tag file", Response: "FileTags", Params: []APIParam{p_param,
+		{Name: "tag", Type: "string", Required: true},
+		{Name: "color", Type: "string", Description: "Color of the tag when it is created"}}},
+	{Method: "DELETE", Path: "/api/v1/tags/files", Summary: "Untag file", Response: "FileTags", Params: []APIParam{p_param,
+		{Name: "tag", Type: "string", Required: true}}},
+	{Method: "POST", Path: "/api/v1/share", Summary: "Create share link", Status: http.StatusCreated, Response: "ShareLink", Params: []APIParam{p_param,
+		{Name: "password", Type: "string"},
+		{Name: "expire_days", Type: "integer", Min: 1}}},
+	{Method: "GET", Path: "/api/v1/repos", Summary: "List libraries", Response: "Repos"},
+	{Method: "POST", Path: "/api/v1/repos", Summary: "Create library", Status: http.StatusCreated, Response: "Repo", AdminRole: ROLE_ADMIN, Params: []APIParam{
+		{Name: "name", Type: "string", Required: true},
+		{Name: "desc", Type: "string"},
+		{Name: "password", Type: "string", Description: "Makes the library encrypted"}}},
+	{Method: "POST", Path: "/api/v1/upload", Summary: "Upload files", Response: "UploadResult", Multipart: true, Params: []APIParam{
+		{Name: "folder", Type: "string", Description: "Target folder, may contain {date}, {uuid}, {api_key} and {filename_ext}"},
+		{Name: "callback", Type: "string"},
+		{Name: "strip_exif", Type: "boolean"},
+		{Name: "latest", Type: "string"},
+		{Name: "sha256", Type: "string", Description: "SHA-256 of the file, one per file"},
+		{Name: "provenance_system", Type: "string", Description: "System which produced the files, also X-Provenance-System header"},
+		{Name: "provenance_job_id", Type: "string", Description: "Job of the system, also X-Provenance-Job-Id header"},
+		{Name: "provenance_commit", Type: "string", Description: "Commit of the code, also X-Provenance-Commit header"}}},
+	{Method: "GET", Path: "/api/v1/provenance", Summary: "Find files by provenance", Response: "ProvenanceResults", Params: []APIParam{
+		{Name: "system", Type: "string"},
+		{Name: "job_id", Type: "string"},
+		{Name: "commit", Type: "string", Description: "Matches by prefix"}},
+		Description: "At least one of system, job_id and commit is required"},
+}
+
+// Checks request parameters of a known operation. Multipart uploads are left to the handler.
+func validateAPIRequest(r *http.Request) error {
+	for _, op := range api_operations {
+		if op.Path != r.URL.Path || op.Method != r.Method && !(op.Method == "GET" && r.Method == "HEAD") {
+			continue
+		}
+		if op.Multipart {
+			return nil
+		}
+
+		for _, param := range op.Params {
+			value := r.FormValue(param.Name)
+			if value == "" {
+				if param.Required {
+					return apiParamError(param, "is required")
+				}
+				continue
+			}
+
+			switch param.Type {
+			case "integer":
+				n, err := strconv.Atoi(value)
+				if err != nil {
+					return apiParamError(param, "should be an integer")
+				}
+				if param.Min != 0 && n < param.Min || param.Max != 0 && n > param.Max {
+					return apiParamError(param, "is out of range")
+				}
+			case "boolean":
+				if _, err := strconv.ParseBool(value); err != nil {
+					return apiParamError(param, "should be a boolean")
+				}
+			}
+
+			if param.Path && !strings.HasPrefix(value, "/") {
+				return apiParamError(param, "should start with a slash")
+			}
+		}
+
+		return nil
+	}
+
+	return nil
+}
+
+type apiParamErr struct {
+	param   string
+	problem string
+}
+
+func (e *apiParamErr) Error() string {
+	return e.param + " " + e.problem
+}
+
+func apiParamError(param APIParam, problem string) error {
+	return &apiParamErr{param: param.Name, problem: problem}
+}
+
+func schemaRef(name string) map[string]interface{} {
+	return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+}
+
+// Envelope with data of the schema.
+func envelopeSchema(data map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"data":     data,
+			"warnings": map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+		},
+	}
+}
+
+func paramSchema(param APIParam) map[string]interface{} {
+	schema := map[string]interface{}{"type": param.Type}
+	if param.Min != 0 {
+		schema["minimum"] = param.Min
+	}
+	if param.Max != 0 {
+		schema["maximum"] = param.Max
+	}
+	if param.Path {
+		schema["pattern"] = "^/"
+	}
+	if param.Type == "array" {
+		schema["items"] = map[string]interface{}{"type": "string"}
+	}
+	return schema
+}
+
+var api_schemas = map[string]interface{}{
+	"Error": map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"error": map[string]interface{}{
+				"type":     "object",
+				"required": []string{"code", "message"},
+				"properties": map[string]interface{}{
+					"code":    map[string]interface{}{"type": "string", "example": "not_found"},
+					"message": map[string]interface{}{"type": "string"},
+				},
+			},
+		},
+	},
+	"Entry": map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"id":       map[string]interface{}{"type": "string"},
+			"mtime":    map[string]interface{}{"type": "string", "format": "date-time"},
+			"type":     map[string]interface{}{"type": "string", "enum": []string{"file", "dir"}},
+			"name":     map[string]interface{}{"type": "string"},
+			"size":     map[string]interface{}{"type": "integer", "format": "int64"},
+			"metadata": map[string]interface{}{"type": "object", "additionalProperties": true},
+		},
+	},
+	"DirectoryListing": map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"path":    map[string]interface{}{"type": "string"},
+			"entries": map[string]interface{}{"type": "array", "items": schemaRef("Entry")},
+		},
+	},
+	"FileHistory": map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"path": map[string]interface{}{"type": "string"},
+			"revisions": map[string]interface{}{"type": "array", "items": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"commit_id":    map[string]interface{}{"type": "string"},
+					"file_id":      map[string]interface{}{"type": "string"},
+					"size":         map[string]interface{}{"type": "integer", "format": "int64"},
+					"mtime":        map[string]interface{}{"type": "string", "format": "date-time"},
+					"creator":      map[string]interface{}{"type": "string"},
+					"description":  map[string]interface{}{"type": "string"},
+					"renamed_from": map[string]interface{}{"type": "string"},
+				},
+			}},
+		},
+	},
+	"SearchResults": map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"query":    map[string]interface{}{"type": "string"},
+			"total":    map[string]interface{}{"type": "integer"},
+			"has_more": map[string]interface{}{"type": "boolean"},
+			"results": map[string]interface{}{"type": "array", "items": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"path":  map[string]interface{}{"type": "string"},
+					"name":  map[string]interface{}{"type": "string"},
+					"type":  map[string]interface{}{"type": "string", "enum": []string{"file", "dir"}},
+					"size":  map[string]interface{}{"type": "integer", "format": "int64"},
+					"mtime": map[string]interface{}{"type": "string", "format": "date-time"},
+					"url":   map[string]interface{}{"type": "string"},
+				},
+			}},
+		},
+	},
+	"ShareLink": map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"path":               map[string]interface{}{"type": "string"},
+			"link":               map[string]interface{}{"type": "string"},
+			"token":              map[string]interface{}{"type": "string"},
+			"expire_date":        map[string]interface{}{"type": "string"},
+			"password_protected": map[string]interface{}{"type": "boolean"},
+		},
+	},
+	"Repo": map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"id":         map[string]interface{}{"type": "string"},
+			"name":       map[string]interface{}{"type": "string"},
+			"size":       map[string]interface{}{"type": "integer", "format": "int64"},
+			"permission": map[string]interface{}{"type": "string"},
+			"owner":      map[string]interface{}{"type": "string"},
+			"encrypted":  map[string]interface{}{"type": "boolean"},
+			"mtime":      map[string]interface{}{"type": "string", "format": "date-time"},
+			"prefix":     map[string]interface{}{"type": "string"},
+			"default":    map[string]interface{}{"type": "boolean"},
+		},
+	},
+	"Repos": map[string]interface{}{"type": "array", "items": schemaRef("Repo")},
+	"Provenance": map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"system": map[string]interface{}{"type": "string"},
+			"job_id": map[string]interface{}{"type": "string"},
+			"commit": map[string]interface{}{"type": "string"},
+		},
+	},
+	"ProvenanceResults": map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"results": map[string]interface{}{"type": "array", "items": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"path":       map[string]interface{}{"type": "string"},
+					"provenance": schemaRef("Provenance"),
+				},
+			}},
+		},
+	},
+	"BatchDeleteResults": map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"deleted": map[string]interface{}{"type": "integer"},
+			"results": map[string]interface{}{"type": "array", "items": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"path":   map[string]interface{}{"type": "string"},
+					"status": map[string]interface{}{"type": "integer", "example": 204},
+					"error":  map[string]interface{}{"type": "string"},
+				},
+			}},
+		},
+	},
+	"WatchSubscription": map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"id":      map[string]interface{}{"type": "string"},
+			"prefix":  map[string]interface{}{"type": "string"},
+			"url":     map[string]interface{}{"type": "string"},
+			"created": map[string]interface{}{"type": "string", "format": "date-time"},
+		},
+	},
+	"WatchSubscriptions": map[string]interface{}{"type": "array", "items": schemaRef("WatchSubscription")},
+	"ChangeEvent": map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"id":      map[string]interface{}{"type": "string"},
+			"time":    map[string]interface{}{"type": "string", "format": "date-time"},
+			"type":    map[string]interface{}{"type": "string", "enum": []string{"uploaded", "created", "updated", "deleted", "moved", "copied", "reverted"}},
+			"path":    map[string]interface{}{"type": "string"},
+			"from":    map[string]interface{}{"type": "string"},
+			"file_id": map[string]interface{}{"type": "string"},
+			"source":  map[string]interface{}{"type": "string", "enum": []string{"proxy", "seafile"}},
+		},
+	},
+	"FileLockStatus": map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"path":   map[string]interface{}{"type": "string"},
+			"locked": map[string]interface{}{"type": "boolean"},
+			"lock": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"path":      map[string]interface{}{"type": "string"},
+					"owner":     map[string]interface{}{"type": "string"},
+					"locked_at": map[string]interface{}{"type": "string", "format": "date-time"},
+				},
+			},
+		},
+	},
+	"ActivityEvents": map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"page":     map[string]interface{}{"type": "integer"},
+			"has_more": map[string]interface{}{"type": "boolean"},
+			"events": map[string]interface{}{"type": "array", "items": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"path":      map[string]interface{}{"type": "string"},
+					"name":      map[string]interface{}{"type": "string"},
+					"type":      map[string]interface{}{"type": "string", "enum": []string{"file", "dir", "repo"}},
+					"operation": map[string]interface{}{"type": "string", "example": "create"},
+					"author":    map[string]interface{}{"type": "string"},
+					"time":      map[string]interface{}{"type": "string", "format": "date-time"},
+					"old_path":  map[string]interface{}{"type": "string"},
+				},
+			}},
+		},
+	},
+	"Tag": map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"name":        map[string]interface{}{"type": "string"},
+			"color":       map[string]interface{}{"type": "string"},
+			"files_count": map[string]interface{}{"type": "integer"},
+		},
+	},
+	"Tags": map[string]interface{}{"type": "array", "items": schemaRef("Tag")},
+	"FileTags": map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"path": map[string]interface{}{"type": "string"},
+			"tags": schemaRef("Tags"),
+		},
+	},
+	"TaggedFiles": map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"tag": map[string]interface{}{"type": "string"},
+			"files": map[string]interface{}{"type": "array", "items": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"path":  map[string]interface{}{"type": "string"},
+					"name":  map[string]interface{}{"type": "string"},
+					"size":  map[string]interface{}{"type": "integer", "format": "int64"},
+					"mtime": map[string]interface{}{"type": "string", "format": "date-time"},
+				},
+			}},
+		},
+	},
+	"UploadResult": map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"uploaded": map[string]interface{}{"type": "integer"},
+			"files": map[string]interface{}{"type": "array", "items": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"path":     map[string]interface{}{"type": "string"},
+					"hash":     map[string]interface{}{"type": "string"},
+					"skipped":  map[string]interface{}{"type": "boolean"},
+					"conflict": map[string]interface{}{"type": "boolean"},
+				},
+			}},
+		},
+	},
+}
+
+// OpenAPI 3 document of /api/v1.
+func openAPIDocument() map[string]interface{} {
+	error_response := map[string]interface{}{
+		"description": "Error",
+		"content":     map[string]interface{}{"application/json": map[string]interface{}{"schema": schemaRef("Error")}},
+	}
+
+	paths := make(map[string]interface{})
+	for _, op := range api_operations {
+		operation := map[string]interface{}{
+			"summary":     op.Summary,
+			"operationId": strings.ToLower(op.Method) + strings.Replace(strings.Title(strings.Replace(strings.TrimPrefix(op.Path, "/api/v1/"), "/", " ", -1)), " ", "", -1),
+			"responses":   map[string]interface{}{"default": error_response},
+			"security":    []interface{}{map[string]interface{}{"apiKey": []string{}}, map[string]interface{}{"apiKeyQuery": []string{}}},
+		}
+		if op.AdminRole != "" {
+			operation["security"] = []interface{}{map[string]interface{}{"adminKey": []string{}}}
+			op.Description = strings.TrimSpace(op.Description + " Needs admin key with " + op.AdminRole + " role.")
+		}
+		if op.Description != "" {
+			operation["description"] = op.Description
+		}
+
+		status := op.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		response := map[string]interface{}{"description": http.StatusText(status)}
+		if op.Response != "" {
+			response["content"] = map[string]interface{}{"application/json": map[string]interface{}{"schema": envelopeSchema(schemaRef(op.Response))}}
+		}
+		operation["responses"].(map[string]interface{})[strconv.Itoa(status)] = response
+
+		if op.Method == "GET" || op.Method == "DELETE" {
+			var params []interface{}
+			for _, param := range op.Params {
+				params = append(params, map[string]interface{}{
+					"name": param.Name, "in": "query", "required": param.Required,
+					"description": param.Description, "schema": paramSchema(param),
+				})
+			}
+			if params != nil {
+				operation["parameters"] = params
+			}
+		} else {
+			properties := make(map[string]interface{})
+			required := []string{}
+			for _, param := range op.Params {
+				schema := paramSchema(param)
+				if param.Description != "" {
+					schema["description"] = param.Description
+				}
+				properties[param.Name] = schema
+				if param.Required {
+					required = append(required, param.Name)
+				}
+			}
+
+			content := map[string]interface{}{}
+			if op.Multipart {
+				properties["file"] = map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string", "format": "binary"}}
+				required = append(required, "file")
+				content["multipart/form-data"] = map[string]interface{}{"schema": map[string]interface{}{"type": "object", "properties": properties, "required": required}}
+			} else {
+				schema := map[string]interface{}{"type": "object", "properties": properties}
+				if len(required) > 0 {
+					schema["required"] = required
+				}
+				content["application/json"] = map[string]interface{}{"schema": schema}
+				content["application/x-www-form-urlencoded"] = map[string]interface{}{"schema": schema}
+			}
+			operation["requestBody"] = map[string]interface{}{"required": len(required) > 0, "content": content}
+		}
+
+		methods, ok := paths[op.Path].(map[string]interface{})
+		if !ok {
+			methods = make(map[string]interface{})
+			paths[op.Path] = methods
+		}
+		methods[strings.ToLower(op.Method)] = operation
+	}
+
+	paths["/api/v1/get/{path}"] = map[string]interface{}{
+		"get": map[string]interface{}{
+			"summary":     "Download file",
+			"operationId": "getFile",
+			"parameters": []interface{}{map[string]interface{}{
+				"name": "path", "in": "path", "required": true, "schema": map[string]interface{}{"type": "string"},
+				"description": "Path in the proxy tree without the leading slash",
+			}},
+			"responses": map[string]interface{}{
+				"200":     map[string]interface{}{"description": "File content", "content": map[string]interface{}{"application/octet-stream": map[string]interface{}{"schema": map[string]interface{}{"type": "string", "format": "binary"}}}},
+				"default": error_response,
+			},
+		},
+	}
+
+	document := map[string]interface{}{
+		"openapi": "3.0.3",
+		"info":    map[string]interface{}{"title": "seafile-uploader", "version": "v1"},
+		"paths":   paths,
+		"components": map[string]interface{}{
+			"schemas": api_schemas,
+			"securitySchemes": map[string]interface{}{
+				"apiKey":      map[string]interface{}{"type": "apiKey", "in": "header", "name": "X-Api-Key"},
+				"apiKeyQuery": map[string]interface{}{"type": "apiKey", "in": "query", "name": "api_key"},
+				"adminKey":    map[string]interface{}{"type": "apiKey", "in": "header", "name": "X-Admin-Key"},
+			},
+		},
+	}
+	if public_url != "" {
+		document["servers"] = []interface{}{map[string]interface{}{"url": public_url}}
+	}
+
+	return document
+}
+
+// GET /api/openapi.json
+func openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println(r.Method, r.RequestURI)
+
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, openAPIDocument())
+}
@@ -0,0 +1,383 @@
+// Package client calls /api/v1 of seafile-uploader proxy, so services don't
+// have to hand-write HTTP requests:
+//
+//	proxy := client.New("https://files.example.com", "my-api-key")
+//	result, err := proxy.Upload("/photos/", "cat.jpg", file, nil)
+//	listing, err := proxy.ListDir("/photos/", nil)
+//
+// Errors answered by the proxy are *Error with the status and error code.
+//
+// TypeScript services can use ts/client.ts, generated from /api/openapi.json
+// by "seafile-uploader typescript".
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/lazureykis/seafile-uploader/pkg/seafile"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+type Client struct {
+	// Proxy address. For example: "https://files.example.com"
+	URL string
+
+	// Sent as X-Api-Key, see SEAFILE_PROXY_API_KEYS. Empty for anonymous access.
+	APIKey string
+
+	// Sent as X-Admin-Key to endpoints which need an admin role, like CreateRepo.
+	AdminKey string
+
+	// http.DefaultClient when nil.
+	HTTPClient *http.Client
+}
+
+func New(proxy_url, api_key string) *Client {
+	return &Client{URL: strings.TrimRight(proxy_url, "/"), APIKey: api_key}
+}
+
+// Error object of API response.
+type Error struct {
+	StatusCode int
+	Code       string `json:"code"`
+	Message    string `json:"message"`
+
+	// Seconds to wait before retrying, for 429 and 503 answers.
+	RetryAfter int
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+type envelope struct {
+	Data     json.RawMessage `json:"data"`
+	Error    *Error          `json:"error"`
+	Warnings []string        `json:"warnings"`
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+// Sends request to path under /api/v1 and decodes data of the envelope into result.
+// Returns warnings of the response, like quota ones.
+func (c *Client) do(method, path string, body io.Reader, header http.Header, result interface{}) ([]string, error) {
+	req, err := http.NewRequest(method, c.URL+"/api/v1"+path, body)
+	if err != nil {
+		return nil, err
+	}
+
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.APIKey != "" {
+		req.Header.Set("X-Api-Key", c.APIKey)
+	}
+	if c.AdminKey != "" {
+		req.Header.Set("X-Admin-Key", c.AdminKey)
+	}
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNoContent || resp.StatusCode == http.StatusNotModified || method == "HEAD" {
+		if resp.StatusCode >= 400 {
+			return nil, &Error{StatusCode: resp.StatusCode, Message: resp.Status}
+		}
+		return nil, nil
+	}
+
+	var response envelope
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		if resp.StatusCode >= 400 {
+			return nil, &Error{StatusCode: resp.StatusCode, Message: resp.Status}
+		}
+		return nil, fmt.Errorf("Invalid response of %s %s: %v", method, path, err)
+	}
+
+	if response.Error != nil || resp.StatusCode >= 400 {
+		api_error := response.Error
+		if api_error == nil {
+			api_error = &Error{Message: resp.Status}
+		}
+		api_error.StatusCode = resp.StatusCode
+		api_error.RetryAfter, _ = strconv.Atoi(resp.Header.Get("Retry-After"))
+		return response.Warnings, api_error
+	}
+
+	if result != nil && len(response.Data) > 0 {
+		if err := json.Unmarshal(response.Data, result); err != nil {
+			return response.Warnings, err
+		}
+	}
+
+	return response.Warnings, nil
+}
+
+func (c *Client) get(path string, params url.Values, result interface{}) error {
+	_, err := c.do("GET", path+"?"+params.Encode(), nil, nil, result)
+	return err
+}
+
+// Sends params as JSON object.
+func (c *Client) post(path string, params map[string]interface{}, header http.Header, result interface{}) error {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+
+	if header == nil {
+		header = http.Header{}
+	}
+	header.Set("Content-Type", "application/json")
+
+	_, err = c.do("POST", path, bytes.NewReader(data), header, result)
+	return err
+}
+
+// Precondition on the current file id, see If-Match of the API.
+func ifMatch(id string) http.Header {
+	if id == "" {
+		return nil
+	}
+	return http.Header{"If-Match": {`"` + id + `"`}}
+}
+
+// File or folder with custom metadata.
+type Entry struct {
+	seafile.FileSpec
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+}
+
+type DirectoryListing struct {
+	Path    string  `json:"path"`
+	Entries []Entry `json:"entries"`
+}
+
+// Lists the folder, optionally only files with matching metadata.
+func (c *Client) ListDir(folder string, metadata map[string]string) (DirectoryListing, error) {
+	var listing DirectoryListing
+
+	params := url.Values{"p": {folder}}
+	for key, value := range metadata {
+		params.Set("meta."+key, value)
+	}
+
+	err := c.get("/dir", params, &listing)
+	return listing, err
+}
+
+// Creates the folder, with missing parents when parents is true.
+func (c *Client) Mkdir(folder string, parents bool) error {
+	return c.post("/dir?"+url.Values{"p": {folder}}.Encode(), map[string]interface{}{"parents": parents}, nil, nil)
+}
+
+// Details and metadata of the file.
+func (c *Client) Stat(path string) (Entry, error) {
+	var entry Entry
+	err := c.get("/stat", url.Values{"p": {path}}, &entry)
+	return entry, err
+}
+
+// Removes the file. With non-empty if_match it's removed only if its id still matches.
+func (c *Client) Delete(path, if_match string) error {
+	_, err := c.do("DELETE", "/file?"+url.Values{"p": {path}}.Encode(), nil, ifMatch(if_match), nil)
+	return err
+}
+
+// Moves or renames the file.
+func (c *Client) Move(src, dst, if_match string) (Entry, error) {
+	var entry Entry
+	err := c.post("/file/move", map[string]interface{}{"src": src, "dst": dst}, ifMatch(if_match), &entry)
+	return entry, err
+}
+
+// Copies file or folder (ending with slash) into dst folder.
+func (c *Client) Copy(src, dst string) (Entry, error) {
+	var entry Entry
+	err := c.post("/file/copy", map[string]interface{}{"src": src, "dst": dst}, nil, &entry)
+	return entry, err
+}
+
+type FileRevision struct {
+	CommitId    string           `json:"commit_id"`
+	FileId      string           `json:"file_id"`
+	Size        int64            `json:"size"`
+	MTime       seafile.UnixTime `json:"mtime"`
+	Creator     string           `json:"creator,omitempty"`
+	Description string           `json:"description,omitempty"`
+	RenamedFrom string           `json:"renamed_from,omitempty"`
+}
+
+// Prior revisions of the file, newest first.
+func (c *Client) History(path string) ([]FileRevision, error) {
+	var history struct {
+		Revisions []FileRevision `json:"revisions"`
+	}
+	err := c.get("/file/history", url.Values{"p": {path}}, &history)
+	return history.Revisions, err
+}
+
+// Restores revision of the file.
+func (c *Client) Revert(path, commit_id, if_match string) (Entry, error) {
+	var entry Entry
+	err := c.post("/file/revert", map[string]interface{}{"p": path, "commit_id": commit_id}, ifMatch(if_match), &entry)
+	return entry, err
+}
+
+type SearchResult struct {
+	Path  string           `json:"path"`
+	Name  string           `json:"name"`
+	Type  string           `json:"type"`
+	Size  int64            `json:"size"`
+	MTime seafile.UnixTime `json:"mtime"`
+	URL   string           `json:"url"`
+}
+
+type SearchResults struct {
+	Query   string         `json:"query"`
+	Total   int            `json:"total"`
+	HasMore bool           `json:"has_more"`
+	Results []SearchResult `json:"results"`
+}
+
+// Searches proxied libraries. Pages start at 1.
+func (c *Client) Search(query string, page, per_page int) (SearchResults, error) {
+	var results SearchResults
+	params := url.Values{"q": {query}, "page": {strconv.Itoa(page)}, "per_page": {strconv.Itoa(per_page)}}
+	err := c.get("/search", params, &results)
+	return results, err
+}
+
+type ShareLink struct {
+	Path       string `json:"path"`
+	Link       string `json:"link"`
+	Token      string `json:"token"`
+	ExpireDate string `json:"expire_date,omitempty"`
+	Password   bool   `json:"password_protected"`
+}
+
+// Creates share link. Empty password and zero expire_days are not set.
+func (c *Client) Share(path, password string, expire_days int) (ShareLink, error) {
+	var link ShareLink
+
+	params := map[string]interface{}{"p": path}
+	if password != "" {
+		params["password"] = password
+	}
+	if expire_days > 0 {
+		params["expire_days"] = expire_days
+	}
+
+	err := c.post("/share", params, nil, &link)
+	return link, err
+}
+
+type Repo struct {
+	seafile.Repo
+	Prefix  string `json:"prefix,omitempty"`
+	Default bool   `json:"default"`
+}
+
+// Libraries visible to the proxy.
+func (c *Client) Repos() ([]Repo, error) {
+	var repos []Repo
+	err := c.get("/repos", nil, &repos)
+	return repos, err
+}
+
+// Creates library, encrypted when password is given. Needs AdminKey.
+func (c *Client) CreateRepo(name, desc, password string) (Repo, error) {
+	var repo Repo
+	err := c.post("/repos", map[string]interface{}{"name": name, "desc": desc, "password": password}, nil, &repo)
+	return repo, err
+}
+
+type UploadedFile struct {
+	Path     string `json:"path"`
+	Hash     string `json:"hash,omitempty"`
+	Skipped  bool   `json:"skipped,omitempty"`
+	Conflict bool   `json:"conflict,omitempty"`
+}
+
+type UploadResult struct {
+	Uploaded int            `json:"uploaded"`
+	Files    []UploadedFile `json:"files"`
+	Warnings []string       `json:"-"`
+}
+
+// Uploads src as filename into folder, streaming it. Fields are sent along,
+// like metadata (x-meta-owner) or strip_exif.
+func (c *Client) Upload(folder, filename string, src io.Reader, fields map[string]string) (UploadResult, error) {
+	var result UploadResult
+
+	pipe_reader, pipe_writer := io.Pipe()
+	defer pipe_reader.Close()
+
+	multipart_writer := multipart.NewWriter(pipe_writer)
+	go func() {
+		multipart_writer.WriteField("folder", folder)
+		for name, value := range fields {
+			multipart_writer.WriteField(name, value)
+		}
+
+		part, err := multipart_writer.CreateFormFile("file", filename)
+		if err == nil {
+			_, err = io.Copy(part, src)
+		}
+		if err == nil {
+			err = multipart_writer.Close()
+		}
+		pipe_writer.CloseWithError(err)
+	}()
+
+	header := http.Header{"Content-Type": {multipart_writer.FormDataContentType()}}
+	warnings, err := c.do("POST", "/upload", pipe_reader, header, &result)
+	result.Warnings = warnings
+	return result, err
+}
+
+// Opens the file for reading. Caller closes it.
+func (c *Client) Download(path string) (io.ReadCloser, error) {
+	escaped := (&url.URL{Path: path}).EscapedPath()
+
+	req, err := http.NewRequest("GET", c.URL+"/api/v1/get"+escaped, nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.APIKey != "" {
+		req.Header.Set("X-Api-Key", c.APIKey)
+	}
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+
+		var response envelope
+		if json.NewDecoder(resp.Body).Decode(&response) == nil && response.Error != nil {
+			response.Error.StatusCode = resp.StatusCode
+			return nil, response.Error
+		}
+		return nil, &Error{StatusCode: resp.StatusCode, Message: resp.Status}
+	}
+
+	return resp.Body, nil
+}
@@ -0,0 +1,104 @@
+package client
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestUploadSendsMultipart(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/api/v1/upload" {
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		if r.Header.Get("X-Api-Key") != "key" {
+			t.Errorf("X-Api-Key is %q", r.Header.Get("X-Api-Key"))
+		}
+
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		content, _ := ioutil.ReadAll(file)
+		if r.FormValue("folder") != "/docs/" || r.FormValue("x-meta-owner") != "bob" || header.Filename != "a.txt" || string(content) != "hello" {
+			t.Errorf("Unexpected form: folder=%q owner=%q file=%q %q", r.FormValue("folder"), r.FormValue("x-meta-owner"), header.Filename, content)
+		}
+
+		w.Write([]byte(`{"data": {"uploaded": 1, "files": [{"path": "/docs/a.txt", "hash": "abc"}]}, "warnings": ["quota"]}`))
+	}))
+	defer server.Close()
+
+	result, err := New(server.URL, "key").Upload("/docs/", "a.txt", strings.NewReader("hello"), map[string]string{"x-meta-owner": "bob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Uploaded != 1 || len(result.Files) != 1 || result.Files[0].Path != "/docs/a.txt" {
+		t.Fatalf("Unexpected result: %+v", result)
+	}
+	if len(result.Warnings) != 1 || result.Warnings[0] != "quota" {
+		t.Fatalf("Warnings are %v", result.Warnings)
+	}
+}
+
+func TestDownloadStreamsFile(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.EscapedPath() != "/api/v1/get/my%20docs/a.txt" {
+			t.Errorf("Unexpected path %q", r.URL.EscapedPath())
+		}
+		w.Write([]byte("hello"))
+	}))
+	defer server.Close()
+
+	body, err := New(server.URL, "").Download("/my docs/a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer body.Close()
+
+	content, _ := ioutil.ReadAll(body)
+	if string(content) != "hello" {
+		t.Fatalf("Downloaded %q", content)
+	}
+}
+
+func TestErrorIsDecoded(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"error": {"code": "rate_limited", "message": "Too many requests"}}`))
+	}))
+	defer server.Close()
+
+	proxy := New(server.URL, "key")
+
+	_, err := proxy.Stat("/a.txt")
+	var api_error *Error
+	if !errors.As(err, &api_error) {
+		t.Fatalf("Stat returned %v, want *Error", err)
+	}
+	if api_error.StatusCode != 429 || api_error.Code != "rate_limited" || api_error.Message != "Too many requests" || api_error.RetryAfter != 30 {
+		t.Fatalf("Unexpected error: %+v", api_error)
+	}
+
+	_, err = proxy.Download("/a.txt")
+	if !errors.As(err, &api_error) || api_error.StatusCode != 429 || api_error.Code != "rate_limited" {
+		t.Fatalf("Download returned %v", err)
+	}
+}
+
+func TestErrorWithoutEnvelope(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Bad Gateway", http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	err := New(server.URL, "").Mkdir("/docs/", true)
+	var api_error *Error
+	if !errors.As(err, &api_error) || api_error.StatusCode != http.StatusBadGateway {
+		t.Fatalf("Mkdir returned %v", err)
+	}
+}
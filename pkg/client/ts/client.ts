@@ -0,0 +1,558 @@
+// Client of seafile-uploader /api/v1.
+// Generated by "seafile-uploader typescript" from /api/openapi.json, don't edit.
+//
+//	const proxy = new Client("https://files.example.com", "my-api-key");
+//	const listing = await proxy.getDir({ p: "/photos/" });
+//
+// Errors answered by the proxy are thrown as ProxyError with the status and error code.
+
+export interface Envelope<T> {
+  data: T;
+  warnings?: string[];
+}
+
+export class ProxyError extends Error {
+  constructor(public status: number, public code: string, message: string) {
+    super(message);
+  }
+}
+
+type Params = Record<string, unknown>;
+
+export class Client {
+  // url is the proxy address, apiKey is sent as X-Api-Key and adminKey as X-Admin-Key.
+  constructor(public url: string, public apiKey = "", public adminKey = "") {}
+
+  private async request(method: string, path: string, query: Params, body: Params | null, admin: boolean, multipart: boolean): Promise<Response> {
+    const search = new URLSearchParams();
+    for (const [name, value] of Object.entries(query)) {
+      for (const item of Array.isArray(value) ? value : [value]) {
+        if (item !== undefined && item !== null) {
+          search.append(name, String(item));
+        }
+      }
+    }
+
+    const headers: Record<string, string> = {};
+    if (admin && this.adminKey) {
+      headers["X-Admin-Key"] = this.adminKey;
+    } else if (this.apiKey) {
+      headers["X-Api-Key"] = this.apiKey;
+    }
+
+    let payload: BodyInit | undefined;
+    if (body && multipart) {
+      const form = new FormData();
+      for (const [name, value] of Object.entries(body)) {
+        for (const item of Array.isArray(value) ? value : [value]) {
+          if (item !== undefined && item !== null) {
+            form.append(name, item instanceof Blob ? item : String(item));
+          }
+        }
+      }
+      payload = form;
+    } else if (body) {
+      headers["Content-Type"] = "application/json";
+      payload = JSON.stringify(body);
+    }
+
+    const query_string = search.toString();
+    const response = await fetch(this.url.replace(/\/+$/, "") + path + (query_string ? "?" + query_string : ""), { method, headers, body: payload });
+    if (!response.ok) {
+      let code = "";
+      let message = response.statusText;
+      try {
+        const answer = await response.json();
+        code = answer.error.code;
+        message = answer.error.message;
+      } catch (e) {
+        // Not the JSON error of the proxy.
+      }
+      throw new ProxyError(response.status, code, message);
+    }
+    return response;
+  }
+
+  /** GET /api/v1/dir: List folder. Files may be filtered by metadata: meta.owner=alice */
+  async getDir(params: {
+    /** Path in the proxy tree */
+    p: string;
+  }): Promise<Envelope<DirectoryListing>> {
+    const { p } = params;
+    const response = await this.request("GET", "/api/v1/dir", { p }, null, false, false);
+    return response.json();
+  }
+
+  /** POST /api/v1/dir: Create folder */
+  async postDir(params: {
+    /** Path in the proxy tree */
+    p: string;
+    /** Create missing parents, existing folder is not an error */
+    parents?: boolean;
+  }): Promise<Envelope<DirectoryListing>> {
+    const { p, parents } = params;
+    const response = await this.request("POST", "/api/v1/dir", {}, { p, parents }, false, false);
+    return response.json();
+  }
+
+  /** GET /api/v1/events: Recent changes */
+  async getEvents(params: {
+    /** Only changes in the folder */
+    p?: string;
+    page?: number;
+    per_page?: number;
+  } = {}): Promise<Envelope<ActivityEvents>> {
+    const { p, page, per_page } = params;
+    const response = await this.request("GET", "/api/v1/events", { p, page, per_page }, null, false, false);
+    return response.json();
+  }
+
+  /** DELETE /api/v1/file: Delete file */
+  async deleteFile(params: {
+    /** Path in the proxy tree */
+    p: string;
+  }): Promise<void> {
+    const { p } = params;
+    await this.request("DELETE", "/api/v1/file", { p }, null, false, false);
+  }
+
+  /** POST /api/v1/file/copy: Copy file or folder into folder */
+  async postFileCopy(params: {
+    /** Folder */
+    dst: string;
+    /** File, or folder ending with a slash */
+    src: string;
+  }): Promise<Envelope<Entry>> {
+    const { dst, src } = params;
+    const response = await this.request("POST", "/api/v1/file/copy", {}, { dst, src }, false, false);
+    return response.json();
+  }
+
+  /** GET /api/v1/file/detail: File details */
+  async getFileDetail(params: {
+    /** Path in the proxy tree */
+    p: string;
+  }): Promise<Envelope<Entry>> {
+    const { p } = params;
+    const response = await this.request("GET", "/api/v1/file/detail", { p }, null, false, false);
+    return response.json();
+  }
+
+  /** GET /api/v1/file/history: File revisions */
+  async getFileHistory(params: {
+    /** Path in the proxy tree */
+    p: string;
+  }): Promise<Envelope<FileHistory>> {
+    const { p } = params;
+    const response = await this.request("GET", "/api/v1/file/history", { p }, null, false, false);
+    return response.json();
+  }
+
+  /** GET /api/v1/file/lock: File lock */
+  async getFileLock(params: {
+    /** Path in the proxy tree */
+    p: string;
+  }): Promise<Envelope<FileLockStatus>> {
+    const { p } = params;
+    const response = await this.request("GET", "/api/v1/file/lock", { p }, null, false, false);
+    return response.json();
+  }
+
+  /** POST /api/v1/file/lock: Lock file. Other API keys can't change the file until it is unlocked. Needs Seafile Professional. */
+  async postFileLock(params: {
+    /** Path in the proxy tree */
+    p: string;
+  }): Promise<Envelope<FileLockStatus>> {
+    const { p } = params;
+    const response = await this.request("POST", "/api/v1/file/lock", {}, { p }, false, false);
+    return response.json();
+  }
+
+  /** DELETE /api/v1/file/lock: Unlock file. Only the API key which locked the file, or admin key with operator role, can unlock it. */
+  async deleteFileLock(params: {
+    /** Path in the proxy tree */
+    p: string;
+  }): Promise<void> {
+    const { p } = params;
+    await this.request("DELETE", "/api/v1/file/lock", { p }, null, false, false);
+  }
+
+  /** POST /api/v1/file/move: Move or rename file */
+  async postFileMove(params: {
+    dst: string;
+    src: string;
+  }): Promise<Envelope<Entry>> {
+    const { dst, src } = params;
+    const response = await this.request("POST", "/api/v1/file/move", {}, { dst, src }, false, false);
+    return response.json();
+  }
+
+  /** POST /api/v1/file/revert: Restore file revision */
+  async postFileRevert(params: {
+    commit_id: string;
+    /** Path in the proxy tree */
+    p: string;
+  }): Promise<Envelope<Entry>> {
+    const { commit_id, p } = params;
+    const response = await this.request("POST", "/api/v1/file/revert", {}, { commit_id, p }, false, false);
+    return response.json();
+  }
+
+  /** POST /api/v1/files/delete: Delete files */
+  async postFilesDelete(params: {
+    /** File paths, the body may also be a JSON array of them */
+    paths?: string[];
+  } = {}): Promise<Envelope<BatchDeleteResults>> {
+    const { paths } = params;
+    const response = await this.request("POST", "/api/v1/files/delete", {}, { paths }, false, false);
+    return response.json();
+  }
+
+  /** GET /api/v1/get/{path}: Download file */
+  async getFile(params: {
+    /** Path in the proxy tree without the leading slash */
+    path: string;
+  }): Promise<Blob> {
+    const { path } = params;
+    const response = await this.request("GET", "/api/v1/get/" + String(path).replace(/^\/+/, "").split("/").map(encodeURIComponent).join("/"), {}, null, false, false);
+    return response.blob();
+  }
+
+  /** GET /api/v1/provenance: Find files by provenance. At least one of system, job_id and commit is required */
+  async getProvenance(params: {
+    /** Matches by prefix */
+    commit?: string;
+    job_id?: string;
+    system?: string;
+  } = {}): Promise<Envelope<ProvenanceResults>> {
+    const { commit, job_id, system } = params;
+    const response = await this.request("GET", "/api/v1/provenance", { commit, job_id, system }, null, false, false);
+    return response.json();
+  }
+
+  /** GET /api/v1/repos: List libraries */
+  async getRepos(): Promise<Envelope<Repos>> {
+    const response = await this.request("GET", "/api/v1/repos", {}, null, false, false);
+    return response.json();
+  }
+
+  /** POST /api/v1/repos: Create library. Needs admin key with admin role. */
+  async postRepos(params: {
+    desc?: string;
+    name: string;
+    /** Makes the library encrypted */
+    password?: string;
+  }): Promise<Envelope<Repo>> {
+    const { desc, name, password } = params;
+    const response = await this.request("POST", "/api/v1/repos", {}, { desc, name, password }, true, false);
+    return response.json();
+  }
+
+  /** GET /api/v1/search: Search files */
+  async getSearch(params: {
+    page?: number;
+    per_page?: number;
+    q: string;
+  }): Promise<Envelope<SearchResults>> {
+    const { page, per_page, q } = params;
+    const response = await this.request("GET", "/api/v1/search", { page, per_page, q }, null, false, false);
+    return response.json();
+  }
+
+  /** POST /api/v1/share: Create share link */
+  async postShare(params: {
+    expire_days?: number;
+    /** Path in the proxy tree */
+    p: string;
+    password?: string;
+  }): Promise<Envelope<ShareLink>> {
+    const { expire_days, p, password } = params;
+    const response = await this.request("POST", "/api/v1/share", {}, { expire_days, p, password }, false, false);
+    return response.json();
+  }
+
+  /** GET /api/v1/stat: File details */
+  async getStat(params: {
+    /** Path in the proxy tree */
+    p: string;
+  }): Promise<Envelope<Entry>> {
+    const { p } = params;
+    const response = await this.request("GET", "/api/v1/stat", { p }, null, false, false);
+    return response.json();
+  }
+
+  /** GET /api/v1/tags: List tags */
+  async getTags(): Promise<Envelope<Tags>> {
+    const response = await this.request("GET", "/api/v1/tags", {}, null, false, false);
+    return response.json();
+  }
+
+  /** POST /api/v1/tags: Define tag in every library */
+  async postTags(params: {
+    /** #999999 by default */
+    color?: string;
+    name: string;
+  }): Promise<Envelope<Tag>> {
+    const { color, name } = params;
+    const response = await this.request("POST", "/api/v1/tags", {}, { color, name }, false, false);
+    return response.json();
+  }
+
+  /** GET /api/v1/tags/files: Files by tag or tags of file. With tag lists files having it, with p lists tags of the file */
+  async getTagsFiles(params: {
+    p?: string;
+    tag?: string;
+  } = {}): Promise<Envelope<TaggedFiles>> {
+    const { p, tag } = params;
+    const response = await this.request("GET", "/api/v1/tags/files", { p, tag }, null, false, false);
+    return response.json();
+  }
+
+  /** POST /api/v1/tags/files: Tag file */
+  async postTagsFiles(params: {
+    /** Color of the tag when it is created */
+    color?: string;
+    /** Path in the proxy tree */
+    p: string;
+    tag: string;
+  }): Promise<Envelope<FileTags>> {
+    const { color, p, tag } = params;
+    const response = await this.request("POST", "/api/v1/tags/files", {}, { color, p, tag }, false, false);
+    return response.json();
+  }
+
+  /** DELETE /api/v1/tags/files: Untag file */
+  async deleteTagsFiles(params: {
+    /** Path in the proxy tree */
+    p: string;
+    tag: string;
+  }): Promise<Envelope<FileTags>> {
+    const { p, tag } = params;
+    const response = await this.request("DELETE", "/api/v1/tags/files", { p, tag }, null, false, false);
+    return response.json();
+  }
+
+  /** POST /api/v1/upload: Upload files */
+  async postUpload(params: {
+    callback?: string;
+    file: Blob[];
+    /** Target folder, may contain {date}, {uuid}, {api_key} and {filename_ext} */
+    folder?: string;
+    latest?: string;
+    /** Commit of the code, also X-Provenance-Commit header */
+    provenance_commit?: string;
+    /** Job of the system, also X-Provenance-Job-Id header */
+    provenance_job_id?: string;
+    /** System which produced the files, also X-Provenance-System header */
+    provenance_system?: string;
+    /** SHA-256 of the file, one per file */
+    sha256?: string;
+    strip_exif?: boolean;
+  }): Promise<Envelope<UploadResult>> {
+    const { callback, file, folder, latest, provenance_commit, provenance_job_id, provenance_system, sha256, strip_exif } = params;
+    const response = await this.request("POST", "/api/v1/upload", {}, { callback, file, folder, latest, provenance_commit, provenance_job_id, provenance_system, sha256, strip_exif }, false, true);
+    return response.json();
+  }
+
+  /** GET /api/v1/watch: List watch webhooks */
+  async getWatch(): Promise<Envelope<WatchSubscriptions>> {
+    const response = await this.request("GET", "/api/v1/watch", {}, null, false, false);
+    return response.json();
+  }
+
+  /** POST /api/v1/watch: Register watch webhook. Changes under prefix are POSTed to url as ChangeEvent */
+  async postWatch(params: {
+    /** Watched folder */
+    prefix: string;
+    url: string;
+  }): Promise<Envelope<WatchSubscription>> {
+    const { prefix, url } = params;
+    const response = await this.request("POST", "/api/v1/watch", {}, { prefix, url }, false, false);
+    return response.json();
+  }
+
+  /** DELETE /api/v1/watch: Remove watch webhook */
+  async deleteWatch(params: {
+    id: string;
+  }): Promise<void> {
+    const { id } = params;
+    await this.request("DELETE", "/api/v1/watch", { id }, null, false, false);
+  }
+
+  /** GET /api/v1/watch/stream: Stream changes. text/event-stream of ChangeEvent */
+  async getWatchStream(params: {
+    /** Watched folder */
+    prefix: string;
+  }): Promise<Response> {
+    const { prefix } = params;
+    return this.request("GET", "/api/v1/watch/stream", { prefix }, null, false, false);
+  }
+}
+
+export interface ActivityEvents {
+  events?: Array<{
+    author?: string;
+    name?: string;
+    old_path?: string;
+    operation?: string;
+    path?: string;
+    time?: string;
+    type?: "file" | "dir" | "repo";
+  }>;
+  has_more?: boolean;
+  page?: number;
+}
+
+export interface BatchDeleteResults {
+  deleted?: number;
+  results?: {
+    error?: string;
+    path?: string;
+    status?: number;
+  }[];
+}
+
+export interface ChangeEvent {
+  file_id?: string;
+  from?: string;
+  id?: string;
+  path?: string;
+  source?: "proxy" | "seafile";
+  time?: string;
+  type?: "uploaded" | "created" | "updated" | "deleted" | "moved" | "copied" | "reverted";
+}
+
+export interface DirectoryListing {
+  entries?: Entry[];
+  path?: string;
+}
+
+export interface Entry {
+  id?: string;
+  metadata?: Record<string, unknown>;
+  mtime?: string;
+  name?: string;
+  size?: number;
+  type?: "file" | "dir";
+}
+
+export interface ErrorResponse {
+  error?: {
+    code: string;
+    message: string;
+  };
+}
+
+export interface FileHistory {
+  path?: string;
+  revisions?: {
+    commit_id?: string;
+    creator?: string;
+    description?: string;
+    file_id?: string;
+    mtime?: string;
+    renamed_from?: string;
+    size?: number;
+  }[];
+}
+
+export interface FileLockStatus {
+  lock?: {
+    locked_at?: string;
+    owner?: string;
+    path?: string;
+  };
+  locked?: boolean;
+  path?: string;
+}
+
+export interface FileTags {
+  path?: string;
+  tags?: Tags;
+}
+
+export interface Provenance {
+  commit?: string;
+  job_id?: string;
+  system?: string;
+}
+
+export interface ProvenanceResults {
+  results?: {
+    path?: string;
+    provenance?: Provenance;
+  }[];
+}
+
+export interface Repo {
+  default?: boolean;
+  encrypted?: boolean;
+  id?: string;
+  mtime?: string;
+  name?: string;
+  owner?: string;
+  permission?: string;
+  prefix?: string;
+  size?: number;
+}
+
+export type Repos = Repo[];
+
+export interface SearchResults {
+  has_more?: boolean;
+  query?: string;
+  results?: Array<{
+    mtime?: string;
+    name?: string;
+    path?: string;
+    size?: number;
+    type?: "file" | "dir";
+    url?: string;
+  }>;
+  total?: number;
+}
+
+export interface ShareLink {
+  expire_date?: string;
+  link?: string;
+  password_protected?: boolean;
+  path?: string;
+  token?: string;
+}
+
+export interface Tag {
+  color?: string;
+  files_count?: number;
+  name?: string;
+}
+
+export interface TaggedFiles {
+  files?: {
+    mtime?: string;
+    name?: string;
+    path?: string;
+    size?: number;
+  }[];
+  tag?: string;
+}
+
+export type Tags = Tag[];
+
+export interface UploadResult {
+  files?: {
+    conflict?: boolean;
+    hash?: string;
+    path?: string;
+    skipped?: boolean;
+  }[];
+  uploaded?: number;
+}
+
+export interface WatchSubscription {
+  created?: string;
+  id?: string;
+  prefix?: string;
+  url?: string;
+}
+
+export type WatchSubscriptions = WatchSubscription[];
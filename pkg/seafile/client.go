@@ -0,0 +1,216 @@
+// Package seafile is a client of Seafile Web API (api2).
+//
+// Paths are paths inside a library, the library is given by its id:
+//
+//	client := seafile.New("https://cloud.seafile.com", "f2210dacd9c6ccb8133606d94ff8e61d99b477fd")
+//	spec, err := client.FileDetail("99b758e6-91ab-4265-b705-925367374cf0", "/foo/bar.jpg")
+package seafile
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	REPO_ID_SIZE            = 36
+	UPLOADED_FILE_HASH_SIZE = 40
+	PATH_DOESNT_EXIST_MSG   = "Path does not exist"
+)
+
+type Client struct {
+	// Seafile API endpoint. For example: "https://my-seafile-host.com"
+	URL string
+
+	// User authorization token.
+	Token string
+
+	// When set, called for every request instead of using Token,
+	// so the token can be replaced while the client is in use.
+	TokenFunc func() string
+
+	// When set, called once the token was rejected with failed_token,
+	// then the request is retried with the token renewed by it.
+	Relogin func(failed_token string) error
+
+	// http.DefaultClient when nil.
+	HTTPClient *http.Client
+
+	rate_limit rateLimit
+}
+
+func New(seafile_url, token string) *Client {
+	return &Client{URL: strings.TrimRight(seafile_url, "/"), Token: token}
+}
+
+// Token used for requests.
+func (c *Client) CurrentToken() string {
+	if c.TokenFunc != nil {
+		return c.TokenFunc()
+	}
+	return c.Token
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+// Sends request to Seafile and returns response body.
+// Token is added unless request has its own Authorization header.
+// Error responses are returned as *Error along with the body,
+// *RateLimitError is returned when Seafile throttles requests.
+// Rejected token is renewed with Relogin, streamed bodies aren't retried.
+func (c *Client) Do(req *http.Request) ([]byte, error) {
+	if req.Header.Get("Authorization") != "" {
+		return c.do(req, "")
+	}
+
+	token := c.CurrentToken()
+	data, err := c.do(req, token)
+	if c.Relogin == nil || !errors.Is(err, ErrUnauthorized) || req.Body != nil && req.GetBody == nil {
+		return data, err
+	}
+
+	if relogin_err := c.Relogin(token); relogin_err != nil {
+		return data, err
+	}
+
+	retry := req.Clone(req.Context())
+	retry.Header.Del("Authorization")
+	if req.GetBody != nil {
+		if retry.Body, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+
+	return c.do(retry, c.CurrentToken())
+}
+
+// Sends request with token, keeping request's own Authorization when token is empty.
+func (c *Client) do(req *http.Request, token string) ([]byte, error) {
+	if err := c.checkRateLimit(); err != nil {
+		return nil, err
+	}
+
+	if token != "" {
+		req.Header.Set("Authorization", "Token "+token)
+	}
+
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return nil, c.throttled(retryAfter(resp, data))
+	}
+
+	if err := ResponseError(resp.StatusCode, data); err != nil {
+		return data, err
+	}
+
+	return data, nil
+}
+
+// Sends API request, path is relative to URL: "/api2/repos/".
+func (c *Client) Request(method, path string) ([]byte, error) {
+	req, err := http.NewRequest(method, c.URL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.Do(req)
+}
+
+// Same as Request but sends form as urlencoded request body.
+func (c *Client) FormRequest(method, path string, form url.Values) ([]byte, error) {
+	req, err := http.NewRequest(method, c.URL+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Add("Accept", "application/json; charset=utf-8")
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+	return c.Do(req)
+}
+
+// Same as Request but sends v as JSON request body.
+func (c *Client) JSONRequest(method, path string, v interface{}) ([]byte, error) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(method, c.URL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Add("Accept", "application/json; charset=utf-8")
+	req.Header.Add("Content-Type", "application/json")
+
+	return c.Do(req)
+}
+
+// Same as Request but decodes response into v.
+func (c *Client) RequestJSON(method, path string, v interface{}) error {
+	data, err := c.Request(method, path)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
+
+// Returns error_msg from seafile JSON response or empty string.
+func ErrorMessage(data []byte) string {
+	var hash map[string]interface{}
+	if err := json.Unmarshal(data, &hash); err != nil {
+		return ""
+	}
+
+	if msg, ok := hash["error_msg"].(string); ok {
+		return msg
+	}
+
+	return ""
+}
+
+// Server version and optional features.
+type ServerInfo struct {
+	Version                 string   `json:"version"`
+	Features                []string `json:"features"`
+	EncryptedLibraryVersion int      `json:"encrypted_library_version"`
+}
+
+// curl https://cloud.seafile.com/api2/server-info/
+// {"version": "7.0.0", "encrypted_library_version": 2, "features": ["seafile-basic", "seafile-pro", "file-search"]}
+func (c *Client) ServerInfo() (ServerInfo, error) {
+	var info ServerInfo
+
+	data, err := c.Request("GET", "/api2/server-info/")
+	if err != nil {
+		return info, err
+	}
+
+	if err := json.Unmarshal(data, &info); err != nil || info.Version == "" {
+		return info, errors.New("Unknown server info: " + string(data))
+	}
+
+	return info, nil
+}
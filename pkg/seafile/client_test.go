@@ -0,0 +1,91 @@
+package seafile
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// Seafile accepting only the given token.
+func tokenServer(valid *string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Token "+*valid {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"detail": "Invalid token"}`))
+			return
+		}
+		r.ParseForm()
+		w.Write([]byte(`"` + r.FormValue("name") + `"`))
+	}))
+}
+
+func TestDoSendsToken(t *testing.T) {
+	valid := "abc"
+	server := tokenServer(&valid)
+	defer server.Close()
+
+	data, err := New(server.URL, "abc").Request("GET", "/api2/auth/ping/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `""` {
+		t.Errorf("Unexpected response: %s", data)
+	}
+}
+
+func TestDoWithoutReloginFails(t *testing.T) {
+	valid := "new"
+	server := tokenServer(&valid)
+	defer server.Close()
+
+	_, err := New(server.URL, "old").Request("GET", "/api2/auth/ping/")
+	if err == nil {
+		t.Fatal("Rejected token should fail")
+	}
+	if e, ok := err.(*Error); !ok || e.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected 401 error, got %v", err)
+	}
+}
+
+func TestDoKeepsOwnAuthorization(t *testing.T) {
+	valid := "own"
+	server := tokenServer(&valid)
+	defer server.Close()
+
+	client := New(server.URL, "other")
+	req, _ := http.NewRequest("GET", server.URL+"/api2/auth/ping/", nil)
+	req.Header.Set("Authorization", "Token own")
+	if _, err := client.Do(req); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDoReloginRetriesWithBody(t *testing.T) {
+	valid := "new"
+	server := tokenServer(&valid)
+	defer server.Close()
+
+	current := "old"
+	client := &Client{URL: server.URL, TokenFunc: func() string { return current }}
+	relogins := 0
+	client.Relogin = func(failed_token string) error {
+		if failed_token != "old" {
+			t.Errorf("Relogin got %q", failed_token)
+		}
+		relogins++
+		current = "new"
+		return nil
+	}
+
+	data, err := client.FormRequest("POST", "/api2/repos/", url.Values{"name": {"docs"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `"docs"` {
+		t.Errorf("Form body wasn't resent: %s", data)
+	}
+	if relogins != 1 {
+		t.Errorf("Expected 1 relogin, got %d", relogins)
+	}
+}
@@ -0,0 +1,109 @@
+package seafile
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// Kinds of Seafile errors, check them with errors.Is:
+//
+//	if errors.Is(err, seafile.ErrPathNotExist) { ... }
+var (
+	ErrPathNotExist  = errors.New(PATH_DOESNT_EXIST_MSG)
+	ErrFileExists    = errors.New("File already exists")
+	ErrUnauthorized  = errors.New("Invalid token")
+	ErrQuotaExceeded = errors.New("Out of quota")
+
+	// Missing library, endpoint or link, not a missing path.
+	ErrNotFound = errors.New("Not found")
+)
+
+// Error answered by Seafile. Message is error_msg of the response.
+type Error struct {
+	StatusCode int
+	Message    string
+	kind       error
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// One of Err* kinds, nil when the error is of no known kind.
+func (e *Error) Unwrap() error {
+	return e.kind
+}
+
+// Seafile answers errors with various status codes and messages,
+// file server (seafhttp) uses its own codes: 441 file exists, 443 out of quota.
+func errorKind(status int, msg string) error {
+	lower := strings.TrimRight(strings.ToLower(msg), ".")
+
+	switch {
+	case status == http.StatusUnauthorized || lower == "invalid token" || strings.Contains(lower, "credentials were not provided"):
+		return ErrUnauthorized
+	case status == 443 || strings.Contains(lower, "quota"):
+		return ErrQuotaExceeded
+	case status == 441 || status == http.StatusConflict || strings.Contains(lower, "already exist"):
+		return ErrFileExists
+	case isPathNotFoundMessage(lower):
+		return ErrPathNotExist
+	case status == http.StatusNotFound || strings.HasSuffix(lower, "not found"):
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// Seafile says "File not found", "Folder /foo not found" or "Path does not exist"
+// for missing paths and "Library not found" for missing libraries.
+func isPathNotFoundMessage(lower string) bool {
+	if lower == strings.ToLower(PATH_DOESNT_EXIST_MSG) {
+		return true
+	}
+
+	if !strings.HasSuffix(lower, "not found") {
+		return false
+	}
+
+	for _, subject := range []string{"file", "folder", "dir", "path"} {
+		if strings.HasPrefix(lower, subject) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Error of Seafile response, nil for successful one.
+// curl ... https://cloud.seafile.com/api2/repos/dae8cecc-2359-4d33-aa42-01b7846c4b32/file/detail/?p=/missing.c
+// {"error_msg": "File not found"}
+func ResponseError(status int, data []byte) error {
+	msg := ErrorMessage(data)
+	if msg == "" && status < 400 {
+		return nil
+	}
+
+	if msg == "" {
+		var body struct {
+			Detail string `json:"detail"`
+			Error  string `json:"error"`
+		}
+		json.Unmarshal(data, &body)
+
+		switch text := strings.TrimSpace(string(data)); {
+		case body.Detail != "":
+			msg = body.Detail
+		case body.Error != "":
+			msg = body.Error
+		case text != "" && len(text) < 200 && !strings.HasPrefix(text, "<"):
+			msg = text
+		default:
+			msg = http.StatusText(status)
+		}
+	}
+
+	return &Error{StatusCode: status, Message: msg, kind: errorKind(status, msg)}
+}
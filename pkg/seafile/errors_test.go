@@ -0,0 +1,34 @@
+package seafile
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestResponseErrorKinds(t *testing.T) {
+	cases := []struct {
+		status int
+		body   string
+		kind   error
+	}{
+		{404, `{"error_msg": "File not found"}`, ErrPathNotExist},
+		{404, `{"error_msg": "Folder /foo not found."}`, ErrPathNotExist},
+		{400, `{"error_msg": "Path does not exist"}`, ErrPathNotExist},
+		{404, `{"error_msg": "Library not found."}`, ErrNotFound},
+		{404, `<html><body>Page not found</body></html>`, ErrNotFound},
+		{404, ``, ErrNotFound},
+		{401, `{"detail": "Invalid token"}`, ErrUnauthorized},
+		{443, `Out of quota.`, ErrQuotaExceeded},
+		{441, `File already exists`, ErrFileExists},
+	}
+
+	for _, c := range cases {
+		err := ResponseError(c.status, []byte(c.body))
+		if !errors.Is(err, c.kind) {
+			t.Errorf("%d %s: got %v, want kind %v", c.status, c.body, err, c.kind)
+		}
+		if c.kind == ErrNotFound && errors.Is(err, ErrPathNotExist) {
+			t.Errorf("%d %s shouldn't be a missing path", c.status, c.body)
+		}
+	}
+}
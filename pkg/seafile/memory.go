@@ -0,0 +1,354 @@
+package seafile
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// In-memory Storage for tests of code using Storage. Libraries are created
+// with AddRepo, file ids are SHA-1 of the content like Seafile ones look.
+type MemoryStorage struct {
+	mutex sync.Mutex
+	repos map[string]*memoryRepo
+}
+
+type memoryRepo struct {
+	repo Repo
+
+	// Keyed by clean path without trailing slash, "" is the root folder.
+	entries map[string]*memoryEntry
+}
+
+type memoryEntry struct {
+	spec FileSpec
+	data []byte
+}
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{repos: make(map[string]*memoryRepo)}
+}
+
+// Adds empty library.
+func (m *MemoryStorage) AddRepo(repo Repo) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	root := &memoryEntry{spec: FileSpec{Id: contentId([]byte(repo.Id)), Type: "dir", MTime: now()}}
+	m.repos[repo.Id] = &memoryRepo{repo: repo, entries: map[string]*memoryEntry{"": root}}
+}
+
+func now() UnixTime {
+	return UnixTime(time.Now().Unix())
+}
+
+func contentId(data []byte) string {
+	sum := sha1.Sum(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Seafile collapses double slashes, so does the memory storage: /a//b -> /a/b
+func cleanPath(file_path string) string {
+	return strings.TrimRight(path.Clean("/"+file_path), "/")
+}
+
+func parentPath(path string) string {
+	return path[:strings.LastIndex(path, "/")]
+}
+
+func (m *MemoryStorage) repo(repo_id string) (*memoryRepo, error) {
+	repo, ok := m.repos[repo_id]
+	if !ok {
+		return nil, &Error{StatusCode: 404, Message: "Library not found", kind: ErrNotFound}
+	}
+	return repo, nil
+}
+
+func (r *memoryRepo) entry(path string) (*memoryEntry, error) {
+	entry, ok := r.entries[cleanPath(path)]
+	if !ok {
+		return nil, &Error{StatusCode: 404, Message: PATH_DOESNT_EXIST_MSG, kind: ErrPathNotExist}
+	}
+	return entry, nil
+}
+
+func (r *memoryRepo) dir(path string) (*memoryEntry, error) {
+	entry, err := r.entry(path)
+	if err == nil && entry.spec.Type != "dir" {
+		return nil, &Error{StatusCode: 404, Message: PATH_DOESNT_EXIST_MSG, kind: ErrPathNotExist}
+	}
+	return entry, err
+}
+
+func (m *MemoryStorage) ListRepos() ([]Repo, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	repos := []Repo{}
+	for _, repo := range m.repos {
+		repos = append(repos, repo.repo)
+	}
+	sort.Slice(repos, func(i, j int) bool { return repos[i].Name < repos[j].Name })
+
+	return repos, nil
+}
+
+func (m *MemoryStorage) FileDetail(repo_id, path string) (FileSpec, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	repo, err := m.repo(repo_id)
+	if err != nil {
+		return FileSpec{}, err
+	}
+
+	entry, err := repo.entry(path)
+	if err != nil || entry.spec.Type != "file" {
+		return FileSpec{}, &Error{StatusCode: 404, Message: "File not found", kind: ErrPathNotExist}
+	}
+
+	return entry.spec, nil
+}
+
+func (m *MemoryStorage) ListDir(repo_id, path string) ([]FileSpec, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	repo, err := m.repo(repo_id)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := repo.dir(path); err != nil {
+		return nil, err
+	}
+
+	dir := cleanPath(path)
+	specs := []FileSpec{}
+	for entry_path, entry := range repo.entries {
+		if entry_path != "" && parentPath(entry_path) == dir {
+			specs = append(specs, entry.spec)
+		}
+	}
+	sort.Slice(specs, func(i, j int) bool { return specs[i].Name < specs[j].Name })
+
+	return specs, nil
+}
+
+func (m *MemoryStorage) CreateDir(repo_id, path string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	repo, err := m.repo(repo_id)
+	if err != nil {
+		return err
+	}
+
+	current := ""
+	for _, name := range strings.Split(strings.Trim(path, "/"), "/") {
+		if name == "" {
+			continue
+		}
+		current += "/" + name
+
+		if entry, ok := repo.entries[current]; ok {
+			if entry.spec.Type != "dir" {
+				return &Error{StatusCode: 409, Message: "File already exists", kind: ErrFileExists}
+			}
+			continue
+		}
+
+		repo.entries[current] = &memoryEntry{spec: FileSpec{Id: contentId([]byte(current)), Type: "dir", Name: name, MTime: now()}}
+	}
+
+	return nil
+}
+
+// Copies the entry and everything below it to dst path.
+func copyEntries(src *memoryRepo, src_path string, dst *memoryRepo, dst_path string) {
+	copies := make(map[string]*memoryEntry)
+	for path, entry := range src.entries {
+		if path == src_path || strings.HasPrefix(path, src_path+"/") {
+			copied := *entry
+			if path == src_path {
+				copied.spec.Name = dst_path[strings.LastIndex(dst_path, "/")+1:]
+			}
+			copies[dst_path+path[len(src_path):]] = &copied
+		}
+	}
+
+	for path, entry := range copies {
+		dst.entries[path] = entry
+	}
+}
+
+func deleteEntries(repo *memoryRepo, path string) {
+	for entry_path := range repo.entries {
+		if entry_path == path || strings.HasPrefix(entry_path, path+"/") {
+			delete(repo.entries, entry_path)
+		}
+	}
+}
+
+func (m *MemoryStorage) CopyFile(src_repo, src_dir, filename, dst_repo, dst_dir string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	src, err := m.repo(src_repo)
+	if err != nil {
+		return err
+	}
+	dst, err := m.repo(dst_repo)
+	if err != nil {
+		return err
+	}
+
+	src_path := cleanPath(src_dir + "/" + filename)
+	if _, err := src.entry(src_path); err != nil {
+		return err
+	}
+	if _, err := dst.dir(dst_dir); err != nil {
+		return err
+	}
+
+	dst_path := cleanPath(dst_dir + "/" + filename)
+	if dst_path == src_path && dst == src {
+		return nil
+	}
+
+	deleteEntries(dst, dst_path)
+	copyEntries(src, src_path, dst, dst_path)
+
+	return nil
+}
+
+func (m *MemoryStorage) DeleteFile(repo_id, path string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	repo, err := m.repo(repo_id)
+	if err != nil {
+		return err
+	}
+
+	// Seafile answers success for missing files too.
+	if path := cleanPath(path); path != "" {
+		deleteEntries(repo, path)
+	}
+
+	return nil
+}
+
+func (m *MemoryStorage) MoveFile(src_repo, path, dst_repo, dst_dir string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	src, err := m.repo(src_repo)
+	if err != nil {
+		return err
+	}
+	dst, err := m.repo(dst_repo)
+	if err != nil {
+		return err
+	}
+
+	src_path := cleanPath(path)
+	if _, err := src.entry(src_path); err != nil {
+		return err
+	}
+	if _, err := dst.dir(dst_dir); err != nil {
+		return err
+	}
+
+	dst_path := cleanPath(dst_dir + "/" + src_path[strings.LastIndex(src_path, "/")+1:])
+	if dst_path == src_path && dst == src {
+		return nil
+	}
+
+	deleteEntries(dst, dst_path)
+	copyEntries(src, src_path, dst, dst_path)
+	deleteEntries(src, src_path)
+
+	return nil
+}
+
+func (m *MemoryStorage) RenameFile(repo_id, path, new_name string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	repo, err := m.repo(repo_id)
+	if err != nil {
+		return err
+	}
+
+	src_path := cleanPath(path)
+	if _, err := repo.entry(src_path); err != nil || src_path == "" {
+		return &Error{StatusCode: 404, Message: PATH_DOESNT_EXIST_MSG, kind: ErrPathNotExist}
+	}
+
+	dst_path := parentPath(src_path) + "/" + new_name
+	if _, exists := repo.entries[dst_path]; exists {
+		return &Error{StatusCode: 409, Message: "File already exists", kind: ErrFileExists}
+	}
+
+	copyEntries(repo, src_path, repo, dst_path)
+	deleteEntries(repo, src_path)
+
+	return nil
+}
+
+func (m *MemoryStorage) UploadFile(repo_id, folder, filename string, src io.Reader, replace bool) (string, error) {
+	data, err := ioutil.ReadAll(src)
+	if err != nil {
+		return "", err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	repo, err := m.repo(repo_id)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := repo.dir(folder); err != nil {
+		return "", err
+	}
+
+	path := cleanPath(folder + "/" + filename)
+	if existing, ok := repo.entries[path]; ok && (!replace || existing.spec.Type != "file") {
+		return "", &Error{StatusCode: 441, Message: "File already exists", kind: ErrFileExists}
+	}
+
+	id := contentId(data)
+	repo.entries[path] = &memoryEntry{
+		spec: FileSpec{Id: id, Type: "file", Name: filename, Size: int64(len(data)), MTime: now()},
+		data: data,
+	}
+
+	return id, nil
+}
+
+func (m *MemoryStorage) DownloadFile(repo_id, path string) (io.ReadCloser, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	repo, err := m.repo(repo_id)
+	if err != nil {
+		return nil, err
+	}
+
+	entry, err := repo.entry(path)
+	if err != nil || entry.spec.Type != "file" {
+		return nil, &Error{StatusCode: 404, Message: "File not found", kind: ErrPathNotExist}
+	}
+
+	return ioutil.NopCloser(bytes.NewReader(entry.data)), nil
+}
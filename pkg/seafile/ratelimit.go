@@ -0,0 +1,113 @@
+package seafile
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Used when Seafile throttles without saying for how long.
+const DEFAULT_RETRY_AFTER = 10 * time.Second
+
+// Seafile answered 429, or still throttles the client: requests are not sent
+// until RetryAfter passes, so they don't prolong the throttling.
+type RateLimitError struct {
+	Until time.Time
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("Seafile is throttling requests, retry in %v", e.RetryAfter())
+}
+
+func (e *RateLimitError) RetryAfter() time.Duration {
+	retry_after := time.Until(e.Until).Round(time.Second)
+	if retry_after < time.Second {
+		retry_after = time.Second
+	}
+	return retry_after
+}
+
+// Counters of throttled requests.
+type RateLimitStats struct {
+	Throttled      int64     `json:"throttled"`
+	Refused        int64     `json:"refused"`
+	ThrottledUntil time.Time `json:"throttled_until,omitempty"`
+}
+
+type rateLimit struct {
+	mutex sync.Mutex
+	stats RateLimitStats
+}
+
+// Django REST framework: {"detail": "Request was throttled. Expected available in 30 seconds."}
+var throttle_detail_re = regexp.MustCompile(`available in (\d+) seconds?`)
+
+// How long to wait after 429 response, from Retry-After header or the message.
+func retryAfter(resp *http.Response, data []byte) time.Duration {
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if when, err := http.ParseTime(resp.Header.Get("Retry-After")); err == nil && time.Until(when) > 0 {
+		return time.Until(when)
+	}
+
+	var body struct {
+		Detail string `json:"detail"`
+	}
+	if json.Unmarshal(data, &body) == nil {
+		if match := throttle_detail_re.FindStringSubmatch(body.Detail); match != nil {
+			seconds, _ := strconv.Atoi(match[1])
+			return time.Duration(seconds) * time.Second
+		}
+	}
+
+	return DEFAULT_RETRY_AFTER
+}
+
+// Returns error while throttled, counting refused request.
+func (c *Client) checkRateLimit() error {
+	c.rate_limit.mutex.Lock()
+	defer c.rate_limit.mutex.Unlock()
+
+	if time.Now().Before(c.rate_limit.stats.ThrottledUntil) {
+		c.rate_limit.stats.Refused++
+		return &RateLimitError{Until: c.rate_limit.stats.ThrottledUntil}
+	}
+
+	return nil
+}
+
+func (c *Client) throttled(retry_after time.Duration) error {
+	c.rate_limit.mutex.Lock()
+	defer c.rate_limit.mutex.Unlock()
+
+	c.rate_limit.stats.Throttled++
+	if until := time.Now().Add(retry_after); until.After(c.rate_limit.stats.ThrottledUntil) {
+		c.rate_limit.stats.ThrottledUntil = until
+	}
+
+	return &RateLimitError{Until: c.rate_limit.stats.ThrottledUntil}
+}
+
+// Time until which requests are refused, zero when Seafile doesn't throttle.
+func (c *Client) ThrottledUntil() time.Time {
+	c.rate_limit.mutex.Lock()
+	defer c.rate_limit.mutex.Unlock()
+
+	if time.Now().Before(c.rate_limit.stats.ThrottledUntil) {
+		return c.rate_limit.stats.ThrottledUntil
+	}
+	return time.Time{}
+}
+
+func (c *Client) RateLimitStats() RateLimitStats {
+	c.rate_limit.mutex.Lock()
+	defer c.rate_limit.mutex.Unlock()
+
+	return c.rate_limit.stats
+}
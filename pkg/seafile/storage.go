@@ -0,0 +1,57 @@
+package seafile
+
+import (
+	"io"
+	"net/http"
+)
+
+// Storage backend of the proxy. Client stores files in Seafile,
+// MemoryStorage keeps them in memory for tests.
+// Paths are paths inside the library, folders end with a slash or not.
+type Storage interface {
+	ListRepos() ([]Repo, error)
+	FileDetail(repo_id, path string) (FileSpec, error)
+	ListDir(repo_id, path string) ([]FileSpec, error)
+	CreateDir(repo_id, path string) error
+	CopyFile(src_repo, src_dir, filename, dst_repo, dst_dir string) error
+	DeleteFile(repo_id, path string) error
+	MoveFile(src_repo, path, dst_repo, dst_dir string) error
+	RenameFile(repo_id, path, new_name string) error
+
+	// Stores src as filename in folder and returns id of the stored file.
+	UploadFile(repo_id, folder, filename string, src io.Reader, replace bool) (string, error)
+
+	// Opens the file for reading. Caller closes it.
+	DownloadFile(repo_id, path string) (io.ReadCloser, error)
+}
+
+var _ Storage = (*Client)(nil)
+var _ Storage = (*MemoryStorage)(nil)
+
+func (c *Client) UploadFile(repo_id, folder, filename string, src io.Reader, replace bool) (string, error) {
+	link, err := c.UploadLink(repo_id, "")
+	if err != nil {
+		return "", err
+	}
+
+	return c.Upload(link, src, folder, filename, replace)
+}
+
+func (c *Client) DownloadFile(repo_id, path string) (io.ReadCloser, error) {
+	link, err := c.DownloadLink(repo_id, path, false)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient().Get(link)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, &Error{StatusCode: resp.StatusCode, Message: resp.Status, kind: errorKind(resp.StatusCode, "")}
+	}
+
+	return resp.Body, nil
+}
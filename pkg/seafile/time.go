@@ -0,0 +1,53 @@
+package seafile
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// When true, UnixTime is written to JSON as Unix timestamp like Seafile does,
+// otherwise as RFC3339.
+var JSONUnixTimes bool
+
+// Unix timestamp as Seafile returns it, written to JSON as RFC3339.
+// Both forms are accepted when reading, so stored manifests and cached
+// responses written either way keep working.
+type UnixTime int64
+
+func (t UnixTime) Time() time.Time {
+	return time.Unix(int64(t), 0)
+}
+
+func (t UnixTime) MarshalJSON() ([]byte, error) {
+	if JSONUnixTimes {
+		return []byte(strconv.FormatInt(int64(t), 10)), nil
+	}
+
+	return json.Marshal(t.Time().UTC().Format(time.RFC3339))
+}
+
+func (t *UnixTime) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+
+	switch value := value.(type) {
+	case float64:
+		*t = UnixTime(value)
+	case string:
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return err
+		}
+		*t = UnixTime(parsed.Unix())
+	case nil:
+		*t = 0
+	default:
+		return fmt.Errorf("Invalid mtime: %s", data)
+	}
+
+	return nil
+}
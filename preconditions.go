@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"github.com/lazureykis/seafile-uploader/pkg/seafile"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Upload preconditions for concurrent writers:
+//
+//	If-None-Match: *   (or If-None-Exists: true) - store only when the file doesn't exist yet
+//	If-Match: <id>     - overwrite only when current Seafile file id matches
+//
+// Preconditions are checked for every file of the request before it is stored.
+func checkUploadPreconditions(r *http.Request, existing map[string]FileSpec, filename string) error {
+	spec, exists := existing[filename]
+
+	none_exists, _ := strconv.ParseBool(r.Header.Get("If-None-Exists"))
+	if r.Header.Get("If-None-Match") == "*" || none_exists {
+		if exists {
+			return seafile.ErrFileExists
+		}
+	}
+
+	if if_match := r.Header.Get("If-Match"); if_match != "" {
+		if !exists {
+			return errors.New("File does not exist")
+		}
+
+		if if_match != "*" && !etagListContains(if_match, spec.Id) {
+			return errors.New("File id doesn't match")
+		}
+	}
+
+	return nil
+}
+
+// Checks comma separated list of (optionally quoted) ids.
+func etagListContains(list, id string) bool {
+	for _, tag := range strings.Split(list, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if strings.Trim(tag, `"`) == id {
+			return true
+		}
+	}
+
+	return false
+}
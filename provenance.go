@@ -0,0 +1,148 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Who produced the uploaded file: system, its job and commit of the code it ran.
+// Given as provenance_system, provenance_job_id and provenance_commit form fields
+// or X-Provenance-System, X-Provenance-Job-Id and X-Provenance-Commit headers.
+// It is stored in the sidecar and the metadata index, sent with callbacks and
+// audited, so any stored artifact can be traced back to the pipeline run.
+type Provenance struct {
+	System string `json:"system,omitempty"`
+	JobId  string `json:"job_id,omitempty"`
+	Commit string `json:"commit,omitempty"`
+}
+
+const MAX_PROVENANCE_LENGTH = 256
+
+// Index metadata key which holds provenance of the file.
+const PROVENANCE_KEY = "provenance"
+
+func provenanceFromRequest(r *http.Request, form map[string][]string) (Provenance, error) {
+	value := func(field, header string) string {
+		return strings.TrimSpace(fetchValue(form[field], r.Header.Get(header)))
+	}
+
+	provenance := Provenance{
+		System: value("provenance_system", "X-Provenance-System"),
+		JobId:  value("provenance_job_id", "X-Provenance-Job-Id"),
+		Commit: value("provenance_commit", "X-Provenance-Commit"),
+	}
+
+	for _, value := range []string{provenance.System, provenance.JobId, provenance.Commit} {
+		if len(value) > MAX_PROVENANCE_LENGTH {
+			return provenance, errors.New("Provenance values are limited to 256 bytes")
+		}
+	}
+
+	return provenance, nil
+}
+
+func (p Provenance) IsZero() bool {
+	return p == Provenance{}
+}
+
+// Non-empty fields: system, job_id, commit.
+func (p Provenance) Fields() map[string]string {
+	fields := make(map[string]string)
+	for key, value := range map[string]string{"system": p.System, "job_id": p.JobId, "commit": p.Commit} {
+		if value != "" {
+			fields[key] = value
+		}
+	}
+	return fields
+}
+
+// Callback parameters: provenance_system, provenance_job_id, provenance_commit.
+func (p Provenance) Values() url.Values {
+	values := url.Values{}
+	for key, value := range p.Fields() {
+		values.Set("provenance_"+key, value)
+	}
+	return values
+}
+
+// Metadata of the file for the index, with provenance under PROVENANCE_KEY.
+func withProvenance(metadata map[string]interface{}, p Provenance) map[string]interface{} {
+	if p.IsZero() {
+		return metadata
+	}
+
+	indexed := copyMetadata(metadata)
+	fields := make(map[string]interface{})
+	for key, value := range p.Fields() {
+		fields[key] = value
+	}
+	indexed[PROVENANCE_KEY] = fields
+	return indexed
+}
+
+// Whether indexed metadata has provenance with all filter values.
+// Commit matches by prefix, so abbreviated hashes work.
+func provenanceMatches(metadata map[string]interface{}, filters map[string]string) bool {
+	fields, ok := metadata[PROVENANCE_KEY].(map[string]interface{})
+	if !ok {
+		return false
+	}
+
+	for key, expected := range filters {
+		value, _ := fields[key].(string)
+		if key == "commit" && !strings.HasPrefix(value, expected) || key != "commit" && value != expected {
+			return false
+		}
+	}
+
+	return true
+}
+
+// GET /api/v1/provenance?system=ci&job_id=1234&commit=3f2a9c lists files
+// produced by the pipeline run. At least one filter is required.
+func apiProvenanceHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println(r.Method, r.RequestURI)
+
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !downloadAuthorized(r, "/") {
+		writeAPIError(w, http.StatusForbidden, "Forbidden")
+		return
+	}
+
+	filters := make(map[string]string)
+	for _, key := range []string{"system", "job_id", "commit"} {
+		if value := strings.TrimSpace(r.FormValue(key)); value != "" {
+			filters[key] = value
+		}
+	}
+	if len(filters) == 0 {
+		writeAPIError(w, http.StatusBadRequest, "system, job_id or commit is required")
+		return
+	}
+
+	type provenanceResult struct {
+		Path       string      `json:"path"`
+		Provenance interface{} `json:"provenance"`
+	}
+
+	results := []provenanceResult{}
+	for path, metadata := range metadata_index.Find(func(path string, metadata map[string]interface{}) bool {
+		return provenanceMatches(metadata, filters)
+	}) {
+		results = append(results, provenanceResult{Path: path, Provenance: metadata[PROVENANCE_KEY]})
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Path < results[j].Path
+	})
+
+	writeAPI(w, http.StatusOK, map[string]interface{}{"results": results})
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Rejected uploads are kept in SEAFILE_QUARANTINE_DIR, encrypted with a key derived
+// from SEAFILE_QUARANTINE_KEY, until an admin releases them to their folders or purges them.
+// Every quarantined file is "<id>.bin" (nonce + AES-GCM sealed content) and "<id>.json".
+type QuarantineEntry struct {
+	Id          string   `json:"id"`
+	Filename    string   `json:"filename"`
+	Folders     []string `json:"folders"`
+	Reason      string   `json:"reason"`
+	IP          string   `json:"ip,omitempty"`
+	APIKey      string   `json:"api_key,omitempty"`
+	Size        int64    `json:"size"`
+	SHA256      string   `json:"sha256"`
+	Quarantined string   `json:"quarantined"`
+}
+
+var (
+	quarantine_dir string
+	quarantine_key string
+)
+
+func quarantineCipher() (cipher.AEAD, error) {
+	key := sha256.Sum256([]byte(quarantine_key))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Quarantine ids are UUIDs shaped like repo ids, anything else is refused before touching the disk.
+func isQuarantineId(id string) bool {
+	return isRepoId(id)
+}
+
+// Stores rejected upload in the quarantine.
+func QuarantineUpload(r *http.Request, api_key, filename string, folders []string, f *multipart.FileHeader, reason string) error {
+	file, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		return err
+	}
+
+	aead, err := quarantineCipher()
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256(data)
+	entry := QuarantineEntry{
+		Id:          newUUID(),
+		Filename:    filename,
+		Folders:     folders,
+		Reason:      reason,
+		IP:          sourceIP(r),
+		APIKey:      api_key,
+		Size:        int64(len(data)),
+		SHA256:      hex.EncodeToString(sum[:]),
+		Quarantined: time.Now().UTC().Format(time.RFC3339),
+	}
+
+	sealed := aead.Seal(nonce, nonce, data, []byte(entry.Id))
+	if err := ioutil.WriteFile(filepath.Join(quarantine_dir, entry.Id+".bin"), sealed, 0600); err != nil {
+		return err
+	}
+
+	info, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(quarantine_dir, entry.Id+".json"), info, 0600); err != nil {
+		os.Remove(filepath.Join(quarantine_dir, entry.Id+".bin"))
+		return err
+	}
+
+	Audit(AuditEvent{Event: "quarantined", IP: entry.IP, APIKey: api_key, Path: filename,
+		Details: map[string]string{"id": entry.Id, "reason": reason}})
+
+	return nil
+}
+
+func quarantineEntries() ([]QuarantineEntry, error) {
+	infos, err := ioutil.ReadDir(quarantine_dir)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []QuarantineEntry{}
+	for _, info := range infos {
+		if !strings.HasSuffix(info.Name(), ".json") {
+			continue
+		}
+
+		entry, err := quarantineEntry(strings.TrimSuffix(info.Name(), ".json"))
+		if err != nil {
+			log.Println("Quarantine:", err)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Quarantined < entries[j].Quarantined })
+	return entries, nil
+}
+
+func quarantineEntry(id string) (QuarantineEntry, error) {
+	var entry QuarantineEntry
+
+	data, err := ioutil.ReadFile(filepath.Join(quarantine_dir, id+".json"))
+	if err != nil {
+		return entry, err
+	}
+
+	err = json.Unmarshal(data, &entry)
+	return entry, err
+}
+
+// Decrypted content of quarantined file.
+func quarantineContent(id string) ([]byte, error) {
+	sealed, err := ioutil.ReadFile(filepath.Join(quarantine_dir, id+".bin"))
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := quarantineCipher()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("Quarantined file is truncated: " + id)
+	}
+
+	return aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(id))
+}
+
+func purgeQuarantined(id string) error {
+	if err := os.Remove(filepath.Join(quarantine_dir, id+".bin")); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return os.Remove(filepath.Join(quarantine_dir, id+".json"))
+}
+
+// GET /admin/quarantine lists quarantined files (viewer).
+// GET /admin/quarantine?id=... downloads decrypted content for inspection (operator).
+// DELETE /admin/quarantine?id=... purges the file (operator).
+// POST /admin/quarantine?id=... releases the file to its folders, or to folder=/other/ (admin).
+func adminQuarantineHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println(r.Method, r.RequestURI)
+
+	if quarantine_dir == "" {
+		http.Error(w, "SEAFILE_QUARANTINE_DIR is not configured", http.StatusNotImplemented)
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+
+	role := ROLE_ADMIN
+	switch {
+	case r.Method == "GET" && id == "":
+		role = ROLE_VIEWER
+	case r.Method == "GET", r.Method == "DELETE":
+		role = ROLE_OPERATOR
+	case r.Method == "POST":
+		role = ROLE_ADMIN
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !adminAuthorized(r, role) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	if id == "" {
+		entries, err := quarantineEntries()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, entries)
+		return
+	}
+
+	if !isQuarantineId(id) {
+		http.Error(w, "Invalid id: "+id, http.StatusBadRequest)
+		return
+	}
+
+	entry, err := quarantineEntry(id)
+	if os.IsNotExist(err) {
+		http.Error(w, "Not in quarantine: "+id, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		data, err := quarantineContent(id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		Audit(AuditEvent{Event: "quarantine_inspected", IP: sourceIP(r), Path: entry.Filename, Details: map[string]string{"id": id}})
+
+		// Never rendered by the browser, whatever it is.
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Disposition", contentDisposition("attachment", entry.Filename))
+		w.Write(data)
+
+	case "DELETE":
+		if err := purgeQuarantined(id); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		Audit(AuditEvent{Event: "quarantine_purged", IP: sourceIP(r), Path: entry.Filename, Details: map[string]string{"id": id}})
+		w.WriteHeader(http.StatusNoContent)
+
+	case "POST":
+		folders := entry.Folders
+		if folder := r.FormValue("folder"); folder != "" {
+			if !strings.HasPrefix(folder, "/") || !strings.HasSuffix(folder, "/") {
+				http.Error(w, "folder should start and end with /", http.StatusBadRequest)
+				return
+			}
+			folders = []string{folder}
+		}
+
+		data, err := quarantineContent(id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		var released []string
+		for _, folder := range folders {
+			err, _, exists := IsDirectoryExist(folder)
+			if err == nil && !exists {
+				err = CreateDirectory(folder)
+			}
+			if err == nil {
+				_, err = UploadFile(bytes.NewReader(data), folder, entry.Filename, false)
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			released = append(released, folder+entry.Filename)
+		}
+
+		if err := purgeQuarantined(id); err != nil {
+			log.Println("Quarantine:", err)
+		}
+
+		Audit(AuditEvent{Event: "quarantine_released", IP: sourceIP(r), Path: entry.Filename,
+			Details: map[string]string{"id": id, "folders": strings.Join(folders, ",")}})
+		writeJSON(w, http.StatusOK, map[string][]string{"released": released})
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"github.com/lazureykis/seafile-uploader/pkg/seafile"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// While Seafile throttles the proxy, requests which failed because of it are
+// answered with 429 and Retry-After instead of 5xx, so well-behaved clients
+// wait rather than retry right away and make the throttling worse.
+func seafileErrorStatus(w http.ResponseWriter, status int) int {
+	if status < 500 || seafile_client == nil {
+		return status
+	}
+
+	until := seafileThrottledUntil()
+	if until.IsZero() {
+		return status
+	}
+
+	w.Header().Set("Retry-After", strconv.Itoa(int(time.Until(until).Seconds())+1))
+	return http.StatusTooManyRequests
+}
+
+// Latest throttling of the proxy account and the users, zero when none is throttled.
+func seafileThrottledUntil() time.Time {
+	until := seafile_client.ThrottledUntil()
+	for _, account := range user_accounts {
+		if user_until := account.client.ThrottledUntil(); user_until.After(until) {
+			until = user_until
+		}
+	}
+	return until
+}
+
+type rateLimitStatusWriter struct {
+	http.ResponseWriter
+}
+
+func (s *rateLimitStatusWriter) WriteHeader(status int) {
+	s.ResponseWriter.WriteHeader(seafileErrorStatus(s.ResponseWriter, status))
+}
+
+func (s *rateLimitStatusWriter) Flush() {
+	if f, ok := s.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func withSeafileRateLimit(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.ServeHTTP(&rateLimitStatusWriter{ResponseWriter: w}, r)
+	})
+}
+
+// GET /admin/seafile/ratelimit shows how often Seafile throttled the proxy,
+// and every user of SEAFILE_USERS_FILE under users.
+func adminRateLimitHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println(r.Method, r.RequestURI)
+
+	if !adminAuthorized(r, ROLE_VIEWER) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	users := make(map[string]seafile.RateLimitStats)
+	for name, account := range user_accounts {
+		users[name] = account.client.RateLimitStats()
+	}
+
+	writeJSON(w, http.StatusOK, struct {
+		seafile.RateLimitStats
+		Users map[string]seafile.RateLimitStats `json:"users,omitempty"`
+	}{seafile_client.RateLimitStats(), users})
+}
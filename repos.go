@@ -0,0 +1,228 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/lazureykis/seafile-uploader/pkg/seafile"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Folder prefix mounted to the root of another library.
+type RepoRoute struct {
+	Prefix string
+	RepoId string
+}
+
+var (
+	// Routes sorted by prefix length, longest first.
+	repo_routes []RepoRoute
+
+	// Upload links cached per library.
+	upload_links       = make(map[string]string)
+	upload_links_mutex sync.Mutex
+)
+
+// Parses SEAFILE_REPO_ROUTES value: "/photos/=repo-id,/docs/=repo-id".
+func ParseRepoRoutes(spec string) ([]RepoRoute, error) {
+	var routes []RepoRoute
+
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 {
+			return nil, errors.New("Invalid repo route, expected /prefix/=repo-id: " + entry)
+		}
+
+		prefix := "/" + strings.Trim(strings.TrimSpace(parts[0]), "/") + "/"
+		repo_id := strings.TrimSpace(parts[1])
+
+		if prefix == "//" {
+			return nil, errors.New("Empty repo route prefix: " + entry)
+		}
+
+		if len(repo_id) != REPO_ID_SIZE {
+			return nil, errors.New("Invalid repo id in route: " + entry)
+		}
+
+		routes = append(routes, RepoRoute{Prefix: prefix, RepoId: repo_id})
+	}
+
+	sort.SliceStable(routes, func(i, j int) bool {
+		return len(routes[i].Prefix) > len(routes[j].Prefix)
+	})
+
+	return routes, nil
+}
+
+// Whether s looks like a library id: 99b758e6-91ab-4265-b705-925367374cf0.
+func isRepoId(s string) bool {
+	if len(s) != REPO_ID_SIZE {
+		return false
+	}
+
+	for i, c := range s {
+		switch i {
+		case 8, 13, 18, 23:
+			if c != '-' {
+				return false
+			}
+		default:
+			if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// Selects library by path prefix.
+// Routes work as library aliases: with "/photos/=repo-id" route /get/photos/a.jpg
+// is a.jpg in that library. Raw library ids are routed by RouteReadRepo only.
+// Returns library id and path inside of it. Unrouted paths belong to the default library.
+func RouteRepo(path string) (repo_id, repo_path string) {
+	// Libraries of multi-user mode, see users.go.
+	if account := userOfPath(path); account != nil {
+		if path+"/" == account.Prefix() {
+			return account.Repo, "/"
+		}
+		return account.Repo, "/" + strings.TrimPrefix(path, account.Prefix())
+	}
+
+	for _, route := range repo_routes {
+		if strings.HasPrefix(path, route.Prefix) {
+			return route.RepoId, "/" + strings.TrimPrefix(path, route.Prefix)
+		}
+
+		if path+"/" == route.Prefix {
+			return route.RepoId, "/"
+		}
+	}
+
+	return default_repo, path
+}
+
+// Library id of the path when it starts with one and SEAFILE_REPO_ID_PATHS is on:
+// /99b758e6-91ab-4265-b705-925367374cf0/a.jpg. Libraries of users aren't reachable so.
+func repoIdOfPath(path string) (repo_id, repo_path string, ok bool) {
+	if !repo_id_paths {
+		return "", "", false
+	}
+
+	segments := strings.SplitN(strings.TrimPrefix(path, "/"), "/", 2)
+	if !isRepoId(segments[0]) {
+		return "", "", false
+	}
+	if _, ok := user_repos[segments[0]]; ok {
+		return "", "", false
+	}
+
+	if len(segments) == 1 {
+		return segments[0], "/", true
+	}
+	return segments[0], "/" + segments[1], true
+}
+
+// Same as RouteRepo but the first path segment may also be raw library id:
+// /get/99b758e6-91ab-4265-b705-925367374cf0/a.jpg. Raw ids reach any library of
+// the token, so they are routed for reading only, writes go to RouteRepo.
+func RouteReadRepo(path string) (repo_id, repo_path string) {
+	if repo_id, repo_path, ok := repoIdOfPath(path); ok {
+		return repo_id, repo_path
+	}
+
+	return RouteRepo(path)
+}
+
+type Repo = seafile.Repo
+
+func ListRepos() ([]Repo, error) {
+	return storage.ListRepos()
+}
+
+// Creates library, encrypted when password is given.
+func CreateRepo(name, desc, password string) (Repo, error) {
+	log.Println("Creating library", name)
+
+	repo_id, err := seafile_client.CreateRepo(name, desc, password)
+	if err != nil {
+		return Repo{}, fmt.Errorf("Cannot create library %s > %w", name, err)
+	}
+
+	return Repo{Id: repo_id, Name: name, Permission: "rw", Encrypted: password != ""}, nil
+}
+
+// Gets (cached) link where to upload files into the library.
+func UploadLinkFor(repo_id string) (string, error) {
+	upload_links_mutex.Lock()
+	link, ok := upload_links[repo_id]
+	upload_links_mutex.Unlock()
+
+	if ok {
+		return link, nil
+	}
+
+	link, err := clientFor(repo_id).UploadLink(repo_id, "")
+	if err != nil {
+		return "", err
+	}
+
+	upload_links_mutex.Lock()
+	upload_links[repo_id] = link
+	upload_links_mutex.Unlock()
+
+	return link, nil
+}
+
+// Drops cached upload link of the library, when Seafile doesn't accept it anymore.
+func forgetUploadLink(repo_id string) {
+	upload_links_mutex.Lock()
+	delete(upload_links, repo_id)
+	upload_links_mutex.Unlock()
+}
+
+// Reverse of RouteRepo: proxy path of the path inside the library.
+// Returns false when the file isn't reachable through the proxy.
+func ProxyPath(repo_id, repo_path string) (string, bool) {
+	var candidates []string
+	if account, ok := user_repos[repo_id]; ok {
+		candidates = append(candidates, account.Prefix()+strings.TrimPrefix(repo_path, "/"))
+	}
+	for _, route := range repo_routes {
+		if route.RepoId == repo_id {
+			candidates = append(candidates, route.Prefix+strings.TrimPrefix(repo_path, "/"))
+		}
+	}
+	if repo_id == default_repo {
+		candidates = append(candidates, repo_path)
+	}
+	if repo_id_paths {
+		candidates = append(candidates, "/"+repo_id+repo_path)
+	}
+
+	for _, path := range candidates {
+		if routed_id, routed_path := RouteReadRepo(path); routed_id == repo_id && routed_path == repo_path {
+			return path, true
+		}
+	}
+
+	return "", false
+}
+
+// Default library and all routed ones.
+func ConfiguredRepos() []string {
+	repos := []string{default_repo}
+	for _, route := range repo_routes {
+		if !stringInSlice(route.RepoId, repos) {
+			repos = append(repos, route.RepoId)
+		}
+	}
+	return repos
+}
@@ -0,0 +1,26 @@
+package main
+
+import "testing"
+
+func TestRouteRepoIdPaths(t *testing.T) {
+	saved_default, saved_paths := default_repo, repo_id_paths
+	defer func() { default_repo, repo_id_paths = saved_default, saved_paths }()
+
+	default_repo = "99b758e6-91ab-4265-b705-925367374cf0"
+	other := "dae8cecc-2359-4d33-aa42-01b7846c4b32"
+	repo_id_paths = true
+
+	if repo_id, repo_path := RouteReadRepo("/" + other + "/a.jpg"); repo_id != other || repo_path != "/a.jpg" {
+		t.Errorf("Read route: %s %s", repo_id, repo_path)
+	}
+
+	// Writes never leave the configured libraries.
+	if repo_id, repo_path := RouteRepo("/" + other + "/a.jpg"); repo_id != default_repo || repo_path != "/"+other+"/a.jpg" {
+		t.Errorf("Write route: %s %s", repo_id, repo_path)
+	}
+
+	repo_id_paths = false
+	if repo_id, _ := RouteReadRepo("/" + other + "/a.jpg"); repo_id != default_repo {
+		t.Errorf("Library id path is routed with SEAFILE_REPO_ID_PATHS off: %s", repo_id)
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Platform artifacts are stored as name-os-arch with optional extension:
+// tool-linux-amd64, tool-darwin-arm64.tar.gz, tool-windows-amd64.exe.
+// GET /resolve/releases/tool?os=linux&arch=arm64 redirects to the matching file,
+// os and arch default to hints found in User-Agent.
+
+// Known spellings of operating systems and architectures.
+var (
+	platform_os_aliases = map[string]string{
+		"linux":     "linux",
+		"darwin":    "darwin",
+		"macos":     "darwin",
+		"mac os x":  "darwin",
+		"macintosh": "darwin",
+		"osx":       "darwin",
+		"windows":   "windows",
+		"win32":     "windows",
+		"win64":     "windows",
+		"freebsd":   "freebsd",
+	}
+
+	platform_arch_aliases = map[string]string{
+		"amd64":   "amd64",
+		"x86_64":  "amd64",
+		"x86-64":  "amd64",
+		"x64":     "amd64",
+		"win64":   "amd64",
+		"arm64":   "arm64",
+		"aarch64": "arm64",
+		"armv7":   "arm",
+		"armv7l":  "arm",
+		"arm":     "arm",
+		"386":     "386",
+		"i386":    "386",
+		"i686":    "386",
+		"x86":     "386",
+	}
+)
+
+// Normalized name for the spelling, or the spelling itself when it's unknown.
+func normalizePlatform(value string, aliases map[string]string) string {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if normalized, ok := aliases[value]; ok {
+		return normalized
+	}
+	return value
+}
+
+// Finds the longest known spelling in User-Agent: "curl/7.68.0 (x86_64-pc-linux-gnu)".
+func platformFromUserAgent(user_agent string, aliases map[string]string) string {
+	user_agent = strings.ToLower(user_agent)
+
+	var spellings []string
+	for spelling := range aliases {
+		spellings = append(spellings, spelling)
+	}
+	sort.Slice(spellings, func(i, j int) bool {
+		return len(spellings[i]) > len(spellings[j])
+	})
+
+	for _, spelling := range spellings {
+		if strings.Contains(user_agent, spelling) {
+			return aliases[spelling]
+		}
+	}
+
+	return ""
+}
+
+// Artifact of the folder built for the platform, empty when there is none.
+func resolveArtifact(files []FileSpec, name, os, arch string) string {
+	platform := name + "-" + os + "-" + arch
+
+	for _, file := range files {
+		if file.Name == platform || strings.HasPrefix(file.Name, platform+".") {
+			return file.Name
+		}
+	}
+
+	return ""
+}
+
+type ResolvedArtifact struct {
+	File      string   `json:"file,omitempty"`
+	Path      string   `json:"path,omitempty"`
+	URL       string   `json:"url,omitempty"`
+	OS        string   `json:"os"`
+	Arch      string   `json:"arch"`
+	Available []string `json:"available,omitempty"`
+	Error     string   `json:"error,omitempty"`
+}
+
+// GET /resolve/folder/name picks name-os-arch file in the folder.
+// Answers with redirect to /get/, or with JSON when it is accepted.
+func resolveHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println(r.Method, r.RequestURI)
+
+	if r.Method != "GET" && r.Method != "HEAD" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	artifact := strings.TrimPrefix(r.URL.Path, "/resolve")
+	folder, name := path.Dir(artifact), path.Base(artifact)
+	folder = strings.TrimSuffix(folder, "/") + "/"
+
+	if name == "" || name == "/" || name == "." {
+		http.Error(w, "Missing artifact name", http.StatusBadRequest)
+		return
+	}
+
+	if !downloadAuthorized(r, folder) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	query := r.URL.Query()
+	result := ResolvedArtifact{
+		OS:   normalizePlatform(query.Get("os"), platform_os_aliases),
+		Arch: normalizePlatform(query.Get("arch"), platform_arch_aliases),
+	}
+	if result.OS == "" {
+		result.OS = platformFromUserAgent(r.UserAgent(), platform_os_aliases)
+	}
+	if result.Arch == "" {
+		result.Arch = platformFromUserAgent(r.UserAgent(), platform_arch_aliases)
+	}
+
+	err, files, exists := IsDirectoryExist(folder)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.Error(w, PATH_DOESNT_EXIST_MSG, http.StatusNotFound)
+		return
+	}
+
+	result.File = resolveArtifact(files, name, result.OS, result.Arch)
+	if result.File == "" {
+		for _, file := range files {
+			if strings.HasPrefix(file.Name, name+"-") {
+				result.Available = append(result.Available, file.Name)
+			}
+		}
+
+		result.Error = "No " + name + " build for os=" + result.OS + " arch=" + result.Arch
+		if wantsJSON(r) {
+			writeJSON(w, http.StatusNotFound, result)
+		} else {
+			http.Error(w, result.Error, http.StatusNotFound)
+		}
+		return
+	}
+
+	result.Path = folder + result.File
+
+	// Caller is already authorized, so private downloads get a signed link
+	// and don't need the credentials again.
+	if private_downloads && signing_key != "" {
+		result.URL = signedDownloadPath(result.Path, time.Now().Add(callback_link_ttl).Unix())
+	} else {
+		get_url := &url.URL{Path: "/get" + result.Path}
+		result.URL = get_url.EscapedPath()
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, result)
+		return
+	}
+
+	http.Redirect(w, r, result.URL, http.StatusFound)
+}
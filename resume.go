@@ -0,0 +1,161 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DOWNLOAD_RESUME_ATTEMPTS = 3
+	DOWNLOAD_RESUME_DELAY    = time.Second
+)
+
+// Upstream body which re-requests the remaining bytes with Range header
+// when connection to the file server drops in the middle of the file.
+type resumingReader struct {
+	body     io.ReadCloser
+	path     string
+	file_id  string
+	offset   int64 // position of the next byte in the file
+	end      int64 // last byte to read, -1 when unknown
+	attempts int
+	server   *FileServer // file server the transfer sticks to, nil without SEAFILE_FILE_SERVERS
+}
+
+// Parses "bytes 100-199/1000" into first and last byte positions.
+func parseContentRange(content_range string) (int64, int64, bool) {
+	spec := strings.TrimPrefix(content_range, "bytes ")
+	spec = strings.SplitN(spec, "/", 2)[0]
+
+	parts := strings.SplitN(spec, "-", 2)
+	if len(parts) != 2 {
+		return 0, 0, false
+	}
+
+	start, err1 := strconv.ParseInt(parts[0], 10, 64)
+	end, err2 := strconv.ParseInt(parts[1], 10, 64)
+	if err1 != nil || err2 != nil || end < start {
+		return 0, 0, false
+	}
+
+	return start, end, true
+}
+
+// Wraps body of 200 or 206 response of the file version.
+// Encoded bodies can't be resumed by byte ranges and are returned as is.
+func newResumingReader(resp *http.Response, path, file_id string, server *FileServer) io.ReadCloser {
+	if resp.Header.Get("Content-Encoding") != "" {
+		return resp.Body
+	}
+
+	reader := &resumingReader{body: resp.Body, path: path, file_id: file_id, end: -1, server: server}
+
+	if resp.StatusCode == http.StatusPartialContent {
+		start, end, ok := parseContentRange(resp.Header.Get("Content-Range"))
+		if !ok {
+			return resp.Body
+		}
+		reader.offset, reader.end = start, end
+	} else if resp.ContentLength > 0 {
+		reader.end = resp.ContentLength - 1
+	}
+
+	return reader
+}
+
+func (r *resumingReader) Read(p []byte) (int, error) {
+	n, err := r.body.Read(p)
+	r.offset += int64(n)
+
+	if err == nil || err == io.EOF && (r.end < 0 || r.offset > r.end) {
+		return n, err
+	}
+
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+
+	if r.attempts >= DOWNLOAD_RESUME_ATTEMPTS {
+		return n, err
+	}
+
+	log.Println("Download of", r.path, "interrupted at", r.offset, "bytes:", err)
+
+	if resume_err := r.resume(); resume_err != nil {
+		log.Println("Cannot resume download of", r.path+":", resume_err)
+		return n, err
+	}
+
+	return n, nil
+}
+
+// Reopens the body at the current offset.
+func (r *resumingReader) resume() error {
+	r.body.Close()
+
+	for r.attempts < DOWNLOAD_RESUME_ATTEMPTS {
+		r.attempts++
+		time.Sleep(time.Duration(r.attempts) * DOWNLOAD_RESUME_DELAY)
+
+		body, err := r.reopen()
+		if err == nil {
+			r.body = body
+			return nil
+		}
+
+		log.Println("Resume attempt", r.attempts, "of", r.path, "failed:", err)
+	}
+
+	r.body = ioutil.NopCloser(strings.NewReader(""))
+	return errors.New("giving up after " + strconv.Itoa(r.attempts) + " attempts")
+}
+
+func (r *resumingReader) reopen() (io.ReadCloser, error) {
+	// Bytes of another version must not be glued to the ones already sent.
+	spec, err := GetFileDetail(r.path)
+	if err != nil {
+		return nil, err
+	}
+	if spec.Id != r.file_id {
+		r.attempts = DOWNLOAD_RESUME_ATTEMPTS
+		return nil, errors.New("file has changed")
+	}
+
+	forgetDownloadLink(r.path, r.file_id)
+	link, err := CachedDownloadLink(r.path, r.file_id)
+	if err != nil {
+		return nil, err
+	}
+
+	byte_range := fmt.Sprintf("bytes=%d-", r.offset)
+	if r.end >= 0 {
+		byte_range += strconv.FormatInt(r.end, 10)
+	}
+	header := http.Header{"Range": {byte_range}}
+
+	// Unreachable server is replaced by another one in the middle of the file.
+	resp, server, err := fileServerGet(link, header, r.server)
+	r.server = server
+	if err != nil {
+		return nil, err
+	}
+
+	start, _, ok := parseContentRange(resp.Header.Get("Content-Range"))
+	if resp.StatusCode != http.StatusPartialContent || !ok || start != r.offset {
+		resp.Body.Close()
+		return nil, errors.New("unexpected answer to range request: " + resp.Status)
+	}
+
+	return resp.Body, nil
+}
+
+func (r *resumingReader) Close() error {
+	return r.body.Close()
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// How /get/ serves content a browser would execute (HTML, SVG, XML):
+//
+//	sandbox    - as is, with a CSP sandbox so scripts don't run in our origin
+//	attachment - forced download
+//	text       - as text/plain
+//	allow      - as is
+const (
+	ACTIVE_CONTENT_SANDBOX    = "sandbox"
+	ACTIVE_CONTENT_ATTACHMENT = "attachment"
+	ACTIVE_CONTENT_TEXT       = "text"
+	ACTIVE_CONTENT_ALLOW      = "allow"
+)
+
+const SANDBOX_CONTENT_SECURITY_POLICY = "sandbox; default-src 'none'; style-src 'unsafe-inline'; img-src data:; media-src data:"
+
+var active_content_types = []string{"text/html", "application/xhtml+xml", "image/svg+xml", "text/xml", "application/xml"}
+
+var (
+	active_content string
+
+	// With SEAFILE_SANDBOX_URL set, active content requested from the main origin is
+	// redirected to this separate domain, so even sandbox escapes can't reach our cookies.
+	sandbox_url *url.URL
+)
+
+func ParseActiveContentMode(mode string) (string, error) {
+	switch mode {
+	case ACTIVE_CONTENT_SANDBOX, ACTIVE_CONTENT_ATTACHMENT, ACTIVE_CONTENT_TEXT, ACTIVE_CONTENT_ALLOW:
+		return mode, nil
+	}
+
+	return "", errors.New("Unknown active content mode: " + mode)
+}
+
+func isActiveContentType(content_type string) bool {
+	media_type := strings.ToLower(strings.TrimSpace(strings.SplitN(content_type, ";", 2)[0]))
+	return stringInSlice(media_type, active_content_types) || strings.HasSuffix(media_type, "+xml")
+}
+
+// Whether request came to the sandbox domain.
+func isSandboxRequest(r *http.Request) bool {
+	return sandbox_url != nil && strings.EqualFold(r.Host, sandbox_url.Host)
+}
+
+// Applies active_content mode to the response once its Content-Type is known.
+type activeContentWriter struct {
+	http.ResponseWriter
+	path         string
+	wrote_header bool
+}
+
+func (a *activeContentWriter) WriteHeader(status int) {
+	if !a.wrote_header {
+		a.wrote_header = true
+
+		header := a.Header()
+		if (status == http.StatusOK || status == http.StatusPartialContent) && isActiveContentType(header.Get("Content-Type")) {
+			switch active_content {
+			case ACTIVE_CONTENT_SANDBOX:
+				header.Set("Content-Security-Policy", SANDBOX_CONTENT_SECURITY_POLICY)
+			case ACTIVE_CONTENT_ATTACHMENT:
+				header.Set("Content-Disposition", contentDisposition("attachment", a.path[strings.LastIndex(a.path, "/")+1:]))
+			case ACTIVE_CONTENT_TEXT:
+				header.Set("Content-Type", "text/plain; charset=utf-8")
+			}
+		}
+	}
+
+	a.ResponseWriter.WriteHeader(status)
+}
+
+func (a *activeContentWriter) Write(p []byte) (int, error) {
+	if !a.wrote_header {
+		if a.Header().Get("Content-Type") == "" {
+			a.Header().Set("Content-Type", http.DetectContentType(p))
+		}
+		a.WriteHeader(http.StatusOK)
+	}
+
+	return a.ResponseWriter.Write(p)
+}
+
+func (a *activeContentWriter) Flush() {
+	if f, ok := a.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Wraps /get/ handler so user uploaded HTML and SVG can't run scripts against our origin.
+func withActiveContentPolicy(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if active_content == ACTIVE_CONTENT_ALLOW {
+			handler(w, r)
+			return
+		}
+
+		path := strings.Replace(r.URL.Path, "/get/", "/", 1)
+
+		if active_content == ACTIVE_CONTENT_SANDBOX && sandbox_url != nil && !isSandboxRequest(r) &&
+			isActiveContentType(contentTypeByExtension(path)) {
+			target := *sandbox_url
+			target.Path = strings.TrimRight(target.Path, "/") + r.URL.Path
+			target.RawQuery = r.URL.RawQuery
+			http.Redirect(w, r, target.String(), http.StatusFound)
+			return
+		}
+
+		handler(&activeContentWriter{ResponseWriter: w, path: path}, r)
+	}
+}
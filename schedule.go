@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Daily time window, minutes since midnight. Windows with end before start wrap midnight.
+type UploadWindow struct {
+	Start int
+	End   int
+}
+
+var (
+	// Keys without windows may upload any time.
+	key_upload_windows = make(map[string][]UploadWindow)
+	upload_windows_tz  = time.Local
+)
+
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, errors.New("Invalid time, expected HH:MM: " + s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// Parses SEAFILE_KEY_UPLOAD_WINDOWS value: "batch=00:00-06:00,batch=20:00-22:00,nightly=22:00-02:00".
+func ParseUploadWindows(spec string) (map[string][]UploadWindow, error) {
+	windows := make(map[string][]UploadWindow)
+
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 {
+			return nil, errors.New("Invalid upload window, expected key=HH:MM-HH:MM: " + entry)
+		}
+
+		bounds := strings.SplitN(parts[1], "-", 2)
+		if len(bounds) != 2 {
+			return nil, errors.New("Invalid upload window, expected key=HH:MM-HH:MM: " + entry)
+		}
+
+		start, err := parseClock(bounds[0])
+		if err != nil {
+			return nil, err
+		}
+		end, err := parseClock(bounds[1])
+		if err != nil {
+			return nil, err
+		}
+		if start == end {
+			return nil, errors.New("Empty upload window: " + entry)
+		}
+
+		key := strings.TrimSpace(parts[0])
+		windows[key] = append(windows[key], UploadWindow{Start: start, End: end})
+	}
+
+	return windows, nil
+}
+
+func (window UploadWindow) Contains(minute int) bool {
+	if window.Start < window.End {
+		return minute >= window.Start && minute < window.End
+	}
+	return minute >= window.Start || minute < window.End
+}
+
+func (window UploadWindow) String() string {
+	return fmt.Sprintf("%02d:%02d-%02d:%02d", window.Start/60, window.Start%60, window.End/60, window.End%60)
+}
+
+// Returns error describing allowed windows when the key may not upload at the moment.
+func checkUploadWindow(api_key string, now time.Time) error {
+	windows, ok := key_upload_windows[api_key]
+	if !ok {
+		return nil
+	}
+
+	now = now.In(upload_windows_tz)
+	minute := now.Hour()*60 + now.Minute()
+
+	var allowed []string
+	for _, window := range windows {
+		if window.Contains(minute) {
+			return nil
+		}
+		allowed = append(allowed, window.String())
+	}
+
+	return fmt.Errorf("Uploads with key %s are allowed only %s %s (now %s)",
+		api_key, strings.Join(allowed, ", "), upload_windows_tz, now.Format("15:04"))
+}
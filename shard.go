@@ -0,0 +1,61 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+)
+
+// Folders with hundred thousands of entries make Seafile listings crawl.
+// With SEAFILE_SHARD_THRESHOLD set, uploads into a folder which has that many
+// entries go to a subfolder named by the first two hex digits of SHA-256 of
+// the file name: /uploads/3f/report.pdf. Same name always lands in the same
+// subfolder, so collision handling keeps working. Files already in the folder stay.
+var (
+	shard_threshold int
+
+	// Folders found over the threshold. They don't shrink much, so they are
+	// not listed again until restart.
+	sharded_folders       = make(map[string]bool)
+	sharded_folders_mutex sync.RWMutex
+)
+
+// Subfolder of folder for the file name: "3f/".
+func shardName(filename string) string {
+	sum := sha256.Sum256([]byte(filename))
+	return hex.EncodeToString(sum[:1]) + "/"
+}
+
+// Folder where the upload is stored: folder itself or its shard when folder is full.
+// entries caches entry counts of folders for the request.
+func shardFolder(folder, filename string, entries map[string]int) (string, error) {
+	if shard_threshold <= 0 {
+		return folder, nil
+	}
+
+	sharded_folders_mutex.RLock()
+	sharded := sharded_folders[folder]
+	sharded_folders_mutex.RUnlock()
+
+	if !sharded {
+		count, ok := entries[folder]
+		if !ok {
+			err, listing := ListDirectoryEntries(folder)
+			if err != nil && !isMissingPathError(err) {
+				return "", err
+			}
+			count = len(listing)
+			entries[folder] = count
+		}
+
+		if count < shard_threshold {
+			return folder, nil
+		}
+
+		sharded_folders_mutex.Lock()
+		sharded_folders[folder] = true
+		sharded_folders_mutex.Unlock()
+	}
+
+	return folder + shardName(filename), nil
+}
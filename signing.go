@@ -0,0 +1,162 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Signed download links: /get/folder/file.jpg?expires=<unix time>&sig=<hmac>
+// where hmac is hex encoded HMAC-SHA256 of "<path>\n<expires>" with signing_key.
+
+func signDownloadPath(path string, expires int64) string {
+	mac := hmac.New(sha256.New, []byte(signing_key))
+	mac.Write([]byte(path + "\n" + strconv.FormatInt(expires, 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Absolute signed /get/ URL for the path valid for ttl.
+// Returns empty string when signing key or public URL are not configured.
+func SignedDownloadURL(path string, ttl time.Duration) string {
+	if signing_key == "" || public_url == "" {
+		return ""
+	}
+
+	return strings.TrimRight(public_url, "/") + signedDownloadPath(path, time.Now().Add(ttl).Unix())
+}
+
+// Signed /get/ path with query string, relative to the proxy root.
+func signedDownloadPath(path string, expires int64) string {
+	params := url.Values{
+		"expires": {strconv.FormatInt(expires, 10)},
+		"sig":     {signDownloadPath(path, expires)},
+	}
+
+	get_url := &url.URL{Path: "/get" + path}
+	return get_url.EscapedPath() + "?" + params.Encode()
+}
+
+// Checks signature of the download request.
+// Returns whether request is signed at all and whether the signature is valid and not expired.
+func verifyDownloadSignature(r *http.Request, path string) (signed bool, valid bool) {
+	query := r.URL.Query()
+	sig := query.Get("sig")
+	if sig == "" {
+		return false, false
+	}
+
+	if signing_key == "" {
+		return true, false
+	}
+
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return true, false
+	}
+
+	expected := signDownloadPath(path, expires)
+	return true, hmac.Equal([]byte(sig), []byte(expected))
+}
+
+// Downloads are public unless SEAFILE_PRIVATE_DOWNLOADS is on, then they need
+// a valid signature or proxy API key. Invalid or expired signatures are always rejected.
+func downloadAuthorized(r *http.Request, path string) bool {
+	signed, valid := verifyDownloadSignature(r, path)
+	if signed {
+		return valid
+	}
+
+	if userOfPath(path) != nil {
+		return userPathAllowed(r, path)
+	}
+
+	if !private_downloads {
+		return true
+	}
+
+	if len(api_keys) == 0 {
+		return false
+	}
+
+	_, ok := AuthenticateAPIKey(r)
+	return ok
+}
+
+type SignedURL struct {
+	URL     string `json:"url"`
+	Path    string `json:"path"`
+	Expires int64  `json:"expires"`
+}
+
+// POST /sign with p=/folder/file.jpg and optional ttl=30m mints signed download link.
+// Minting gives access to files, so it needs proxy API key, like /api/v1 changes.
+func signHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println(r.Method, r.RequestURI)
+
+	if r.Method != "GET" && r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !apiKeyAuthorized(r) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	if signing_key == "" {
+		http.Error(w, "SEAFILE_PROXY_SIGNING_KEY is not configured", http.StatusNotImplemented)
+		return
+	}
+
+	path := r.FormValue("p")
+	if !strings.HasPrefix(path, "/") || strings.HasSuffix(path, "/") {
+		http.Error(w, "p should be a file path", http.StatusBadRequest)
+		return
+	}
+
+	ttl := time.Hour
+	if value := r.FormValue("ttl"); value != "" {
+		var err error
+		if ttl, err = time.ParseDuration(value); err != nil || ttl <= 0 {
+			http.Error(w, "Invalid ttl: "+value, http.StatusBadRequest)
+			return
+		}
+	}
+
+	if ttl > signed_url_max_ttl {
+		http.Error(w, "ttl is longer than "+signed_url_max_ttl.String(), http.StatusBadRequest)
+		return
+	}
+
+	_, err := GetFileDetail(path)
+	if isMissingPathError(err) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	base := strings.TrimRight(public_url, "/")
+	if base == "" {
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+		base = scheme + "://" + r.Host
+	}
+
+	expires := time.Now().Add(ttl).Unix()
+	writeJSON(w, http.StatusOK, SignedURL{
+		URL:     base + signedDownloadPath(path, expires),
+		Path:    path,
+		Expires: expires,
+	})
+}
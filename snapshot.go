@@ -0,0 +1,209 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const SNAPSHOT_MANIFEST = "manifest.json"
+
+// Local read-only copy of hot folders, served by /get/ when Seafile is down.
+// SEAFILE_SNAPSHOT_DIR holds manifest.json and the files named by hash of their path.
+type SnapshotEntry struct {
+	Path  string `json:"path"`
+	Id    string `json:"id"`
+	Size  int64  `json:"size"`
+	MTime int64  `json:"mtime"`
+	File  string `json:"file"`
+}
+
+type SnapshotManifest struct {
+	Taken   string                   `json:"taken"`
+	Folders []string                 `json:"folders"`
+	Files   map[string]SnapshotEntry `json:"files"`
+}
+
+var (
+	snapshot_dir      string
+	snapshot_folders  []string
+	snapshot_interval time.Duration
+
+	snapshot_manifest = SnapshotManifest{Files: make(map[string]SnapshotEntry)}
+	snapshot_mutex    sync.RWMutex
+)
+
+func snapshotFileName(path string) string {
+	hash := sha256.Sum256([]byte(path))
+	return hex.EncodeToString(hash[:])
+}
+
+// Loads manifest of the previous snapshot, so it can be served right after restart.
+func loadSnapshotManifest() error {
+	data, err := ioutil.ReadFile(filepath.Join(snapshot_dir, SNAPSHOT_MANIFEST))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var manifest SnapshotManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return err
+	}
+	if manifest.Files == nil {
+		manifest.Files = make(map[string]SnapshotEntry)
+	}
+
+	snapshot_mutex.Lock()
+	snapshot_manifest = manifest
+	snapshot_mutex.Unlock()
+
+	return nil
+}
+
+// Copies changed files of snapshot folders and drops the ones which are gone.
+// Failed folder keeps its files from the previous snapshot.
+func TakeSnapshot() error {
+	snapshot_mutex.RLock()
+	previous := snapshot_manifest.Files
+	snapshot_mutex.RUnlock()
+
+	files := make(map[string]SnapshotEntry)
+	var snapshot_err error
+
+	for _, folder := range snapshot_folders {
+		err := walkFolder(folder, "", func(file_path, relative string, spec FileSpec) error {
+			if old, ok := previous[file_path]; ok && old.Id == spec.Id {
+				files[file_path] = old
+				return nil
+			}
+
+			entry := SnapshotEntry{Path: file_path, Id: spec.Id, Size: spec.Size, MTime: int64(spec.MTime), File: snapshotFileName(file_path)}
+			if err := downloadSnapshotFile(file_path, spec, entry.File); err != nil {
+				return err
+			}
+
+			files[file_path] = entry
+			return nil
+		})
+
+		if err != nil {
+			log.Println("Snapshot of", folder, "failed:", err)
+			snapshot_err = err
+
+			for path, entry := range previous {
+				if strings.HasPrefix(path, folder) {
+					if _, ok := files[path]; !ok {
+						files[path] = entry
+					}
+				}
+			}
+		}
+	}
+
+	manifest := SnapshotManifest{Taken: time.Now().UTC().Format(time.RFC3339), Folders: snapshot_folders, Files: files}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(snapshot_dir, SNAPSHOT_MANIFEST+".tmp")
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(snapshot_dir, SNAPSHOT_MANIFEST)); err != nil {
+		return err
+	}
+
+	snapshot_mutex.Lock()
+	snapshot_manifest = manifest
+	snapshot_mutex.Unlock()
+
+	// Files of the previous snapshot which are not used anymore.
+	for path, entry := range previous {
+		if current, ok := files[path]; !ok || current.File != entry.File {
+			os.Remove(filepath.Join(snapshot_dir, entry.File))
+		}
+	}
+
+	log.Println("Snapshot of", len(files), "files taken")
+	return snapshot_err
+}
+
+func downloadSnapshotFile(file_path string, spec FileSpec, name string) error {
+	src, err := openRemoteFile(file_path, spec)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmp, err := ioutil.TempFile(snapshot_dir, CACHE_TMP_PREFIX)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(tmp, src); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), filepath.Join(snapshot_dir, name))
+}
+
+func runSnapshots() {
+	for {
+		if err := TakeSnapshot(); err != nil {
+			log.Println("Snapshot:", err)
+		}
+
+		time.Sleep(snapshot_interval)
+	}
+}
+
+// Serves file from the snapshot when Seafile can't be reached.
+// Returns false when the file isn't in the snapshot.
+func serveSnapshot(w http.ResponseWriter, r *http.Request, path string) bool {
+	if snapshot_dir == "" {
+		return false
+	}
+
+	snapshot_mutex.RLock()
+	entry, ok := snapshot_manifest.Files[path]
+	taken := snapshot_manifest.Taken
+	snapshot_mutex.RUnlock()
+
+	if !ok {
+		return false
+	}
+
+	file, err := os.Open(filepath.Join(snapshot_dir, entry.File))
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	log.Println("Serving", path, "from snapshot taken", taken)
+
+	w.Header().Set("Warning", `111 - "Revalidation Failed"`)
+	w.Header().Set("X-Cache", "SNAPSHOT")
+	w.Header().Set("ETag", `"`+entry.Id+`"`)
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	http.ServeContent(w, r, path, time.Unix(entry.MTime, 0), file)
+	return true
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const STATE_MANIFEST = "manifest.json"
+
+// Piece of local state: single file or a directory.
+type stateItem struct {
+	name string
+	path string
+	dir  bool
+}
+
+type StateManifest struct {
+	Exported string   `json:"exported"`
+	Items    []string `json:"items"`
+}
+
+// Local state of this instance according to its configuration.
+// Share links live in Seafile and signed links need only SEAFILE_PROXY_SIGNING_KEY,
+// content digests are kept in memory and computed again on demand.
+func stateItems() []stateItem {
+	var items []stateItem
+	if metadata_index.file != "" {
+		items = append(items, stateItem{name: "index", path: metadata_index.file})
+	}
+	if legal_holds_file != "" {
+		items = append(items, stateItem{name: "holds", path: legal_holds_file})
+	}
+	if audit_log != "" {
+		items = append(items, stateItem{name: "audit", path: audit_log})
+	}
+	if quarantine_dir != "" {
+		items = append(items, stateItem{name: "quarantine", path: quarantine_dir, dir: true})
+	}
+	if snapshot_dir != "" {
+		items = append(items, stateItem{name: "snapshot", path: snapshot_dir, dir: true})
+	}
+	if file_locks_file != "" {
+		items = append(items, stateItem{name: "locks", path: file_locks_file})
+	}
+	if watch_file != "" {
+		items = append(items, stateItem{name: "watch", path: watch_file})
+	}
+	return items
+}
+
+// State commands move local state to another instance:
+//
+//	seafile-uploader state export state.tar.gz
+//	seafile-uploader state import [--force] state.tar.gz
+//
+// Items are written to the paths configured on the importing instance.
+func MaybeStateRequest() {
+	if len(os.Args) < 2 || os.Args[1] != "state" {
+		return
+	}
+
+	usage := errors.New("USAGE: seafile-uploader state export state.tar.gz\n       seafile-uploader state import [--force] state.tar.gz")
+	if len(os.Args) < 3 {
+		commandFailed(false, EXIT_USAGE, usage)
+	}
+
+	flags := flag.NewFlagSet("state", flag.ExitOnError)
+	force := flags.Bool("force", false, "replace existing state on import")
+	flags.Parse(os.Args[3:])
+
+	if flags.NArg() != 1 {
+		commandFailed(false, EXIT_USAGE, usage)
+	}
+
+	var err error
+	switch os.Args[2] {
+	case "export":
+		err = ExportState(flags.Arg(0))
+	case "import":
+		err = ImportState(flags.Arg(0), *force)
+	default:
+		commandFailed(false, EXIT_USAGE, usage)
+	}
+
+	if err != nil {
+		commandFailed(false, EXIT_LOCAL, err)
+	}
+	os.Exit(EXIT_OK)
+}
+
+func ExportState(archive string) error {
+	file, err := os.Create(archive)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	gz := gzip.NewWriter(file)
+	tw := tar.NewWriter(gz)
+
+	manifest := StateManifest{Exported: time.Now().UTC().Format(time.RFC3339), Items: []string{}}
+
+	for _, item := range stateItems() {
+		if _, err := os.Stat(item.path); os.IsNotExist(err) {
+			continue
+		}
+
+		err := filepath.Walk(item.path, func(file_path string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return err
+			}
+
+			relative, err := filepath.Rel(item.path, file_path)
+			if err != nil {
+				return err
+			}
+
+			name := item.name
+			if item.dir {
+				name += "/" + filepath.ToSlash(relative)
+			}
+
+			return addStateFile(tw, name, file_path, info)
+		})
+		if err != nil {
+			return err
+		}
+
+		manifest.Items = append(manifest.Items, item.name)
+		log.Println("Exported", item.name, "from", item.path)
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	header := &tar.Header{Name: STATE_MANIFEST, Mode: 0600, Size: int64(len(data)), ModTime: time.Now()}
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	if _, err := tw.Write(data); err != nil {
+		return err
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+func addStateFile(tw *tar.Writer, name, file_path string, info os.FileInfo) error {
+	src, err := os.Open(file_path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	header := &tar.Header{Name: name, Mode: 0600, Size: info.Size(), ModTime: info.ModTime()}
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+
+	_, err = io.CopyN(tw, src, info.Size())
+	return err
+}
+
+// Whether local state item already has data.
+func stateItemExists(item stateItem) bool {
+	if !item.dir {
+		info, err := os.Stat(item.path)
+		return err == nil && info.Size() > 0
+	}
+
+	infos, err := ioutil.ReadDir(item.path)
+	return err == nil && len(infos) > 0
+}
+
+func ImportState(archive string, force bool) error {
+	file, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(gz)
+
+	items := make(map[string]stateItem)
+	for _, item := range stateItems() {
+		items[item.name] = item
+	}
+
+	checked := make(map[string]bool)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		if header.Name == STATE_MANIFEST || header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		parts := strings.SplitN(header.Name, "/", 2)
+		item, ok := items[parts[0]]
+		if !ok {
+			if !checked[parts[0]] {
+				log.Println("Skipping", parts[0], "- it is not configured here")
+				checked[parts[0]] = true
+			}
+			continue
+		}
+
+		if !checked[item.name] {
+			if stateItemExists(item) && !force {
+				return errors.New(item.path + " already has " + item.name + " state, use --force to replace it")
+			}
+			checked[item.name] = true
+			log.Println("Importing", item.name, "to", item.path)
+		}
+
+		target := item.path
+		if item.dir {
+			if len(parts) != 2 || strings.Contains("/"+parts[1]+"/", "/../") {
+				return errors.New("Invalid archive entry: " + header.Name)
+			}
+			target = filepath.Join(item.path, filepath.FromSlash(parts[1]))
+		}
+
+		if err := writeStateFile(target, tr); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Writes file atomically, so interrupted import doesn't leave it truncated.
+func writeStateFile(target string, src io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(target), ".import-")
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(tmp, src); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), target)
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Proxy feature depending on Seafile server. It is available since MinVersion
+// and, when ServerFeature is set, only if the server lists it in server-info
+// (Professional edition features).
+type Feature struct {
+	Name          string
+	Description   string
+	MinVersion    string
+	ServerFeature string
+}
+
+var features = []Feature{
+	{Name: "chunked_upload", Description: "chunked uploads", MinVersion: "5.1.0"},
+	{Name: "thumbnails", Description: "thumbnails", MinVersion: "6.0.0"},
+	{Name: "share_links", Description: "share links", MinVersion: "6.0.0"},
+	{Name: "batch_ops", Description: "batch operations", MinVersion: "6.3.0"},
+	{Name: "tags", Description: "file tags", MinVersion: "7.0.0"},
+	{Name: "search", Description: "search", ServerFeature: "file-search"},
+	{Name: "file_lock", Description: "file locking", ServerFeature: "seafile-pro"},
+	{Name: "activities", Description: "activity feed", MinVersion: "7.0.0"},
+}
+
+// Result of the startup probe, served at /version.
+type ServerSupport struct {
+	SeafileVersion string          `json:"seafile_version,omitempty"`
+	ServerFeatures []string        `json:"server_features,omitempty"`
+	Features       map[string]bool `json:"features"`
+	Probed         time.Time       `json:"probed"`
+	Error          string          `json:"error,omitempty"`
+}
+
+var (
+	server_support       ServerSupport
+	server_support_mutex sync.RWMutex
+)
+
+// Asks Seafile for its version and decides which features it supports.
+// When the server can't be probed every feature is left enabled
+// and Seafile reports what it doesn't support.
+func ProbeServer() {
+	support := ServerSupport{Features: make(map[string]bool), Probed: time.Now()}
+
+	info, err := seafile_client.ServerInfo()
+	if err != nil {
+		support.Error = err.Error()
+		log.Println("Cannot probe Seafile version:", err)
+	} else {
+		support.SeafileVersion = info.Version
+		support.ServerFeatures = info.Features
+	}
+
+	for _, feature := range features {
+		supported := err != nil
+		if err == nil {
+			supported = versionAtLeast(info.Version, feature.MinVersion) &&
+				(feature.ServerFeature == "" || stringInSlice(feature.ServerFeature, info.Features))
+		}
+		support.Features[feature.Name] = supported
+	}
+
+	if err == nil {
+		var disabled []string
+		for _, feature := range features {
+			if !support.Features[feature.Name] {
+				disabled = append(disabled, feature.Name)
+			}
+		}
+		log.Println("Seafile", info.Version, "unsupported features:", disabled)
+	}
+
+	server_support_mutex.Lock()
+	server_support = support
+	server_support_mutex.Unlock()
+}
+
+func currentServerSupport() ServerSupport {
+	server_support_mutex.RLock()
+	defer server_support_mutex.RUnlock()
+
+	return server_support
+}
+
+// Whether Seafile supports the feature. Features are enabled until probed.
+func featureSupported(name string) bool {
+	support := currentServerSupport()
+	if support.Features == nil {
+		return true
+	}
+
+	return support.Features[name]
+}
+
+// Refuses request with 501 explaining what the feature needs, returns true then.
+func refuseUnsupported(w http.ResponseWriter, name string) bool {
+	if featureSupported(name) {
+		return false
+	}
+
+	support := currentServerSupport()
+	msg := "This Seafile server doesn't support " + name
+	for _, feature := range features {
+		if feature.Name != name {
+			continue
+		}
+
+		msg = "Seafile " + support.SeafileVersion + " doesn't support " + feature.Description
+		if feature.MinVersion != "" && !versionAtLeast(support.SeafileVersion, feature.MinVersion) {
+			msg += ", version " + feature.MinVersion + " or newer is required"
+		} else if feature.ServerFeature != "" {
+			msg += ", it needs " + feature.ServerFeature + " of Seafile Professional"
+		}
+	}
+
+	http.Error(w, msg, http.StatusNotImplemented)
+	return true
+}
+
+// Compares dotted versions numerically: 6.10.0 is newer than 6.9.1.
+// Suffixes like "-pro" are ignored, empty min_version is always satisfied.
+func versionAtLeast(version, min_version string) bool {
+	if min_version == "" {
+		return true
+	}
+
+	parts := strings.Split(strings.SplitN(version, "-", 2)[0], ".")
+	min_parts := strings.Split(min_version, ".")
+
+	for i, min_part := range min_parts {
+		min_number, _ := strconv.Atoi(min_part)
+		number := 0
+		if i < len(parts) {
+			number, _ = strconv.Atoi(parts[i])
+		}
+
+		if number != min_number {
+			return number > min_number
+		}
+	}
+
+	return true
+}
+
+// GET /version returns Seafile version and features enabled for it.
+// Version is told to API clients and admins only.
+func versionHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println(r.Method, r.RequestURI)
+
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !apiKeyAuthorized(r) && !adminAuthorized(r, ROLE_VIEWER) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, currentServerSupport())
+}
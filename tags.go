@@ -0,0 +1,314 @@
+package main
+
+import (
+	"errors"
+	"github.com/lazureykis/seafile-uploader/pkg/seafile"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Seafile tags belong to a library. The proxy addresses them by name: a tag
+// is created in the library of the file when the file is tagged, and listings
+// merge tags of the same name over all configured libraries.
+const DEFAULT_TAG_COLOR = "#999999"
+
+type Tag struct {
+	Name       string `json:"name"`
+	Color      string `json:"color"`
+	FilesCount int    `json:"files_count"`
+}
+
+type TaggedFile struct {
+	Path  string           `json:"path"`
+	Name  string           `json:"name"`
+	Size  int64            `json:"size"`
+	MTime seafile.UnixTime `json:"mtime"`
+}
+
+// Tag of the library by name. When it is missing and color is given, it is created.
+func repoTag(repo_id, name, color string) (seafile.RepoTag, bool, error) {
+	tags, err := clientFor(repo_id).ListRepoTags(repo_id)
+	if err != nil {
+		return seafile.RepoTag{}, false, err
+	}
+
+	for _, tag := range tags {
+		if tag.Name == name {
+			return tag, true, nil
+		}
+	}
+
+	if color == "" {
+		return seafile.RepoTag{}, false, nil
+	}
+
+	log.Println("Creating tag", name, "in", repo_id)
+
+	tag, err := clientFor(repo_id).CreateRepoTag(repo_id, name, color)
+	return tag, err == nil, err
+}
+
+// Tags of all configured libraries merged by name.
+func ListTags() ([]Tag, error) {
+	merged := make(map[string]*Tag)
+	for _, repo_id := range ConfiguredRepos() {
+		tags, err := clientFor(repo_id).ListRepoTags(repo_id)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, tag := range tags {
+			if existing, ok := merged[tag.Name]; ok {
+				existing.FilesCount += tag.FilesCount
+			} else {
+				merged[tag.Name] = &Tag{Name: tag.Name, Color: tag.Color, FilesCount: tag.FilesCount}
+			}
+		}
+	}
+
+	tags := []Tag{}
+	for _, tag := range merged {
+		tags = append(tags, *tag)
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		return tags[i].Name < tags[j].Name
+	})
+
+	return tags, nil
+}
+
+// Files having the tag in configured libraries, reachable through the proxy.
+func FilesByTag(name string) ([]TaggedFile, error) {
+	files := []TaggedFile{}
+	for _, repo_id := range ConfiguredRepos() {
+		tag, ok, err := repoTag(repo_id, name, "")
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+
+		tagged, err := clientFor(repo_id).TaggedFiles(repo_id, tag.Id)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, file := range tagged {
+			path, ok := ProxyPath(repo_id, strings.TrimRight(file.ParentPath, "/")+"/"+file.Filename)
+			if ok {
+				files = append(files, TaggedFile{Path: path, Name: file.Filename, Size: file.Size, MTime: file.MTime})
+			}
+		}
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Path < files[j].Path
+	})
+
+	return files, nil
+}
+
+func fileTags(path string) ([]Tag, error) {
+	repo_id, repo_path := RouteRepo(path)
+	file_tags, err := clientFor(repo_id).ListFileTags(repo_id, repo_path)
+	if err != nil {
+		return nil, err
+	}
+
+	tags := []Tag{}
+	for _, tag := range file_tags {
+		tags = append(tags, Tag{Name: tag.Name, Color: tag.Color})
+	}
+	return tags, nil
+}
+
+func tagName(value string) (string, error) {
+	name := strings.TrimSpace(value)
+	if name == "" || len(name) > 255 {
+		return "", errors.New("tag should be a name up to 255 bytes")
+	}
+	return name, nil
+}
+
+// GET /api/v1/tags lists tags, POST /api/v1/tags with name=invoices&color=#FFA8A8
+// defines the tag in every configured library.
+func apiTagsHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println(r.Method, r.RequestURI)
+
+	if r.Method != "GET" && r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if r.Method == "GET" && !downloadAuthorized(r, "/") || r.Method == "POST" && !apiKeyAuthorized(r) {
+		writeAPIError(w, http.StatusForbidden, "Forbidden")
+		return
+	}
+
+	if refuseUnsupported(w, "tags") {
+		return
+	}
+
+	if r.Method == "GET" {
+		tags, err := ListTags()
+		if err != nil {
+			writeAPIError(w, http.StatusBadGateway, err.Error())
+			return
+		}
+
+		writeAPI(w, http.StatusOK, tags)
+		return
+	}
+
+	name, err := tagName(r.FormValue("name"))
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	color := r.FormValue("color")
+	if color == "" {
+		color = DEFAULT_TAG_COLOR
+	}
+
+	for _, repo_id := range ConfiguredRepos() {
+		if _, _, err := repoTag(repo_id, name, color); err != nil {
+			writeAPIError(w, http.StatusBadGateway, err.Error())
+			return
+		}
+	}
+
+	writeAPI(w, http.StatusCreated, Tag{Name: name, Color: color})
+}
+
+// GET /api/v1/tags/files?tag=invoices lists files having the tag,
+// GET /api/v1/tags/files?p=/foo/a.pdf lists tags of the file.
+// POST with p and tag tags the file, DELETE with p and tag removes the tag.
+func apiTagFilesHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println(r.Method, r.RequestURI)
+
+	if r.Method != "GET" && r.Method != "POST" && r.Method != "DELETE" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	path := r.FormValue("p")
+	if path != "" && (!strings.HasPrefix(path, "/") || strings.HasSuffix(path, "/")) {
+		writeAPIError(w, http.StatusBadRequest, "p should be a file path")
+		return
+	}
+
+	read_path := path
+	if read_path == "" {
+		read_path = "/"
+	}
+
+	if r.Method == "GET" && !downloadAuthorized(r, read_path) || r.Method != "GET" && !apiPathsAuthorized(r, path) {
+		writeAPIError(w, http.StatusForbidden, "Forbidden")
+		return
+	}
+
+	if refuseUnsupported(w, "tags") {
+		return
+	}
+
+	if r.Method == "GET" && path == "" {
+		name, err := tagName(r.FormValue("tag"))
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, "tag or p is required")
+			return
+		}
+
+		files, err := FilesByTag(name)
+		if err != nil {
+			writeAPIError(w, http.StatusBadGateway, err.Error())
+			return
+		}
+
+		writeAPI(w, http.StatusOK, map[string]interface{}{"tag": name, "files": files})
+		return
+	}
+
+	if path == "" {
+		writeAPIError(w, http.StatusBadRequest, "p is required")
+		return
+	}
+
+	if r.Method != "GET" {
+		name, err := tagName(r.FormValue("tag"))
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		if refuseInMaintenance(w) {
+			return
+		}
+
+		if r.Method == "POST" {
+			err = TagFile(path, name, r.FormValue("color"))
+		} else {
+			err = UntagFile(path, name)
+		}
+		if err != nil {
+			writeAPIError(w, seafileErrorHTTPStatus(err, http.StatusBadGateway), err.Error())
+			return
+		}
+	}
+
+	tags, err := fileTags(path)
+	if err != nil {
+		writeAPIError(w, seafileErrorHTTPStatus(err, http.StatusBadGateway), err.Error())
+		return
+	}
+
+	writeAPI(w, http.StatusOK, map[string]interface{}{"path": path, "tags": tags})
+}
+
+// Tags the file, creating the tag in its library when needed.
+func TagFile(path, name, color string) error {
+	if color == "" {
+		color = DEFAULT_TAG_COLOR
+	}
+
+	repo_id, repo_path := RouteRepo(path)
+	tag, _, err := repoTag(repo_id, name, color)
+	if err != nil {
+		return err
+	}
+
+	file_tags, err := clientFor(repo_id).ListFileTags(repo_id, repo_path)
+	if err != nil {
+		return err
+	}
+	for _, file_tag := range file_tags {
+		if file_tag.RepoTagId == tag.Id {
+			return nil
+		}
+	}
+
+	log.Println("Tagging", path, "with", name)
+
+	_, err = clientFor(repo_id).AddFileTag(repo_id, repo_path, tag.Id)
+	return err
+}
+
+// Removes the tag from the file. Missing tag is not an error.
+func UntagFile(path, name string) error {
+	repo_id, repo_path := RouteRepo(path)
+	file_tags, err := clientFor(repo_id).ListFileTags(repo_id, repo_path)
+	if err != nil {
+		return err
+	}
+
+	for _, file_tag := range file_tags {
+		if file_tag.Name == name {
+			log.Println("Untagging", path, "from", name)
+			return clientFor(repo_id).DeleteFileTag(repo_id, file_tag.Id)
+		}
+	}
+
+	return nil
+}
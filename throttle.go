@@ -0,0 +1,186 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const THROTTLE_CHUNK_SIZE = 32 * 1024
+
+// Token bucket shared by all transfers it is attached to.
+// Burst size equals one second worth of traffic.
+type RateLimiter struct {
+	mutex  sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func NewRateLimiter(bytes_per_second int64) *RateLimiter {
+	return &RateLimiter{
+		rate:   float64(bytes_per_second),
+		tokens: float64(bytes_per_second),
+		last:   time.Now(),
+	}
+}
+
+// Takes n tokens from the bucket, sleeping while the bucket is in debt.
+func (l *RateLimiter) Wait(n int) {
+	l.mutex.Lock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.rate {
+		l.tokens = l.rate
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	tokens := l.tokens
+	l.mutex.Unlock()
+
+	if tokens < 0 {
+		time.Sleep(time.Duration(-tokens / l.rate * float64(time.Second)))
+	}
+}
+
+type throttledReader struct {
+	reader   io.Reader
+	limiters []*RateLimiter
+}
+
+// Wraps reader so it doesn't exceed any of the limiters. Nil limiters are ignored.
+func ThrottleReader(reader io.Reader, limiters ...*RateLimiter) io.Reader {
+	var active []*RateLimiter
+	for _, limiter := range limiters {
+		if limiter != nil {
+			active = append(active, limiter)
+		}
+	}
+
+	if len(active) == 0 {
+		return reader
+	}
+
+	return &throttledReader{reader: reader, limiters: active}
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	if len(p) > THROTTLE_CHUNK_SIZE {
+		p = p[:THROTTLE_CHUNK_SIZE]
+	}
+
+	n, err := t.reader.Read(p)
+	for _, limiter := range t.limiters {
+		limiter.Wait(n)
+	}
+
+	return n, err
+}
+
+type throttledResponseWriter struct {
+	http.ResponseWriter
+	limiters []*RateLimiter
+}
+
+func (t *throttledResponseWriter) Write(p []byte) (int, error) {
+	written := 0
+
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > THROTTLE_CHUNK_SIZE {
+			chunk = chunk[:THROTTLE_CHUNK_SIZE]
+		}
+
+		for _, limiter := range t.limiters {
+			limiter.Wait(len(chunk))
+		}
+
+		n, err := t.ResponseWriter.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+
+	return written, nil
+}
+
+func (t *throttledResponseWriter) Flush() {
+	if f, ok := t.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Wraps handler so its response body doesn't exceed the global download limit
+// and the per-request one.
+func withDownloadLimits(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var limiters []*RateLimiter
+		if global_download_limiter != nil {
+			limiters = append(limiters, global_download_limiter)
+		}
+		if connection_download_limit > 0 {
+			limiters = append(limiters, NewRateLimiter(connection_download_limit))
+		}
+
+		if len(limiters) == 0 {
+			handler(w, r)
+			return
+		}
+
+		handler(&throttledResponseWriter{ResponseWriter: w, limiters: limiters}, r)
+	}
+}
+
+// Parses sizes like "512", "64KB", "20MB", "1G" (binary units).
+func ParseByteSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	s = strings.TrimSuffix(s, "B")
+
+	multiplier := int64(1)
+	for suffix, m := range map[string]int64{"K": 1 << 10, "M": 1 << 20, "G": 1 << 30} {
+		if strings.HasSuffix(s, suffix) {
+			multiplier = m
+			s = strings.TrimSuffix(s, suffix)
+			break
+		}
+	}
+
+	value, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	if err != nil || value <= 0 {
+		return 0, errors.New("Invalid size: " + s)
+	}
+
+	return value * multiplier, nil
+}
+
+// Parses per-key limits: "bulk-import=20MB,nightly=5MB" (bytes per second).
+func ParseKeyRateLimits(spec string) (map[string]*RateLimiter, error) {
+	limiters := make(map[string]*RateLimiter)
+
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 {
+			return nil, errors.New("Invalid rate limit, expected key=size: " + entry)
+		}
+
+		rate, err := ParseByteSize(parts[1])
+		if err != nil {
+			return nil, err
+		}
+
+		limiters[strings.TrimSpace(parts[0])] = NewRateLimiter(rate)
+	}
+
+	return limiters, nil
+}
@@ -0,0 +1,18 @@
+//go:build transform_lowercase
+// +build transform_lowercase
+
+package main
+
+import "strings"
+
+// Example of compiled-in transformer: stores files under lowercase names.
+type lowercaseTransformer struct{}
+
+func (lowercaseTransformer) Transform(target *UploadTarget) error {
+	target.Filename = strings.ToLower(target.Filename)
+	return nil
+}
+
+func init() {
+	RegisterTransformer("lowercase", lowercaseTransformer{})
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const TRANSFORMER_TIMEOUT = 10 * time.Second
+
+// Where and how a file is about to be stored. Transformers may change
+// folders, filename and metadata; the rest is informational.
+type UploadTarget struct {
+	Folders      []string               `json:"folders"`
+	Filename     string                 `json:"filename"`
+	Metadata     map[string]interface{} `json:"metadata"`
+	OriginalName string                 `json:"original_name"`
+	APIKey       string                 `json:"api_key,omitempty"`
+	Size         int64                  `json:"size"`
+}
+
+// Site-specific naming rules. Compiled-in transformers register themselves
+// in init() of a file guarded by a build tag, see transform_lowercase.go:
+//
+//	go build -tags transform_lowercase
+//
+// External ones are programs given as "exec:/path/to/program" in SEAFILE_TRANSFORMERS,
+// they get UploadTarget as JSON on stdin and print the changed one to stdout.
+type Transformer interface {
+	Transform(target *UploadTarget) error
+}
+
+var (
+	registered_transformers       = make(map[string]Transformer)
+	registered_transformers_mutex sync.Mutex
+
+	// Transformers applied to uploads, in order.
+	upload_transformers []Transformer
+)
+
+func RegisterTransformer(name string, transformer Transformer) {
+	registered_transformers_mutex.Lock()
+	defer registered_transformers_mutex.Unlock()
+
+	registered_transformers[name] = transformer
+}
+
+func registeredTransformerNames() []string {
+	var names []string
+	for name := range registered_transformers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Parses SEAFILE_TRANSFORMERS value: "lowercase,exec:/usr/local/bin/rename-invoice".
+func ParseTransformers(spec string) ([]Transformer, error) {
+	registered_transformers_mutex.Lock()
+	defer registered_transformers_mutex.Unlock()
+
+	var transformers []Transformer
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		if strings.HasPrefix(name, "exec:") {
+			transformers = append(transformers, &processTransformer{command: strings.TrimPrefix(name, "exec:")})
+			continue
+		}
+
+		transformer, ok := registered_transformers[name]
+		if !ok {
+			return nil, errors.New("Unknown transformer " + name + ", compiled in: " + strings.Join(registeredTransformerNames(), ", "))
+		}
+		transformers = append(transformers, transformer)
+	}
+
+	return transformers, nil
+}
+
+// Applies upload_transformers and checks they left a usable target.
+func TransformUpload(target *UploadTarget) error {
+	for _, transformer := range upload_transformers {
+		if err := transformer.Transform(target); err != nil {
+			return err
+		}
+	}
+
+	filename, err := SanitizeFilename(target.Filename)
+	if err != nil {
+		return err
+	}
+	target.Filename = filename
+
+	if len(target.Folders) == 0 {
+		return errors.New("Transformers left no folders for " + filename)
+	}
+	for _, folder := range target.Folders {
+		if !strings.HasPrefix(folder, "/") {
+			return errors.New("Transformed folder should start with /: " + folder)
+		}
+	}
+
+	return nil
+}
+
+// External program transformer.
+type processTransformer struct {
+	command string
+}
+
+func (p *processTransformer) Transform(target *UploadTarget) error {
+	input, err := json.Marshal(target)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), TRANSFORMER_TIMEOUT)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, p.command)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return errors.New("Transformer " + p.command + " failed: " + err.Error() + " " + strings.TrimSpace(stderr.String()))
+	}
+
+	var transformed UploadTarget
+	if err := json.Unmarshal(stdout.Bytes(), &transformed); err != nil {
+		return errors.New("Transformer " + p.command + " printed invalid JSON: " + err.Error())
+	}
+
+	target.Folders = transformed.Folders
+	target.Filename = transformed.Filename
+	target.Metadata = transformed.Metadata
+	return nil
+}
@@ -0,0 +1,408 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// TypeScript client of /api/v1 generated from the OpenAPI document, so it
+// can't drift from the handlers either. pkg/client/ts/client.ts is its output:
+//
+//	seafile-uploader typescript > pkg/client/ts/client.ts
+func MaybeTypeScriptRequest() {
+	if len(os.Args) < 2 || os.Args[1] != "typescript" {
+		return
+	}
+
+	fmt.Print(typeScriptClient())
+	os.Exit(EXIT_OK)
+}
+
+const typeScriptHeader = `// Client of seafile-uploader /api/v1.
+// Generated by "seafile-uploader typescript" from /api/openapi.json, don't edit.
+//
+//	const proxy = new Client("https://files.example.com", "my-api-key");
+//	const listing = await proxy.getDir({ p: "/photos/" });
+//
+// Errors answered by the proxy are thrown as ProxyError with the status and error code.
+
+export interface Envelope<T> {
+  data: T;
+  warnings?: string[];
+}
+
+export class ProxyError extends Error {
+  constructor(public status: number, public code: string, message: string) {
+    super(message);
+  }
+}
+
+type Params = Record<string, unknown>;
+
+export class Client {
+  // url is the proxy address, apiKey is sent as X-Api-Key and adminKey as X-Admin-Key.
+  constructor(public url: string, public apiKey = "", public adminKey = "") {}
+
+  private async request(method: string, path: string, query: Params, body: Params | null, admin: boolean, multipart: boolean): Promise<Response> {
+    const search = new URLSearchParams();
+    for (const [name, value] of Object.entries(query)) {
+      for (const item of Array.isArray(value) ? value : [value]) {
+        if (item !== undefined && item !== null) {
+          search.append(name, String(item));
+        }
+      }
+    }
+
+    const headers: Record<string, string> = {};
+    if (admin && this.adminKey) {
+      headers["X-Admin-Key"] = this.adminKey;
+    } else if (this.apiKey) {
+      headers["X-Api-Key"] = this.apiKey;
+    }
+
+    let payload: BodyInit | undefined;
+    if (body && multipart) {
+      const form = new FormData();
+      for (const [name, value] of Object.entries(body)) {
+        for (const item of Array.isArray(value) ? value : [value]) {
+          if (item !== undefined && item !== null) {
+            form.append(name, item instanceof Blob ? item : String(item));
+          }
+        }
+      }
+      payload = form;
+    } else if (body) {
+      headers["Content-Type"] = "application/json";
+      payload = JSON.stringify(body);
+    }
+
+    const query_string = search.toString();
+    const response = await fetch(this.url.replace(/\/+$/, "") + path + (query_string ? "?" + query_string : ""), { method, headers, body: payload });
+    if (!response.ok) {
+      let code = "";
+      let message = response.statusText;
+      try {
+        const answer = await response.json();
+        code = answer.error.code;
+        message = answer.error.message;
+      } catch (e) {
+        // Not the JSON error of the proxy.
+      }
+      throw new ProxyError(response.status, code, message);
+    }
+    return response;
+  }
+`
+
+var typeScriptIdentifier = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*$`)
+
+// Error schema would hide the built-in Error class.
+func typeScriptName(schema_name string) string {
+	if schema_name == "Error" {
+		return "ErrorResponse"
+	}
+	return schema_name
+}
+
+func typeScriptProperty(name string) string {
+	if typeScriptIdentifier.MatchString(name) {
+		return name
+	}
+	return strconv.Quote(name)
+}
+
+func typeScriptComment(text, indent string) string {
+	if text == "" {
+		return ""
+	}
+	return indent + "/** " + strings.Replace(text, "*/", "* /", -1) + " */\n"
+}
+
+// TypeScript type of JSON schema decoded from the document.
+func typeScriptType(schema map[string]interface{}, indent string) string {
+	if ref, ok := schema["$ref"].(string); ok {
+		return typeScriptName(ref[strings.LastIndex(ref, "/")+1:])
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		var values []string
+		for _, value := range enum {
+			values = append(values, strconv.Quote(fmt.Sprint(value)))
+		}
+		return strings.Join(values, " | ")
+	}
+
+	switch schema["type"] {
+	case "string":
+		if schema["format"] == "binary" {
+			return "Blob"
+		}
+		return "string"
+	case "integer", "number":
+		return "number"
+	case "boolean":
+		return "boolean"
+	case "array":
+		items, _ := schema["items"].(map[string]interface{})
+		item := typeScriptType(items, indent)
+		if strings.Contains(item, " | ") {
+			return "Array<" + item + ">"
+		}
+		return item + "[]"
+	case "object":
+		properties, _ := schema["properties"].(map[string]interface{})
+		if len(properties) == 0 {
+			return "Record<string, unknown>"
+		}
+		return typeScriptObject(properties, schema["required"], indent)
+	}
+
+	return "unknown"
+}
+
+func typeScriptObject(properties map[string]interface{}, required interface{}, indent string) string {
+	is_required := make(map[string]bool)
+	if names, ok := required.([]interface{}); ok {
+		for _, name := range names {
+			is_required[fmt.Sprint(name)] = true
+		}
+	}
+
+	var names []string
+	for name := range properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var out strings.Builder
+	out.WriteString("{\n")
+	for _, name := range names {
+		property, _ := properties[name].(map[string]interface{})
+		description, _ := property["description"].(string)
+		out.WriteString(typeScriptComment(description, indent+"  "))
+
+		optional := "?"
+		if is_required[name] {
+			optional = ""
+		}
+		fmt.Fprintf(&out, "%s  %s%s: %s;\n", indent, typeScriptProperty(name), optional, typeScriptType(property, indent+"  "))
+	}
+	out.WriteString(indent + "}")
+	return out.String()
+}
+
+// Query and body parameters of the operation, names of path parameters and of required ones.
+func typeScriptParams(operation map[string]interface{}) (query map[string]interface{}, body map[string]interface{}, path_params []string, multipart bool, required []interface{}) {
+	query = make(map[string]interface{})
+	if params, ok := operation["parameters"].([]interface{}); ok {
+		for _, param := range params {
+			param := param.(map[string]interface{})
+			name := param["name"].(string)
+			schema, _ := param["schema"].(map[string]interface{})
+			if description, _ := param["description"].(string); description != "" {
+				schema["description"] = description
+			}
+			query[name] = schema
+			if param["required"] == true {
+				required = append(required, name)
+			}
+			if param["in"] == "path" {
+				path_params = append(path_params, name)
+			}
+		}
+	}
+
+	if request_body, ok := operation["requestBody"].(map[string]interface{}); ok {
+		content := request_body["content"].(map[string]interface{})
+		media, ok := content["multipart/form-data"].(map[string]interface{})
+		multipart = ok
+		if !ok {
+			media = content["application/json"].(map[string]interface{})
+		}
+		schema := media["schema"].(map[string]interface{})
+		body, _ = schema["properties"].(map[string]interface{})
+		if names, ok := schema["required"].([]interface{}); ok {
+			required = append(required, names...)
+		}
+	}
+
+	return query, body, path_params, multipart, required
+}
+
+// Result type of the operation and expression reading it from response.
+func typeScriptResult(operation map[string]interface{}) (string, string) {
+	responses := operation["responses"].(map[string]interface{})
+
+	var codes []string
+	for code := range responses {
+		if strings.HasPrefix(code, "2") {
+			codes = append(codes, code)
+		}
+	}
+	sort.Strings(codes)
+	if len(codes) == 0 {
+		return "Response", "response"
+	}
+
+	response := responses[codes[0]].(map[string]interface{})
+	content, _ := response["content"].(map[string]interface{})
+	if media, ok := content["application/json"].(map[string]interface{}); ok {
+		envelope := media["schema"].(map[string]interface{})
+		data := envelope["properties"].(map[string]interface{})["data"].(map[string]interface{})
+		return "Envelope<" + typeScriptType(data, "  ") + ">", "response.json()"
+	}
+	if _, ok := content["application/octet-stream"]; ok {
+		return "Blob", "response.blob()"
+	}
+	if codes[0] == "204" {
+		return "void", ""
+	}
+
+	// Streams like text/event-stream are left to the caller.
+	return "Response", "response"
+}
+
+func typeScriptMethod(out *strings.Builder, path, method string, operation map[string]interface{}) {
+	query, body, path_params, multipart, required := typeScriptParams(operation)
+	result, read := typeScriptResult(operation)
+
+	admin := false
+	if security, ok := operation["security"].([]interface{}); ok && len(security) == 1 {
+		_, admin = security[0].(map[string]interface{})["adminKey"]
+	}
+
+	params := make(map[string]interface{})
+	for name, schema := range query {
+		params[name] = schema
+	}
+	for name, schema := range body {
+		params[name] = schema
+	}
+
+	summary, _ := operation["summary"].(string)
+	if description, _ := operation["description"].(string); description != "" {
+		summary += ". " + description
+	}
+	fmt.Fprintf(out, "\n%s", typeScriptComment(fmt.Sprintf("%s %s: %s", strings.ToUpper(method), path, summary), "  "))
+
+	signature := ""
+	if len(params) > 0 {
+		default_value := ""
+		if len(required) == 0 {
+			default_value = " = {}"
+		}
+		signature = "params: " + typeScriptObject(params, required, "  ") + default_value
+	}
+	fmt.Fprintf(out, "  async %s(%s): Promise<%s> {\n", operation["operationId"], signature, result)
+
+	url_path := strconv.Quote(path)
+	for _, name := range path_params {
+		value := fmt.Sprintf(`String(%s).replace(/^\/+/, "").split("/").map(encodeURIComponent).join("/")`, name)
+		url_path = strings.Replace(url_path, "{"+name+"}", `" + `+value+` + "`, 1)
+	}
+	url_path = strings.Replace(url_path, ` + ""`, "", -1)
+
+	query_names := typeScriptPick(query, path_params)
+	body_names := typeScriptPick(body, nil)
+	body_value := "null"
+	if body != nil {
+		body_value = "{ " + strings.Join(body_names, ", ") + " }"
+		if len(body_names) == 0 {
+			body_value = "{}"
+		}
+	}
+	query_value := "{}"
+	if len(query_names) > 0 {
+		query_value = "{ " + strings.Join(query_names, ", ") + " }"
+	}
+	if len(params) > 0 {
+		var names []string
+		for name := range params {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		fmt.Fprintf(out, "    const { %s } = params;\n", strings.Join(names, ", "))
+	}
+
+	call := fmt.Sprintf("this.request(%q, %s, %s, %s, %t, %t)", strings.ToUpper(method), url_path, query_value, body_value, admin, multipart)
+	switch read {
+	case "":
+		fmt.Fprintf(out, "    await %s;\n", call)
+	case "response":
+		fmt.Fprintf(out, "    return %s;\n", call)
+	default:
+		fmt.Fprintf(out, "    const response = await %s;\n    return %s;\n", call, read)
+	}
+	out.WriteString("  }\n")
+}
+
+// Sorted parameter names without the excluded ones.
+func typeScriptPick(params map[string]interface{}, excluded []string) []string {
+	var names []string
+	for name := range params {
+		skip := false
+		for _, other := range excluded {
+			skip = skip || name == other
+		}
+		if !skip {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func typeScriptClient() string {
+	// Decoded like a client would see it, with the same types everywhere.
+	var document map[string]interface{}
+	data, err := json.Marshal(openAPIDocument())
+	if err == nil {
+		err = json.Unmarshal(data, &document)
+	}
+	if err != nil {
+		panic(err)
+	}
+
+	var out strings.Builder
+	out.WriteString(typeScriptHeader)
+
+	paths := document["paths"].(map[string]interface{})
+	var path_names []string
+	for path := range paths {
+		path_names = append(path_names, path)
+	}
+	sort.Strings(path_names)
+
+	for _, path := range path_names {
+		methods := paths[path].(map[string]interface{})
+		for _, method := range []string{"get", "post", "put", "patch", "delete"} {
+			if operation, ok := methods[method].(map[string]interface{}); ok {
+				typeScriptMethod(&out, path, method, operation)
+			}
+		}
+	}
+	out.WriteString("}\n")
+
+	schemas := document["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+	var schema_names []string
+	for name := range schemas {
+		schema_names = append(schema_names, name)
+	}
+	sort.Strings(schema_names)
+
+	for _, name := range schema_names {
+		schema := schemas[name].(map[string]interface{})
+		if properties, ok := schema["properties"].(map[string]interface{}); ok && schema["type"] == "object" {
+			fmt.Fprintf(&out, "\nexport interface %s %s\n", typeScriptName(name), typeScriptObject(properties, schema["required"], ""))
+		} else {
+			fmt.Fprintf(&out, "\nexport type %s = %s;\n", typeScriptName(name), typeScriptType(schema, ""))
+		}
+	}
+
+	return out.String()
+}
@@ -0,0 +1,17 @@
+package main
+
+import (
+	"io/ioutil"
+	"testing"
+)
+
+func TestTypeScriptClientIsGenerated(t *testing.T) {
+	data, err := ioutil.ReadFile("pkg/client/ts/client.ts")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(data) != typeScriptClient() {
+		t.Error("pkg/client/ts/client.ts is out of date, run: seafile-uploader typescript > pkg/client/ts/client.ts")
+	}
+}
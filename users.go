@@ -0,0 +1,236 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/lazureykis/seafile-uploader/pkg/seafile"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Multi-user mode: API keys of SEAFILE_USERS_FILE work with their own
+// Seafile token in their own library instead of the proxy's one.
+//
+//	{"alice": {"api_key": "secret1", "token": "f2210dac...", "repo": "99b758e6-..."}}
+//
+// Library is the user's default one when repo is blank. With username and
+// password the user logs in again when the token expires, like SEAFILE_USERNAME.
+//
+// Library of the user is mounted at /~alice/: uploads of alice go there and
+// its files are downloaded as /get/~alice/file.jpg. User keys aren't proxy
+// API keys, they can't reach anything else. Proxy API keys reach user libraries.
+//
+// Through /api/v1 user keys change files of their own library: mkdir, delete,
+// move, copy, revert, lock, share and tag. Listing libraries, defining tags,
+// watch webhooks and /sign need proxy API key.
+type UserAccount struct {
+	Name     string `json:"-"`
+	APIKey   string `json:"api_key"`
+	Token    string `json:"token"`
+	Repo     string `json:"repo"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+
+	client      *seafile.Client
+	token_mutex sync.RWMutex
+	login_mutex sync.Mutex
+}
+
+const USER_PATH_PREFIX = "/~"
+
+var (
+	// Key name -> account.
+	user_accounts = make(map[string]*UserAccount)
+
+	// Library id -> account.
+	user_repos = make(map[string]*UserAccount)
+)
+
+// Loads SEAFILE_USERS_FILE. Needs seafile_client and api_keys set up.
+func loadUserAccounts(file string) error {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	var accounts map[string]*UserAccount
+	if err := json.Unmarshal(data, &accounts); err != nil {
+		return err
+	}
+
+	keys := make(map[string]bool)
+	for name, account := range accounts {
+		if account == nil || account.APIKey == "" || account.Token == "" && account.Password == "" {
+			return errors.New("api_key and token or password are required for user " + name)
+		}
+		if name == "" || strings.ContainsAny(name, "/\\{}") {
+			return errors.New("Invalid user name: " + name)
+		}
+		if account.Repo != "" && !isRepoId(account.Repo) {
+			return errors.New("Invalid repo of user " + name + ": " + account.Repo)
+		}
+		if _, ok := api_keys[account.APIKey]; ok || keys[account.APIKey] {
+			return errors.New("API key of user " + name + " is already in use")
+		}
+		keys[account.APIKey] = true
+
+		account.Name = name
+		account.client = &seafile.Client{URL: seafile_client.URL, TokenFunc: account.currentToken, HTTPClient: seafile_client.HTTPClient}
+		if account.Username != "" && account.Password != "" {
+			account.client.Relogin = account.relogin
+		}
+
+		if account.Token == "" {
+			if err := account.relogin(""); err != nil {
+				return err
+			}
+		}
+
+		if account.Repo == "" {
+			if account.Repo, err = account.client.DefaultRepo(); err != nil {
+				return fmt.Errorf("Cannot get library of user %s > %w", name, err)
+			}
+		}
+		if other, ok := user_repos[account.Repo]; ok {
+			return errors.New("Users " + other.Name + " and " + name + " share library " + account.Repo)
+		}
+
+		user_accounts[name] = account
+		user_repos[account.Repo] = account
+	}
+
+	log.Println("Loaded", len(user_accounts), "users")
+	return nil
+}
+
+func (account *UserAccount) currentToken() string {
+	account.token_mutex.RLock()
+	defer account.token_mutex.RUnlock()
+
+	return account.Token
+}
+
+// Same as reloginToken but for the user.
+func (account *UserAccount) relogin(failed_token string) error {
+	account.login_mutex.Lock()
+	defer account.login_mutex.Unlock()
+
+	if account.currentToken() != failed_token {
+		return nil
+	}
+
+	new_token, err := RequestToken(account.Username, account.Password)
+	if err != nil {
+		log.Println("Cannot log in again as", account.Username, ">", err)
+		return err
+	}
+
+	account.token_mutex.Lock()
+	account.Token = new_token
+	account.token_mutex.Unlock()
+
+	log.Println("Seafile token of user", account.Name, "expired, logged in again")
+	Audit(AuditEvent{Event: "token_relogin", APIKey: account.Name, Details: map[string]string{"username": account.Username}})
+	return nil
+}
+
+// Proxy path where the user's library is mounted: /~alice/
+func (account *UserAccount) Prefix() string {
+	return USER_PATH_PREFIX + account.Name + "/"
+}
+
+// Moves upload folders into the user's library: /photos/ -> /~alice/photos/
+func (account *UserAccount) Folders(folders []string) []string {
+	var user_folders []string
+	for _, folder := range folders {
+		user_folders = append(user_folders, account.Prefix()+strings.TrimPrefix(folder, "/"))
+	}
+	return user_folders
+}
+
+// Account of the user key passed like proxy API keys.
+func authenticateUser(r *http.Request) (*UserAccount, bool) {
+	secret := requestAPIKey(r)
+	if secret == "" {
+		return nil, false
+	}
+
+	for _, account := range user_accounts {
+		if subtle.ConstantTimeCompare([]byte(secret), []byte(account.APIKey)) == 1 {
+			return account, true
+		}
+	}
+
+	return nil, false
+}
+
+// Account whose library holds the path, nil for other paths.
+func userOfPath(path string) *UserAccount {
+	if !strings.HasPrefix(path, USER_PATH_PREFIX) {
+		return nil
+	}
+
+	name := strings.SplitN(strings.TrimPrefix(path, USER_PATH_PREFIX), "/", 2)[0]
+	return user_accounts[name]
+}
+
+// Library of the user is open to the user and proxy API keys only.
+func userPathAllowed(r *http.Request, path string) bool {
+	owner := userOfPath(path)
+	if owner == nil {
+		return true
+	}
+
+	if account, ok := authenticateUser(r); ok {
+		return account == owner
+	}
+
+	return apiKeyAuthorized(r)
+}
+
+// Whether request may change the paths through /api/v1: user key for paths in
+// its own library, otherwise what apiKeyAuthorized allows.
+func apiPathsAuthorized(r *http.Request, paths ...string) bool {
+	account, ok := authenticateUser(r)
+	if !ok {
+		return apiKeyAuthorized(r)
+	}
+
+	for _, path := range paths {
+		if userOfPath(path) != account {
+			return false
+		}
+	}
+	return len(paths) > 0
+}
+
+// Owner of locks taken by the request: user name or proxy API key name.
+func requestKeyName(r *http.Request) string {
+	if account, ok := authenticateUser(r); ok {
+		return account.Name
+	}
+
+	name, _ := AuthenticateAPIKey(r)
+	return name
+}
+
+// Client with the token of the library owner.
+func clientFor(repo_id string) *seafile.Client {
+	if account, ok := user_repos[repo_id]; ok {
+		return account.client
+	}
+	return seafile_client
+}
+
+// Same as clientFor but for storage operations.
+func storageFor(repo_id string) seafile.Storage {
+	if account, ok := user_repos[repo_id]; ok {
+		return account.client
+	}
+	return storage
+}
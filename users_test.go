@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAPIPathsAuthorizedForUser(t *testing.T) {
+	saved_accounts, saved_keys := user_accounts, api_keys
+	defer func() { user_accounts, api_keys = saved_accounts, saved_keys }()
+	user_accounts = map[string]*UserAccount{
+		"alice": {Name: "alice", APIKey: "alice-secret"},
+		"bob":   {Name: "bob", APIKey: "bob-secret"},
+	}
+	api_keys = map[string]string{"secret": "app"}
+
+	cases := []struct {
+		key    string
+		paths  []string
+		allows bool
+	}{
+		{"alice-secret", []string{"/~alice/a.txt"}, true},
+		{"alice-secret", []string{"/~alice/a.txt", "/~alice/b/"}, true},
+		{"alice-secret", []string{"/~alice/a.txt", "/~bob/b.txt"}, false},
+		{"alice-secret", []string{"/docs/a.txt"}, false},
+		{"alice-secret", nil, false},
+		{"secret", []string{"/~bob/b.txt", "/docs/a.txt"}, true},
+		{"guess", []string{"/~alice/a.txt"}, false},
+	}
+
+	for _, c := range cases {
+		r := httptest.NewRequest("POST", "/api/v1/file/move", nil)
+		r.Header.Set("X-Api-Key", c.key)
+		if got := apiPathsAuthorized(r, c.paths...); got != c.allows {
+			t.Errorf("apiPathsAuthorized(%q, %v) = %v, want %v", c.key, c.paths, got, c.allows)
+		}
+	}
+}
@@ -0,0 +1,476 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Clients subscribe to changes under a folder prefix instead of polling listings:
+// webhooks registered via /api/v1/watch receive every change as JSON POST,
+// /api/v1/watch/stream?prefix=/foo/ streams them as Server-Sent Events.
+// Changes made through the proxy are published right away. Every
+// SEAFILE_WATCH_RECONCILE_INTERVAL watched folders are listed as well,
+// so files changed directly in Seafile are noticed too.
+//
+// Event types: uploaded, created, updated, deleted, moved, copied, reverted.
+// created and updated come from reconciliation, created also for new folders.
+type ChangeEvent struct {
+	Id     string `json:"id"`
+	Time   string `json:"time"`
+	Type   string `json:"type"`
+	Path   string `json:"path"`
+	From   string `json:"from,omitempty"`
+	FileId string `json:"file_id,omitempty"`
+	Source string `json:"source"` // proxy or seafile
+}
+
+type WatchSubscription struct {
+	Id      string `json:"id"`
+	Prefix  string `json:"prefix"`
+	URL     string `json:"url"`
+	Created string `json:"created"`
+}
+
+const (
+	WATCH_STREAM_BUFFER     = 64
+	WATCH_STREAM_HEARTBEAT  = 30 * time.Second
+	MAX_WATCH_RECONCILED    = 100000
+	MAX_WATCH_SUBSCRIPTIONS = 1000
+)
+
+var errTooManyWatched = errors.New("Too many files to reconcile")
+
+type watchStream struct {
+	prefix string
+	events chan ChangeEvent
+}
+
+var (
+	watch_subscriptions      = make(map[string]WatchSubscription)
+	watch_streams            = make(map[*watchStream]bool)
+	watch_file               string
+	watch_reconcile_interval time.Duration
+	watch_mutex              sync.RWMutex
+
+	// Files under every watched prefix as of the last reconciliation: path -> file id.
+	watch_snapshots = make(map[string]map[string]string)
+)
+
+// Loads webhooks registered before restart.
+func loadWatchSubscriptions(file string) error {
+	watch_file = file
+
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var subscriptions []WatchSubscription
+	if err := json.Unmarshal(data, &subscriptions); err != nil {
+		return err
+	}
+
+	for _, subscription := range subscriptions {
+		watch_subscriptions[subscription.Id] = subscription
+	}
+	return nil
+}
+
+// Called with mutex held.
+func saveWatchSubscriptions() error {
+	if watch_file == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(watchSubscriptionList(), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := watch_file + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, watch_file)
+}
+
+// Called with mutex held.
+func watchSubscriptionList() []WatchSubscription {
+	subscriptions := []WatchSubscription{}
+	for _, subscription := range watch_subscriptions {
+		subscriptions = append(subscriptions, subscription)
+	}
+	sort.Slice(subscriptions, func(i, j int) bool {
+		return subscriptions[i].Created < subscriptions[j].Created
+	})
+	return subscriptions
+}
+
+func watchMatches(prefix string, event ChangeEvent) bool {
+	return strings.HasPrefix(event.Path, prefix) || event.From != "" && strings.HasPrefix(event.From, prefix)
+}
+
+// Notifies subscribers watching the changed path, cached details of it are dropped.
+// Callback events of deleted and moved away files end.
+func publishChange(event ChangeEvent) {
+	forgetFileDetail(event.Path)
+	if event.From != "" {
+		forgetFileDetail(event.From)
+		forgetCallbackEvents(event.From)
+	}
+	if event.Type == "deleted" {
+		forgetCallbackEvents(event.Path)
+	}
+
+	watch_mutex.Lock()
+	defer watch_mutex.Unlock()
+
+	if len(watch_subscriptions) == 0 && len(watch_streams) == 0 {
+		return
+	}
+
+	event.Id = newUUID()
+	event.Time = time.Now().UTC().Format(time.RFC3339)
+	if event.Source == "" {
+		event.Source = "proxy"
+	}
+
+	// Proxy changes are already published, reconciliation shouldn't repeat them.
+	if event.Source == "proxy" {
+		for prefix, files := range watch_snapshots {
+			if event.From != "" && strings.HasPrefix(event.From, prefix) {
+				delete(files, event.From)
+			}
+			if !strings.HasPrefix(event.Path, prefix) || strings.HasSuffix(event.Path, "/") {
+				continue
+			}
+			if event.Type == "deleted" {
+				delete(files, event.Path)
+			} else {
+				// Unknown id is filled in by the next reconciliation.
+				files[event.Path] = event.FileId
+			}
+		}
+	}
+
+	for _, subscription := range watch_subscriptions {
+		if watchMatches(subscription.Prefix, event) {
+			go deliverWatchEvent(subscription, event)
+		}
+	}
+
+	for stream := range watch_streams {
+		if !watchMatches(stream.prefix, event) {
+			continue
+		}
+		select {
+		case stream.events <- event:
+		default:
+			log.Println("Watch: dropping event", event.Id, "for slow stream of", stream.prefix)
+		}
+	}
+}
+
+// POSTs event to the webhook, retrying like upload callbacks.
+func deliverWatchEvent(subscription WatchSubscription, event ChangeEvent) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.Println("Watch:", err)
+		return
+	}
+
+	delay := CALLBACK_RETRY_DELAY
+	for attempt := 1; attempt <= CALLBACK_MAX_ATTEMPTS; attempt++ {
+		err := postWatchEvent(subscription.URL, event.Id, data)
+		if err == nil {
+			return
+		}
+
+		log.Printf("Watch %s event %s attempt %d failed: %v\n", subscription.Id, event.Id, attempt, err)
+		time.Sleep(delay)
+		delay *= 2
+	}
+
+	log.Println("Giving up watch event", event.Id, "to", subscription.URL)
+}
+
+func postWatchEvent(webhook_url, event_id string, data []byte) error {
+	req, err := http.NewRequest("POST", webhook_url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("X-Event-Id", event_id)
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	return nil
+}
+
+// Prefixes of webhooks and open streams.
+func watchedPrefixes() []string {
+	watch_mutex.RLock()
+	defer watch_mutex.RUnlock()
+
+	seen := make(map[string]bool)
+	for _, subscription := range watch_subscriptions {
+		seen[subscription.Prefix] = true
+	}
+	for stream := range watch_streams {
+		seen[stream.prefix] = true
+	}
+
+	var prefixes []string
+	for prefix := range seen {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+	return prefixes
+}
+
+// Lists watched folders and publishes files changed outside of the proxy.
+// The first listing of a prefix only records its files.
+func reconcileWatched() {
+	prefixes := watchedPrefixes()
+
+	listings := make(map[string]map[string]string)
+	for _, prefix := range prefixes {
+		files := make(map[string]string)
+		err := walkFolder(prefix, "", func(file_path, relative string, spec FileSpec) error {
+			if len(files) >= MAX_WATCH_RECONCILED {
+				return errTooManyWatched
+			}
+			files[file_path] = spec.Id
+			return nil
+		})
+		if err != nil && !isMissingPathError(err) {
+			log.Println("Watch:", prefix, err)
+			continue
+		}
+
+		listings[prefix] = files
+	}
+
+	var events []ChangeEvent
+
+	watch_mutex.Lock()
+	for prefix := range watch_snapshots {
+		if !stringInSlice(prefix, prefixes) {
+			delete(watch_snapshots, prefix)
+		}
+	}
+
+	for prefix, files := range listings {
+		previous, ok := watch_snapshots[prefix]
+		watch_snapshots[prefix] = files
+		if !ok {
+			continue
+		}
+
+		for path, id := range files {
+			if previous_id, existed := previous[path]; !existed {
+				events = append(events, ChangeEvent{Type: "created", Path: path, FileId: id, Source: "seafile"})
+			} else if previous_id != "" && previous_id != id {
+				events = append(events, ChangeEvent{Type: "updated", Path: path, FileId: id, Source: "seafile"})
+			}
+		}
+		for path, id := range previous {
+			if _, exists := files[path]; !exists {
+				events = append(events, ChangeEvent{Type: "deleted", Path: path, FileId: id, Source: "seafile"})
+			}
+		}
+	}
+	watch_mutex.Unlock()
+
+	// Nested prefixes see the same file, subscribers get it once.
+	published := make(map[string]bool)
+	for _, event := range events {
+		key := event.Type + "\n" + event.Path + "\n" + event.FileId
+		if !published[key] {
+			published[key] = true
+			publishChange(event)
+		}
+	}
+}
+
+func runWatchReconcile() {
+	for {
+		time.Sleep(watch_reconcile_interval)
+		reconcileWatched()
+	}
+}
+
+// Folder prefix of the watch: "/foo" and "/foo/" both watch /foo/.
+func watchPrefix(value string) (string, bool) {
+	if !strings.HasPrefix(value, "/") {
+		return "", false
+	}
+	return strings.TrimRight(value, "/") + "/", true
+}
+
+// GET /api/v1/watch lists webhooks.
+// POST /api/v1/watch with prefix=/foo/&url=http://service/hook registers one.
+// DELETE /api/v1/watch?id=... removes it.
+func apiWatchHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println(r.Method, r.RequestURI)
+
+	if r.Method != "GET" && r.Method != "POST" && r.Method != "DELETE" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Webhooks make the proxy call other services.
+	if !apiKeyAuthorized(r) {
+		writeAPIError(w, http.StatusForbidden, "Forbidden")
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		watch_mutex.RLock()
+		subscriptions := watchSubscriptionList()
+		watch_mutex.RUnlock()
+
+		writeAPI(w, http.StatusOK, subscriptions)
+	case "POST":
+		prefix, ok := watchPrefix(r.FormValue("prefix"))
+		if !ok {
+			writeAPIError(w, http.StatusBadRequest, "prefix should be a folder path")
+			return
+		}
+
+		webhook_url, err := url.Parse(r.FormValue("url"))
+		if err != nil || webhook_url.Host == "" || webhook_url.Scheme != "http" && webhook_url.Scheme != "https" {
+			writeAPIError(w, http.StatusBadRequest, "url should be http(s) URL")
+			return
+		}
+
+		subscription := WatchSubscription{
+			Id:      newUUID(),
+			Prefix:  prefix,
+			URL:     webhook_url.String(),
+			Created: time.Now().UTC().Format(time.RFC3339),
+		}
+
+		watch_mutex.Lock()
+		if len(watch_subscriptions) >= MAX_WATCH_SUBSCRIPTIONS {
+			watch_mutex.Unlock()
+			writeAPIError(w, http.StatusConflict, "Too many watch subscriptions")
+			return
+		}
+		watch_subscriptions[subscription.Id] = subscription
+		err = saveWatchSubscriptions()
+		watch_mutex.Unlock()
+
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		log.Println("Watching", prefix, "for", subscription.URL)
+		writeAPI(w, http.StatusCreated, subscription)
+	case "DELETE":
+		id := r.FormValue("id")
+
+		watch_mutex.Lock()
+		_, ok := watch_subscriptions[id]
+		delete(watch_subscriptions, id)
+		err := saveWatchSubscriptions()
+		watch_mutex.Unlock()
+
+		if !ok {
+			writeAPIError(w, http.StatusNotFound, "Unknown watch subscription")
+			return
+		}
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// GET /api/v1/watch/stream?prefix=/foo/ streams changes under the folder
+// as Server-Sent Events until the client disconnects.
+func apiWatchStreamHandler(w http.ResponseWriter, r *http.Request) {
+	log.Println(r.Method, r.RequestURI)
+
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	prefix, ok := watchPrefix(r.FormValue("prefix"))
+	if !ok {
+		writeAPIError(w, http.StatusBadRequest, "prefix should be a folder path")
+		return
+	}
+
+	if !downloadAuthorized(r, prefix) {
+		writeAPIError(w, http.StatusForbidden, "Forbidden")
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeAPIError(w, http.StatusInternalServerError, "Streaming is not supported")
+		return
+	}
+
+	stream := &watchStream{prefix: prefix, events: make(chan ChangeEvent, WATCH_STREAM_BUFFER)}
+	watch_mutex.Lock()
+	watch_streams[stream] = true
+	watch_mutex.Unlock()
+
+	defer func() {
+		watch_mutex.Lock()
+		delete(watch_streams, stream)
+		watch_mutex.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, ": watching "+prefix+"\n\n")
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(WATCH_STREAM_HEARTBEAT)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+		case event := <-stream.events:
+			data, _ := json.Marshal(event)
+			fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", event.Id, event.Type, data)
+		}
+		flusher.Flush()
+	}
+}